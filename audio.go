@@ -24,8 +24,10 @@ const (
 
 // Samples represents decoded audio samples, stored as normalized (-1, 1) float32,
 // interleaved and in separate channels.
+// Time is the presentation time in seconds, Ticks the same time in ticks of ClockRate.
 type Samples struct {
 	Time        float64
+	Ticks       int64
 	S16         []int16
 	F32         []float32
 	Left        []float32
@@ -52,6 +54,8 @@ func (s *Samples) Bytes() []byte {
 // Audio decodes MPEG-1 Audio Layer II (mp2) data into raw samples.
 type Audio struct {
 	time              float64
+	ticks             int64
+	baseTicks         int64
 	samplesDecoded    int
 	samplerateIndex   int
 	bitrateIndex      int
@@ -64,6 +68,10 @@ type Audio struct {
 	nextFrameDataSize int
 	hasHeader         bool
 
+	// Presentation time stamp of the next frame, if it was written with one.
+	pts    int64
+	hasPts bool
+
 	buf *Buffer
 
 	allocation      [2][32]*quantizerSpec
@@ -74,6 +82,9 @@ type Audio struct {
 	samples Samples
 	format  AudioFormat
 
+	// Error of the last Decode.
+	err error
+
 	d [1024]float32
 	v [2][1024]float32
 	u [32]float32
@@ -141,16 +152,31 @@ func (a *Audio) Time() float64 {
 // SetTime sets the current internal time in seconds. This is only useful when you
 // manipulate the underlying video buffer and want to enforce a correct timestamps.
 func (a *Audio) SetTime(time float64) {
-	a.samplesDecoded = int(time * float64(samplerate[a.samplerateIndex]))
-	a.time = time
+	a.SetTicks(secondsToTicks(time))
+}
+
+// Ticks returns the current internal time in ticks of ClockRate.
+func (a *Audio) Ticks() int64 {
+	return a.ticks
+}
+
+// SetTicks sets the current internal time in ticks of ClockRate, see SetTime.
+func (a *Audio) SetTicks(ticks int64) {
+	a.baseTicks = ticks
+	a.samplesDecoded = 0
+	a.time = float64(ticks) / ClockRate
+	a.ticks = ticks
 }
 
 // Rewind rewinds the internal buffer.
 func (a *Audio) Rewind() {
 	a.buf.Rewind()
 	a.time = 0
+	a.ticks = 0
+	a.baseTicks = 0
 	a.samplesDecoded = 0
 	a.nextFrameDataSize = 0
+	a.hasPts = false
 }
 
 // HasEnded checks whether the file has ended. This will be cleared on rewind.
@@ -158,29 +184,65 @@ func (a *Audio) HasEnded() bool {
 	return a.buf.HasEnded()
 }
 
+// Err returns the reason the last Decode returned nil: nil at the end of the data, ErrNeedMoreData
+// if the buffer has no complete frame yet, ErrUnsupportedCodec for other layers and versions of MPEG Audio,
+// like MP3, or the error of the buffer, see Buffer.Err.
+func (a *Audio) Err() error {
+	return a.err
+}
+
 // Decode decodes and returns one "frame" of audio and advance the
-// internal time by (SamplesPerFrame/samplerate) seconds.
+// internal time by (SamplesPerFrame/samplerate) seconds. If the frame was written to the buffer
+// with a presentation time stamp (see Buffer.WritePts), the internal time is set to it first.
+// If no frame could be decoded it returns nil, see Err for the reason.
 func (a *Audio) Decode() *Samples {
+	a.err = nil
+
 	// Do we have at least enough information to decode the frame header?
 	if a.nextFrameDataSize == 0 {
 		a.nextFrameDataSize = a.decodeHeader()
 	}
 
 	if a.nextFrameDataSize == 0 || !a.buf.has(a.nextFrameDataSize<<3) {
+		if a.err == nil {
+			a.err = a.endErr()
+		}
+
 		return nil
 	}
 
 	a.decodeFrame()
 	a.nextFrameDataSize = 0
 
+	if a.hasPts {
+		a.SetTicks(a.pts)
+		a.hasPts = false
+	}
+
 	a.samples.Time = a.time
+	a.samples.Ticks = a.ticks
 
+	// Count from the last time set, so the time does not drift on long streams.
+	sr := int64(samplerate[a.samplerateIndex])
 	a.samplesDecoded += SamplesPerFrame
-	a.time = float64(a.samplesDecoded) / float64(samplerate[a.samplerateIndex])
+	a.time = float64(a.baseTicks)/ClockRate + float64(a.samplesDecoded)/float64(sr)
+	a.ticks = a.baseTicks + int64(a.samplesDecoded)*ClockRate/sr
 
 	return &a.samples
 }
 
+// endErr returns the reason no frame could be decoded from the data in the buffer.
+func (a *Audio) endErr() error {
+	switch {
+	case a.buf.Err() != nil:
+		return a.buf.Err()
+	case !a.buf.HasEnded():
+		return ErrNeedMoreData
+	}
+
+	return nil
+}
+
 func (a *Audio) decodeHeader() int {
 	if !a.buf.has(48) {
 		return 0
@@ -205,11 +267,17 @@ func (a *Audio) decodeHeader() int {
 	hasCRC := a.buf.read1() == 0
 
 	if a.version != mpeg1 || a.layer != layerII {
+		// Once frames were decoded, this is a missed sync rather than another codec.
+		if !a.hasHeader {
+			a.err = ErrUnsupportedCodec
+		}
+
 		return 0
 	}
 
+	// Free format (0) and the forbidden index (15) are not supported.
 	bitrateIndex := a.buf.read(4) - 1
-	if bitrateIndex > 13 {
+	if bitrateIndex < 0 || bitrateIndex > 13 {
 		return 0
 	}
 
@@ -268,6 +336,9 @@ func (a *Audio) decodeHeader() int {
 		r = 6
 	}
 
+	// The frame started r bytes back, with the sync word.
+	a.pts, a.hasPts = a.buf.pts(r)
+
 	return frameSize - r
 }
 
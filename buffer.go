@@ -1,6 +1,7 @@
 package mpeg
 
 import (
+	"encoding/binary"
 	"errors"
 	"io"
 )
@@ -10,6 +11,14 @@ var (
 	BufferSize = 128 * 1024
 )
 
+var (
+	// ErrRead is the error reported when the reader of a buffer fails, joined with the error of the reader.
+	ErrRead = errors.New("read error")
+	// ErrNeedMoreData is the error reported when the data written to a buffer ends before
+	// a complete packet or frame, and more is expected.
+	ErrNeedMoreData = errors.New("need more data")
+)
+
 // LoadFunc callback function.
 type LoadFunc func(buffer *Buffer)
 
@@ -21,11 +30,37 @@ type Buffer struct {
 	bitIndex  int
 	totalSize int
 
+	// Number of bytes discarded from the front, so positions of buffers
+	// without a reader stay absolute.
+	discarded int
+
 	hasEnded    bool
 	discardRead bool
 
+	// The bytes are the whole source and are never moved, see NewBufferBytes.
+	inPlace bool
+
+	// Ring the data of a live buffer is written to, see NewBufferLive.
+	live *liveRing
+
+	// Error of the reader, other than io.EOF, or ErrLimitExceeded.
+	err error
+
+	// Maximum number of bytes held, see Limits.
+	maxSize int
+
 	available    []byte
 	loadCallback LoadFunc
+
+	// Presentation time stamps written with the data, by position.
+	timestamps []timestamp
+}
+
+// timestamp is the presentation time stamp of the data written between pos and end.
+type timestamp struct {
+	pos   int
+	end   int
+	ticks int64
 }
 
 // NewBuffer creates a buffer instance.
@@ -60,6 +95,39 @@ func NewBuffer(r io.Reader) (*Buffer, error) {
 	return buf, nil
 }
 
+// NewBufferReaderAt creates a seekable buffer that reads size bytes of r by offset, with LoadReaderCallback set.
+// The data is read in blocks of ReaderAtBlockSize, the last ReaderAtCacheBlocks used are cached, so seeking
+// and the scans of Demux.Seek and Demux.Duration read them only once. As r is not read sequentially,
+// several buffers can read the same r concurrently, e.g. a file or a client fetching byte ranges.
+func NewBufferReaderAt(r io.ReaderAt, size int64) (*Buffer, error) {
+	if size <= 0 {
+		return nil, errReaderAtSize
+	}
+
+	buf, err := NewBuffer(newReaderAt(r, size))
+	if err != nil {
+		return nil, err
+	}
+
+	buf.SetLoadCallback(buf.LoadReaderCallback)
+
+	return buf, nil
+}
+
+// NewBufferBytes creates a seekable buffer that reads data in place, without copying it.
+// Seeking only moves the read position, and the Data of demuxed packets aliases data,
+// so data must not be modified while the buffer or the packets are used. Do not Write to the buffer.
+func NewBufferBytes(data []byte) *Buffer {
+	buf := &Buffer{}
+
+	// Appending must not write past the data into the memory of the caller.
+	buf.bytes = data[:len(data):len(data)]
+	buf.totalSize = len(data)
+	buf.inPlace = true
+
+	return buf
+}
+
 // Bytes return a slice holding the unread portion of the buffer.
 func (b *Buffer) Bytes() []byte {
 	return b.bytes
@@ -70,17 +138,31 @@ func (b *Buffer) Index() int {
 	return b.bitIndex >> 3
 }
 
-// Seekable returns true if reader is seekable.
+// Seekable returns true if reader is seekable, or the buffer reads bytes in place.
 func (b *Buffer) Seekable() bool {
-	return b.reader != nil && b.totalSize > 0
+	return b.inPlace || b.reader != nil && b.totalSize > 0
 }
 
-// Write appends the contents of p to the buffer.
+// Write appends the contents of p to the buffer. If the buffer would hold more than the MaxBufferSize
+// of the Limits passed to the decoder, nothing is written, it returns 0 and Err reports ErrLimitExceeded.
+// Live buffers write as much of p as fits in the ring and drop the rest, see NewBufferLive.
 func (b *Buffer) Write(p []byte) int {
+	if b.live != nil {
+		n, _, _ := b.live.write(p, true, nil)
+
+		return n
+	}
+
 	if b.discardRead {
 		b.discardReadBytes()
 	}
 
+	if b.maxSize > 0 && len(b.bytes)+len(p) > b.maxSize {
+		b.err = ErrLimitExceeded
+
+		return 0
+	}
+
 	b.bytes = append(b.bytes, p...)
 
 	b.hasEnded = false
@@ -88,11 +170,37 @@ func (b *Buffer) Write(p []byte) int {
 	return len(p)
 }
 
+// WritePts appends the contents of p to the buffer, with ticks (see ClockRate) as the presentation
+// time stamp of the first frame that starts in p. The decoders take the time of such frames
+// from the time stamp instead of counting frames or samples.
+func (b *Buffer) WritePts(p []byte, ticks int64) int {
+	if b.live != nil {
+		n, _, _ := b.live.write(p, true, &ticks)
+
+		return n
+	}
+
+	if b.discardRead {
+		b.discardReadBytes()
+	}
+
+	pos := b.discarded + len(b.bytes)
+	b.timestamps = append(b.timestamps, timestamp{pos, pos + len(p), ticks})
+
+	return b.Write(p)
+}
+
 // SignalEnd marks the current byte length as the end of this buffer and signal that no
 // more data is expected to be written to it. This function should be called
 // just after the last Write().
 func (b *Buffer) SignalEnd() {
-	b.totalSize = len(b.bytes)
+	if b.live != nil {
+		b.live.end()
+
+		return
+	}
+
+	b.totalSize = b.discarded + len(b.bytes)
 }
 
 // SetLoadCallback sets a callback that is called whenever the buffer needs more data.
@@ -107,7 +215,8 @@ func (b *Buffer) Rewind() {
 }
 
 // Size returns the total size. For io.ReadSeeker, this returns the total size. For all other
-// types it returns the number of bytes currently in the buffer.
+// types it returns the number of bytes written once the end was signaled (see SignalEnd), and
+// the number of bytes currently in the buffer before.
 func (b *Buffer) Size() int {
 	if b.totalSize > 0 {
 		return b.totalSize
@@ -127,23 +236,45 @@ func (b *Buffer) HasEnded() bool {
 	return b.hasEnded
 }
 
+// Err returns the error of the reader, joined with ErrRead, or nil if reading succeeded or
+// stopped at io.EOF. A failing reader ends the buffer, see HasEnded. This is ErrLimitExceeded
+// if data was dropped by Write. This is cleared on seeking or rewind.
+func (b *Buffer) Err() error {
+	return b.err
+}
+
 // LoadReaderCallback is a callback that is called whenever the buffer needs more data.
+// Errors of the reader, other than io.EOF, end the buffer and are reported by Err.
 func (b *Buffer) LoadReaderCallback(buffer *Buffer) {
 	if b.hasEnded {
 		return
 	}
 
-	p := b.available
+	// The data read before the error is used up, do not read again.
+	if b.err != nil {
+		b.hasEnded = true
 
-	n, err := io.ReadFull(b.reader, p)
-	if err != nil {
-		if errors.Is(err, io.ErrUnexpectedEOF) {
-			p = p[:n]
-		} else if err == io.EOF {
-			b.hasEnded = true
+		return
+	}
 
-			return
+	p := b.available
+
+	// Read no more than fits, at least one byte, so a full buffer fails in Write.
+	if b.maxSize > 0 {
+		held := len(b.bytes)
+		if b.discardRead {
+			held -= b.bitIndex >> 3
 		}
+		p = p[:min(len(p), max(b.maxSize-held, 1))]
+	}
+
+	n, err := io.ReadFull(b.reader, p)
+	switch {
+	case err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF):
+		p = p[:n]
+	case err != nil:
+		p = p[:n]
+		b.err = errors.Join(ErrRead, err)
 	}
 
 	if n == 0 {
@@ -152,16 +283,29 @@ func (b *Buffer) LoadReaderCallback(buffer *Buffer) {
 		return
 	}
 
-	b.Write(p)
+	if b.Write(p) == 0 {
+		b.hasEnded = true
+	}
+}
+
+// setLimits applies the buffer size limit, if set and lower than the current one.
+func (b *Buffer) setLimits(limits Limits) {
+	if limits.MaxBufferSize > 0 && (b.maxSize == 0 || limits.MaxBufferSize < b.maxSize) {
+		b.maxSize = limits.MaxBufferSize
+	}
 }
 
 func (b *Buffer) seek(pos int) {
 	b.hasEnded = false
+	b.err = nil
 
-	if b.reader != nil && b.totalSize > 0 {
+	if b.inPlace {
+		b.bitIndex = min(max(pos, 0), len(b.bytes)) << 3
+	} else if b.reader != nil && b.totalSize > 0 {
 		seeker := b.reader.(io.Seeker)
 		_, _ = seeker.Seek(int64(pos), io.SeekStart)
 		b.bytes = b.bytes[:0]
+		b.timestamps = b.timestamps[:0]
 
 		b.bitIndex = 0
 	} else if b.reader == nil {
@@ -169,9 +313,13 @@ func (b *Buffer) seek(pos int) {
 			return
 		}
 
+		// The data is gone, so is the end signaled for it.
 		b.bytes = b.bytes[:0]
+		b.timestamps = b.timestamps[:0]
+		b.totalSize = 0
 
 		b.bitIndex = 0
+		b.discarded = 0
 	}
 }
 
@@ -183,11 +331,39 @@ func (b *Buffer) tell() int {
 		return int(off) + (b.bitIndex >> 3) - len(b.bytes)
 	}
 
-	return b.bitIndex >> 3
+	return b.discarded + (b.bitIndex >> 3)
+}
+
+// pts returns the presentation time stamp of a frame that starts back bytes before the read
+// position, if it was written with one. Each time stamp applies to the first frame only, so it is consumed.
+func (b *Buffer) pts(back int) (int64, bool) {
+	if len(b.timestamps) == 0 {
+		return 0, false
+	}
+
+	pos := b.tell() - back
+	for len(b.timestamps) > 0 && b.timestamps[0].end <= pos {
+		b.timestamps = b.timestamps[1:]
+	}
+
+	if len(b.timestamps) == 0 || b.timestamps[0].pos > pos {
+		return 0, false
+	}
+
+	ticks := b.timestamps[0].ticks
+	b.timestamps = b.timestamps[1:]
+
+	return ticks, true
 }
 
 func (b *Buffer) discardReadBytes() {
+	if b.inPlace {
+		return
+	}
+
 	bytePos := b.bitIndex >> 3
+	b.discarded += bytePos
+
 	if bytePos == len(b.bytes) {
 		b.bytes = b.bytes[:0]
 
@@ -213,7 +389,13 @@ func (b *Buffer) has(count int) bool {
 		}
 	}
 
-	if b.totalSize != 0 && len(b.bytes) == b.totalSize {
+	// Without a reader, the size includes the discarded bytes, see SignalEnd.
+	size := len(b.bytes)
+	if b.reader == nil {
+		size += b.discarded
+	}
+
+	if b.totalSize != 0 && size == b.totalSize {
 		b.hasEnded = true
 	}
 
@@ -221,29 +403,44 @@ func (b *Buffer) has(count int) bool {
 }
 
 func (b *Buffer) read(count int) int {
-	value := 0
-	for count != 0 {
-		currentByte := int(b.bytes[b.bitIndex>>3])
-
-		remaining := 8 - (b.bitIndex & 7) // Remaining bits in byte
-		read := count
-		if remaining < count { // Bits in self-run
-			read = remaining
-		}
+	// Reading past the end of the data reads zeros and stops at the end, for truncated and corrupt data.
+	if b.bitIndex+count > len(b.bytes)<<3 {
+		b.bitIndex = len(b.bytes) << 3
 
-		shift := remaining - read
-		mask := 0xff >> (8 - read)
+		return 0
+	}
 
-		value = (value << read) | ((currentByte & (mask << shift)) >> shift)
+	value := b.peek(count)
+	b.bitIndex += count
 
-		b.bitIndex += read
-		count -= read
+	return value
+}
+
+// peek returns the next count bits, up to 57, without advancing the read position.
+// The bits are taken from the 64 bits at the current byte, bits past the end of the data are zeros.
+func (b *Buffer) peek(count int) int {
+	i := b.bitIndex >> 3
+
+	var cache uint64
+	if i+8 <= len(b.bytes) {
+		cache = binary.BigEndian.Uint64(b.bytes[i:])
+	} else {
+		for j := range 8 {
+			cache <<= 8
+			if i+j < len(b.bytes) {
+				cache |= uint64(b.bytes[i+j])
+			}
+		}
 	}
 
-	return value
+	return int(cache << (b.bitIndex & 7) >> (64 - count))
 }
 
 func (b *Buffer) read1() int {
+	if b.bitIndex >= len(b.bytes)<<3 {
+		return 0
+	}
+
 	currentByte := int(b.bytes[b.bitIndex>>3])
 
 	shift := 7 - (b.bitIndex & 7)
@@ -323,6 +520,20 @@ func (b *Buffer) hasStartCode(code int) int {
 	return current
 }
 
+// peekStartCode returns the next start code without advancing the read position.
+func (b *Buffer) peekStartCode() int {
+	prevBitIndex := b.bitIndex
+	prevDiscardRead := b.discardRead
+
+	b.discardRead = false
+	current := b.nextStartCode()
+
+	b.bitIndex = prevBitIndex
+	b.discardRead = prevDiscardRead
+
+	return current
+}
+
 func (b *Buffer) findFrameSync() bool {
 	var i int
 	for i = b.bitIndex >> 3; i < len(b.bytes)-1; i++ {
@@ -333,46 +544,36 @@ func (b *Buffer) findFrameSync() bool {
 		}
 	}
 
-	b.bitIndex = (i + 1) << 3
+	b.bitIndex = min(i+1, len(b.bytes)) << 3
 
 	return false
 }
 
 func (b *Buffer) peekNonZero(bitCount int) bool {
-	if !b.has(bitCount) {
-		return false
-	}
-
-	val := b.read(bitCount)
-	b.bitIndex -= bitCount
-
-	return val != 0
+	return b.has(bitCount) && b.peek(bitCount) != 0
 }
 
-func (b *Buffer) readVlc(table []vlc) int {
-	var state vlc
-
-	for {
-		state = table[int(state.Index)+b.read1()]
-		if state.Index <= 0 {
-			break
-		}
-	}
-
-	return int(state.Value)
+func (b *Buffer) readVlc(table vlcLookup) int {
+	return int(int16(b.readVlcUint(table)))
 }
 
-func (b *Buffer) readVlcUint(table []vlcUint) uint16 {
-	var state vlcUint
+// readVlcUint reads a variable-length code, vlcLookupBits bits per lookup. Reading past the
+// end of the data reads zeros and stops at the end, as read does.
+func (b *Buffer) readVlcUint(table vlcLookup) uint16 {
+	end := len(b.bytes) << 3
 
+	offset := 0
 	for {
-		state = table[int(state.Index)+b.read1()]
-		if state.Index <= 0 {
-			break
+		entry := table[offset+b.peek(vlcLookupBits)]
+		if entry.Length > 0 {
+			b.bitIndex = min(b.bitIndex+int(entry.Length), end)
+
+			return entry.Value
 		}
-	}
 
-	return state.Value
+		b.bitIndex = min(b.bitIndex+vlcLookupBits, end)
+		offset = int(entry.Value)
+	}
 }
 
 type vlc struct {
@@ -384,3 +585,59 @@ type vlcUint struct {
 	Index int16
 	Value uint16
 }
+
+// vlcLookupBits is the number of bits decoded by one lookup in a vlcLookup.
+const vlcLookupBits = 8
+
+// vlcLookup is a multi-level lookup table for variable-length codes, built from a binary tree of vlc
+// entries, where each level is indexed by the next vlcLookupBits bits. An entry with a Length is the
+// Value of a code of Length bits in that level, an entry without is the offset of the next level.
+type vlcLookup []vlcEntry
+
+type vlcEntry struct {
+	Value  uint16
+	Length uint8
+}
+
+func newVlcLookup(tree []vlc) vlcLookup {
+	unsigned := make([]vlcUint, len(tree))
+	for i, state := range tree {
+		unsigned[i] = vlcUint{state.Index, uint16(state.Value)}
+	}
+
+	return newVlcUintLookup(unsigned)
+}
+
+func newVlcUintLookup(tree []vlcUint) vlcLookup {
+	var table vlcLookup
+
+	// level appends the level for the codes that continue at the node with index, and returns its offset.
+	var level func(index int) int
+	level = func(index int) int {
+		offset := len(table)
+		table = append(table, make(vlcLookup, 1<<vlcLookupBits)...)
+
+	codes:
+		for code := range 1 << vlcLookupBits {
+			node := index
+			for length := 1; length <= vlcLookupBits; length++ {
+				state := tree[node+(code>>(vlcLookupBits-length))&1]
+				if state.Index <= 0 {
+					table[offset+code] = vlcEntry{state.Value, uint8(length)}
+
+					continue codes
+				}
+
+				node = int(state.Index)
+			}
+
+			next := level(node)
+			table[offset+code] = vlcEntry{Value: uint16(next)}
+		}
+
+		return offset
+	}
+	level(0)
+
+	return table
+}
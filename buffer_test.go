@@ -0,0 +1,273 @@
+package mpeg
+
+import (
+	"bytes"
+	"errors"
+	"hash/fnv"
+	"math/rand/v2"
+	"os"
+	"testing"
+	"time"
+)
+
+// readVlcRef is the bit-by-bit walk of a vlc tree, used as an oracle for the lookup tables.
+func readVlcRef(b *Buffer, tree []vlcUint) uint16 {
+	var state vlcUint
+	for {
+		state = tree[int(state.Index)+b.read1()]
+		if state.Index <= 0 {
+			return state.Value
+		}
+	}
+}
+
+// readRef reads count bits one at a time, used as an oracle for read.
+func readRef(b *Buffer, count int) int {
+	if b.bitIndex+count > len(b.bytes)<<3 {
+		b.bitIndex = len(b.bytes) << 3
+
+		return 0
+	}
+
+	value := 0
+	for range count {
+		value = value<<1 | b.read1()
+	}
+
+	return value
+}
+
+// testBits returns random data, with mostly zero bits when sparse, which hits the long codes.
+func testBits(r *rand.Rand, size int, sparse bool) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(r.Uint32())
+		if sparse {
+			data[i] &= byte(r.Uint32()) & byte(r.Uint32())
+		}
+	}
+
+	return data
+}
+
+func TestReadVlcParity(t *testing.T) {
+	unsigned := func(tree []vlc) []vlcUint {
+		u := make([]vlcUint, len(tree))
+		for i, state := range tree {
+			u[i] = vlcUint{state.Index, uint16(state.Value)}
+		}
+
+		return u
+	}
+
+	for _, tc := range []struct {
+		name   string
+		tree   []vlcUint
+		lookup vlcLookup
+	}{
+		{"MacroblockAddressIncrement", unsigned(videoMacroblockAddressIncrement), videoMacroblockAddressIncrementLookup},
+		{"MacroblockTypeIntra", unsigned(videoMacroblockTypeIntra), videoMacroBlockTypeLookup[pictureTypeIntra]},
+		{"MacroblockTypePredictive", unsigned(videoMacroblockTypePredictive), videoMacroBlockTypeLookup[pictureTypePredictive]},
+		{"MacroblockTypeB", unsigned(videoMacroblockTypeB), videoMacroBlockTypeLookup[pictureTypeB]},
+		{"CodeBlockPattern", unsigned(videoCodeBlockPattern), videoCodeBlockPatternLookup},
+		{"Motion", unsigned(videoMotion), videoMotionLookup},
+		{"DctSizeLuminance", unsigned(videoDctSizeLuminance), videoDctSizeLookup[0]},
+		{"DctSizeChrominance", unsigned(videoDctSizeChrominance), videoDctSizeLookup[1]},
+		{"DctCoeff", videoDctCoeff, videoDctCoeffLookup},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := rand.New(rand.NewPCG(1, 2))
+
+			for _, sparse := range []bool{false, true} {
+				// Short data checks the codes that run past the end.
+				for _, size := range []int{1, 3, 64} {
+					data := testBits(r, size, sparse)
+
+					for pos := range len(data)<<3 + 1 {
+						got := &Buffer{bytes: data, bitIndex: pos}
+						want := &Buffer{bytes: data, bitIndex: pos}
+
+						value, wantValue := got.readVlcUint(tc.lookup), readVlcRef(want, tc.tree)
+						if value != wantValue || got.bitIndex != want.bitIndex {
+							t.Fatalf("size %d, sparse %v, bit %d: got value %d at bit %d, want %d at bit %d",
+								size, sparse, pos, value, got.bitIndex, wantValue, want.bitIndex)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReadParity(t *testing.T) {
+	r := rand.New(rand.NewPCG(3, 4))
+	data := testBits(r, 16, false)
+
+	for count := range 33 {
+		for pos := range len(data)<<3 + 1 {
+			got := &Buffer{bytes: data, bitIndex: pos}
+			want := &Buffer{bytes: data, bitIndex: pos}
+
+			value, wantValue := got.read(count), readRef(want, count)
+			if value != wantValue || got.bitIndex != want.bitIndex {
+				t.Fatalf("read(%d) at bit %d: got value %d at bit %d, want %d at bit %d",
+					count, pos, value, got.bitIndex, wantValue, want.bitIndex)
+			}
+		}
+	}
+}
+
+// FuzzBuffer writes data to a buffer in chunks and reads it with the operations in ops, checking
+// the reads against the bit-by-bit oracles and that the read position stays within the data.
+func FuzzBuffer(f *testing.F) {
+	mpg, err := os.ReadFile("testdata/test.mpg")
+	if err != nil {
+		f.Fatal(err)
+	}
+	mp2, err := os.ReadFile("testdata/test.mp2")
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Add(mpg[:256], []byte{0xf8, 3, 3, 0x09, 0x21, 0xf8, 2, 2, 4, 5, 0x81, 7, 3})
+	f.Add(mp2[:256], []byte{0xf8, 6, 0x61, 0x0a, 2, 0x31, 6, 7, 0x41})
+
+	f.Fuzz(func(t *testing.T, data, ops []byte) {
+		b, err := NewBuffer(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		written := 0
+		for _, op := range ops {
+			arg := int(op >> 3)
+
+			switch op & 7 {
+			case 0:
+				n := min(arg+1, len(data)-written)
+				b.Write(data[written:][:n])
+				if written += n; written == len(data) {
+					b.SignalEnd()
+				}
+			case 1:
+				want := &Buffer{bytes: b.bytes, bitIndex: b.bitIndex}
+				if value, wantValue := b.read(arg), readRef(want, arg); value != wantValue || b.bitIndex != want.bitIndex {
+					t.Fatalf("read(%d): got value %d at bit %d, want %d at bit %d", arg, value, b.bitIndex, wantValue, want.bitIndex)
+				}
+			case 2:
+				want := &Buffer{bytes: b.bytes, bitIndex: b.bitIndex}
+				if value, wantValue := b.readVlcUint(videoDctCoeffLookup), readVlcRef(want, videoDctCoeff); value != wantValue || b.bitIndex != want.bitIndex {
+					t.Fatalf("readVlcUint: got value %d at bit %d, want %d at bit %d", value, b.bitIndex, wantValue, want.bitIndex)
+				}
+			case 3:
+				if code := b.nextStartCode(); code != -1 {
+					i := b.bitIndex>>3 - 4
+					if !bytes.Equal(b.bytes[i:i+4], []byte{0x00, 0x00, 0x01, byte(code)}) {
+						t.Fatalf("nextStartCode: got %#x before % x", code, b.bytes[i:i+4])
+					}
+				}
+			case 4:
+				b.skip(arg)
+			case 5:
+				b.skipBytes(byte(arg))
+			case 6:
+				if b.findFrameSync() {
+					i := b.bitIndex>>3 - 1
+					if b.bytes[i] != 0xff || b.bytes[i+1]&0xfe != 0xfc {
+						t.Fatalf("findFrameSync: got % x", b.bytes[i:i+2])
+					}
+				}
+			case 7:
+				b.align()
+			}
+
+			if b.bitIndex < 0 || b.bitIndex > len(b.bytes)<<3 {
+				t.Fatalf("read position %d outside of %d bytes", b.bitIndex>>3, len(b.bytes))
+			}
+		}
+	})
+}
+
+func TestBufferBytes(t *testing.T) {
+	mpg, err := os.ReadFile("testdata/test.mpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("decode", func(t *testing.T) {
+		hashFrames := func(m *MPEG) (uint64, int) {
+			m.SetAudioEnabled(false)
+
+			h := fnv.New64a()
+			n := 0
+			for frame := m.DecodeVideo(); frame != nil; frame = m.DecodeVideo() {
+				h.Write(frame.Y.Data)
+				h.Write(frame.Cb.Data)
+				h.Write(frame.Cr.Data)
+				n++
+			}
+
+			return h.Sum64(), n
+		}
+
+		m, err := New(bytes.NewReader(mpg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, wantFrames := hashFrames(m)
+
+		m, err = NewBytes(mpg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, frames := hashFrames(m); got != want || frames != wantFrames {
+			t.Errorf("DecodeVideo: got %d frames with hash %x, want %d with %x", frames, got, wantFrames, want)
+		}
+
+		if frame := m.SeekFrame(5*time.Second, true); frame == nil || m.Err() != nil {
+			t.Errorf("SeekFrame: got error %v", m.Err())
+		}
+
+		if _, err := NewBytes(mpg[:3]); !errors.Is(err, ErrInvalidMPEG) {
+			t.Errorf("NewBytes: got error %v, want %v", err, ErrInvalidMPEG)
+		}
+	})
+
+	t.Run("alias", func(t *testing.T) {
+		data := bytes.Clone(mpg)
+
+		buf := NewBufferBytes(data)
+		if !buf.Seekable() || buf.Size() != len(data) {
+			t.Errorf("NewBufferBytes: got seekable %v and size %d", buf.Seekable(), buf.Size())
+		}
+
+		d, err := NewDemux(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		packets := 0
+		for packet := d.Decode(); packet != nil; packet = d.Decode() {
+			i := bytes.Index(data, packet.Data)
+			if i < 0 || &data[i] != &packet.Data[0] {
+				t.Fatalf("Decode: packet %d is a copy", packets)
+			}
+			packets++
+		}
+		if packets != 180 {
+			t.Errorf("Decode: got %d packets, want %d", packets, 180)
+		}
+
+		// Seeking only moves the read position over the same memory.
+		packet := d.Seek(3, PacketVideo1, true)
+		if packet == nil {
+			t.Fatal("Seek: packet is nil")
+		}
+		if i := bytes.Index(data, packet.Data); i < 0 || &data[i] != &packet.Data[0] {
+			t.Error("Seek: packet is a copy")
+		}
+		if !bytes.Equal(data, mpg) {
+			t.Error("Decode: data was modified")
+		}
+	})
+}
@@ -0,0 +1,256 @@
+package mpeg
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrInvalidCDXA is the error returned when the reader is not a valid RIFF/CDXA (VCD .dat) file.
+var ErrInvalidCDXA = errors.New("invalid RIFF/CDXA")
+
+var (
+	errCDXANotSeekable = errors.New("CDXA reader is not seekable")
+	errCDXAInvalidSeek = errors.New("invalid CDXA seek position")
+)
+
+// Layout of the 2352-byte Mode 2 sectors of a CDXA file.
+const (
+	cdxaSectorSize = 2352
+	cdxaHeaderSize = 24   // sync, header and subheader
+	cdxaPayload    = 2324 // Form 2 user data, followed by the EDC
+	cdxaForm1Data  = 2048 // Form 1 user data, followed by the EDC and ECC
+	cdxaSubmodeF2  = 0x20 // Form 2 bit of the submode
+)
+
+// CDXAReader reads the MPEG-PS payload of a Video CD .dat file, a RIFF/CDXA wrapper around
+// raw Mode 2 sectors. The RIFF header and the sync, header, subheader and EDC of every sector are stripped.
+// Each sector holds cdxaPayload bytes of the payload, Form 1 sectors are padded with zeros, so payload
+// positions map to sectors directly, see FileOffset and Position.
+// Seek only works if the underlying reader is an io.Seeker, see Seekable.
+type CDXAReader struct {
+	r      io.Reader
+	seeker io.Seeker
+
+	dataStart int64 // file offset of the first sector
+	size      int64 // payload size, -1 if unknown
+
+	pos     int64 // payload position
+	filePos int64 // file offset of the underlying reader
+
+	sector       [cdxaSectorSize]byte
+	sectorIndex  int64
+	sectorLength int
+}
+
+// isCDXA checks whether data starts with the RIFF header of a CDXA file.
+func isCDXA(data []byte) bool {
+	return len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "CDXA"
+}
+
+// NewCDXAReader reads the RIFF header from r and returns a reader of the payload.
+func NewCDXAReader(r io.Reader) (*CDXAReader, error) {
+	c := &CDXAReader{r: r, size: -1, sectorIndex: -1}
+
+	if seeker, ok := r.(io.Seeker); ok {
+		off, err := seeker.Seek(0, io.SeekCurrent)
+		if err == nil {
+			c.seeker = seeker
+			c.filePos = off
+		}
+	}
+
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, errors.Join(ErrInvalidCDXA, err)
+	}
+	c.filePos += 12
+
+	if !isCDXA(header[:]) {
+		return nil, ErrInvalidCDXA
+	}
+
+	// Skip chunks up to the data chunk, chunks are padded to an even size.
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return nil, errors.Join(ErrInvalidCDXA, err)
+		}
+		c.filePos += 8
+
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		if string(chunk[0:4]) == "data" {
+			c.dataStart = c.filePos
+			if size > 0 {
+				c.size = size
+			}
+
+			break
+		}
+
+		size += size & 1
+		if _, err := io.CopyN(io.Discard, r, size); err != nil {
+			return nil, errors.Join(ErrInvalidCDXA, err)
+		}
+		c.filePos += size
+	}
+
+	// The size in the header is often wrong for rips, trust the file if it is known.
+	if c.seeker != nil {
+		end, err := c.seeker.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		if c.size < 0 || c.dataStart+c.size > end {
+			c.size = end - c.dataStart
+		}
+
+		if _, err := c.seeker.Seek(c.filePos, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.size >= 0 {
+		sectors, rest := c.size/cdxaSectorSize, c.size%cdxaSectorSize
+		c.size = sectors*cdxaPayload + min(max(rest-cdxaHeaderSize, 0), cdxaPayload)
+	}
+
+	return c, nil
+}
+
+// Seekable returns true if the underlying reader is seekable.
+func (c *CDXAReader) Seekable() bool {
+	return c.seeker != nil
+}
+
+// Size returns the size of the payload, -1 if it is not known.
+func (c *CDXAReader) Size() int64 {
+	return c.size
+}
+
+// FileOffset returns the offset in the file of the payload byte at pos.
+func (c *CDXAReader) FileOffset(pos int64) int64 {
+	return c.dataStart + pos/cdxaPayload*cdxaSectorSize + cdxaHeaderSize + pos%cdxaPayload
+}
+
+// Position returns the payload position of the byte at the file offset. Offsets in the
+// RIFF header or the sector headers map to the start of the payload of the following sector.
+func (c *CDXAReader) Position(offset int64) int64 {
+	offset -= c.dataStart
+	if offset < 0 {
+		return 0
+	}
+
+	sector, off := offset/cdxaSectorSize, offset%cdxaSectorSize
+	switch {
+	case off < cdxaHeaderSize:
+		off = 0
+	case off >= cdxaHeaderSize+cdxaPayload:
+		sector, off = sector+1, 0
+	default:
+		off -= cdxaHeaderSize
+	}
+
+	return sector*cdxaPayload + off
+}
+
+// Read reads the payload into p.
+func (c *CDXAReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if c.size >= 0 && c.pos >= c.size {
+			break
+		}
+
+		sector, off := c.pos/cdxaPayload, int(c.pos%cdxaPayload)
+		if sector != c.sectorIndex {
+			if err := c.readSector(sector); err != nil {
+				if n > 0 {
+					return n, nil
+				}
+
+				return 0, err
+			}
+		}
+
+		if off >= c.sectorLength {
+			c.size = c.pos
+
+			break
+		}
+
+		m := copy(p[n:], c.sector[cdxaHeaderSize+off:cdxaHeaderSize+c.sectorLength])
+		n += m
+		c.pos += int64(m)
+	}
+
+	if n == 0 {
+		return 0, io.EOF
+	}
+
+	return n, nil
+}
+
+// Seek sets the payload position for the next Read.
+func (c *CDXAReader) Seek(offset int64, whence int) (int64, error) {
+	if c.seeker == nil {
+		return 0, errCDXANotSeekable
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += c.pos
+	case io.SeekEnd:
+		offset += c.size
+	default:
+		return 0, errCDXAInvalidSeek
+	}
+
+	if offset < 0 {
+		return 0, errCDXAInvalidSeek
+	}
+
+	c.pos = offset
+
+	return offset, nil
+}
+
+// readSector reads the sector with the index into the sector buffer.
+func (c *CDXAReader) readSector(index int64) error {
+	offset := c.dataStart + index*cdxaSectorSize
+	if offset != c.filePos {
+		if c.seeker == nil {
+			// Streams only go forward, skip to the sector.
+			if offset < c.filePos {
+				return errCDXANotSeekable
+			}
+			if _, err := io.CopyN(io.Discard, c.r, offset-c.filePos); err != nil {
+				return err
+			}
+		} else if _, err := c.seeker.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		c.filePos = offset
+	}
+
+	n, err := io.ReadFull(c.r, c.sector[:])
+	c.filePos += int64(n)
+	if n <= cdxaHeaderSize {
+		if err == nil || errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.EOF
+		}
+
+		return err
+	}
+
+	c.sectorIndex = index
+	c.sectorLength = min(n-cdxaHeaderSize, cdxaPayload)
+
+	// Form 1 sectors have less data, the rest of the payload is zero.
+	if c.sector[18]&cdxaSubmodeF2 == 0 {
+		clear(c.sector[cdxaHeaderSize+cdxaForm1Data : cdxaHeaderSize+cdxaPayload])
+	}
+
+	return nil
+}
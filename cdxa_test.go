@@ -0,0 +1,110 @@
+package mpeg_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gen2brain/mpeg"
+)
+
+// cdxa wraps data in the Form 2 sectors of a RIFF/CDXA file, with marker bytes in place of the EDC.
+func cdxa(data []byte) []byte {
+	const payload = 2324
+
+	sectors := (len(data) + payload - 1) / payload
+	out := []byte("RIFF\x00\x00\x00\x00CDXAfmt \x10\x00\x00\x00")
+	out = append(out, make([]byte, 16)...)
+	out = append(out, "data"...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(sectors*2352))
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8+sectors*2352))
+
+	for i := 0; i < sectors; i++ {
+		out = append(out, 0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x00)
+		out = append(out, byte(i/75/60), byte(i/75%60), byte(i%75), 2)
+		out = append(out, 1, 1, 0x20, 0, 1, 1, 0x20, 0)
+
+		sector := make([]byte, payload)
+		copy(sector, data[i*payload:])
+		out = append(out, sector...)
+		out = append(out, 0xED, 0xC0, 0xED, 0xC0)
+	}
+
+	return out
+}
+
+func TestCDXA(t *testing.T) {
+	dat := cdxa(testMpg)
+
+	r, err := mpeg.NewCDXAReader(bytes.NewReader(dat))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != int64(len(payload)) || !bytes.Equal(payload[:len(testMpg)], testMpg) || slices.ContainsFunc(payload[len(testMpg):], func(b byte) bool { return b != 0 }) {
+		t.Fatalf("ReadAll: got %d bytes, want the test stream padded to %d bytes", len(payload), r.Size())
+	}
+
+	for _, pos := range []int64{0, 2323, 2324, 100000, int64(len(testMpg) - 1)} {
+		offset := r.FileOffset(pos)
+		if dat[offset] != testMpg[pos] || r.Position(offset) != pos {
+			t.Errorf("FileOffset(%d): got %d, maps back to %d", pos, offset, r.Position(offset))
+		}
+	}
+
+	if _, err := mpeg.NewCDXAReader(bytes.NewReader(testMpg)); !errors.Is(err, mpeg.ErrInvalidCDXA) {
+		t.Errorf("NewCDXAReader: got error %v, want %v", err, mpeg.ErrInvalidCDXA)
+	}
+
+	want := decodeHashes(t, bytes.NewReader(testMpg))
+
+	// Seekable and streamed sources decode the same frames as the program stream.
+	for _, src := range []io.Reader{bytes.NewReader(dat), struct{ io.Reader }{bytes.NewReader(dat)}} {
+		if got := decodeHashes(t, src); !slices.Equal(got, want) {
+			t.Errorf("%T: got %d frames, want %d frames of the program stream", src, len(got), len(want))
+		}
+	}
+
+	m, err := mpeg.New(bytes.NewReader(dat))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Duration() != 9233333333*time.Nanosecond {
+		t.Errorf("Duration: got %v, want %v", m.Duration(), 9233333333*time.Nanosecond)
+	}
+
+	frame := m.SeekFrame(5*time.Second, true)
+	if frame == nil || frame.Ticks != 5*mpeg.ClockRate {
+		t.Fatalf("SeekFrame: got %+v, want a frame at %d ticks", frame, 5*mpeg.ClockRate)
+	}
+}
+
+// decodeHashes decodes all video frames of r and returns the hashes of their luma.
+func decodeHashes(t *testing.T, r io.Reader) []uint64 {
+	t.Helper()
+
+	m, err := mpeg.New(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetAudioEnabled(false)
+
+	var hashes []uint64
+	for frame := m.DecodeVideo(); frame != nil; frame = m.DecodeVideo() {
+		h := fnv.New64a()
+		h.Write(frame.Y.Data)
+		hashes = append(hashes, h.Sum64())
+	}
+
+	return hashes
+}
@@ -0,0 +1,487 @@
+// Command mpeg inspects MPEG-PS files and extracts frames, audio and elementary streams from them.
+//
+// Usage:
+//
+//	mpeg info [-json] <file>
+//	mpeg frames [-start 0s] [-end 0s] [-exact] [-quality 90] [-o frame%05d.png] <file>
+//	mpeg audio [-float] [-o out.wav] <file>
+//	mpeg demux [-video out.m1v] [-audio out.mp2] [-stream 0] <file>
+//	mpeg framemd5 [-o out.txt] <file>
+//
+// The file can be a program stream (.mpg), a Video CD .dat file or a raw elementary stream (.m1v, .mp2).
+// Use - or omit the file to read from stdin.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gen2brain/mpeg"
+)
+
+const usage = `Usage: mpeg <command> [flags] [file]
+
+Commands:
+  info      print stream information
+  frames    write video frames as PNG or JPEG images
+  audio     write audio as WAV
+  demux     write raw .m1v/.mp2 elementary streams
+  framemd5  print a hash of every video frame
+
+Use "mpeg <command> -h" for the flags of a command. Use - or omit the file to read from stdin.
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "mpeg:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run runs the command with args, reading - from stdin.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+
+		return flag.ErrHelp
+	}
+
+	c := &command{stdin: stdin, stdout: stdout}
+	c.flags = flag.NewFlagSet(args[0], flag.ContinueOnError)
+	c.flags.SetOutput(stderr)
+
+	var cmd func() error
+	switch args[0] {
+	case "info":
+		cmd = c.info
+	case "frames":
+		cmd = c.frames
+	case "audio":
+		cmd = c.audio
+	case "demux":
+		cmd = c.demux
+	case "framemd5":
+		cmd = c.framemd5
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stderr, usage)
+
+		return flag.ErrHelp
+	default:
+		fmt.Fprint(stderr, usage)
+
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+
+	c.args = args[1:]
+
+	return cmd()
+}
+
+// command holds the state of a subcommand.
+type command struct {
+	stdin  io.Reader
+	stdout io.Writer
+
+	flags *flag.FlagSet
+	args  []string
+}
+
+// parse parses the flags and returns the input file name.
+func (c *command) parse() (string, error) {
+	if err := c.flags.Parse(c.args); err != nil {
+		return "", err
+	}
+
+	switch c.flags.NArg() {
+	case 0:
+		return "-", nil
+	case 1:
+		return c.flags.Arg(0), nil
+	}
+
+	return "", fmt.Errorf("%s: too many arguments", c.flags.Name())
+}
+
+// open opens the input. Stdin is read into memory if seekable is true,
+// otherwise it is streamed. The returned function closes the input.
+func (c *command) open(name string, seekable bool) (io.Reader, func(), error) {
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return f, func() { _ = f.Close() }, nil
+	}
+
+	if !seekable {
+		return c.stdin, func() {}, nil
+	}
+
+	data, err := io.ReadAll(c.stdin)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return bytes.NewReader(data), func() {}, nil
+}
+
+// create creates the output file, - is stdout.
+func (c *command) create(name string) (io.Writer, func() error, error) {
+	if name == "-" {
+		return c.stdout, func() error { return nil }, nil
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return f, f.Close, nil
+}
+
+func (c *command) info() error {
+	asJSON := c.flags.Bool("json", false, "print JSON")
+
+	name, err := c.parse()
+	if err != nil {
+		return err
+	}
+
+	r, closeInput, err := c.open(name, true)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	m, err := mpeg.New(r)
+	if err != nil {
+		return err
+	}
+
+	info := m.Info()
+	if info == nil {
+		return errors.New("info: could not read the source")
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(info)
+	}
+
+	w := bufio.NewWriter(c.stdout)
+	fmt.Fprintf(w, "container: %s, size: %d, duration: %.3fs, bitrate: %d kb/s\n",
+		info.Container, info.Size, info.Duration, info.Bitrate/1000)
+
+	for _, s := range info.Streams {
+		fmt.Fprintf(w, "stream 0x%02X: %s %s, start: %.3fs, duration: %.3fs, bitrate: %d kb/s, packets: %d\n",
+			s.ID, s.Type, s.Codec, s.StartTime, s.Duration, s.Bitrate/1000, s.Packets)
+
+		if v := s.Video; v != nil {
+			fmt.Fprintf(w, "  %dx%d, aspect %.4f, %d/%d fps, gop %s (%d groups, max %d), %d I, %d P, %d B\n",
+				v.Width, v.Height, v.DisplayAspectRatio, v.FrameRateNum, v.FrameRateDen,
+				v.GOP.Pattern, v.GOP.Count, v.GOP.MaxSize, v.GOP.IFrames, v.GOP.PFrames, v.GOP.BFrames)
+		}
+		if a := s.Audio; a != nil {
+			fmt.Fprintf(w, "  layer %d, %s, %d channels, %d Hz, %d kb/s\n",
+				a.Layer, a.Mode, a.Channels, a.Samplerate, a.Bitrate/1000)
+		}
+	}
+
+	return w.Flush()
+}
+
+func (c *command) frames() error {
+	start := c.flags.Duration("start", 0, "time of the first frame")
+	end := c.flags.Duration("end", 0, "time after the last frame, 0 for the end of the source")
+	exact := c.flags.Bool("exact", false, "seek to the exact start time instead of the intra frame before it")
+	quality := c.flags.Int("quality", 90, "JPEG quality")
+	output := c.flags.String("o", "frame%05d.png", "output file name pattern, the extension selects PNG or JPEG")
+
+	name, err := c.parse()
+	if err != nil {
+		return err
+	}
+
+	ext := strings.ToLower(filepath.Ext(*output))
+	if ext != ".png" && ext != ".jpg" && ext != ".jpeg" {
+		return fmt.Errorf("frames: unsupported image format %q", ext)
+	}
+
+	r, closeInput, err := c.open(name, *start > 0)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	m, err := mpeg.New(r)
+	if err != nil {
+		return err
+	}
+	m.SetAudioEnabled(false)
+
+	frame := m.DecodeVideo()
+	if *start > 0 {
+		frame = m.SeekFrame(*start, *exact)
+		if frame == nil {
+			return errors.Join(fmt.Errorf("frames: could not seek to %v", *start), m.Err())
+		}
+	}
+
+	for n := 0; frame != nil; n++ {
+		if *end > 0 && frame.Ticks >= mpeg.ClockRate*end.Nanoseconds()/int64(time.Second) {
+			break
+		}
+
+		if err := writeImage(fmt.Sprintf(*output, n), ext, frame, *quality); err != nil {
+			return err
+		}
+
+		frame = m.DecodeVideo()
+	}
+
+	// Decoding stopped at the end of the source, or on an error.
+	if frame == nil {
+		return m.Err()
+	}
+
+	return nil
+}
+
+func writeImage(name, ext string, frame *mpeg.Frame, quality int) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if ext == ".png" {
+		err = png.Encode(f, frame.YCbCr())
+	} else {
+		err = jpeg.Encode(f, frame.YCbCr(), &jpeg.Options{Quality: quality})
+	}
+
+	return errors.Join(err, f.Close())
+}
+
+func (c *command) audio() error {
+	output := c.flags.String("o", "-", "output file, - for stdout")
+	stream := c.flags.Int("stream", 0, "audio stream index")
+	float := c.flags.Bool("float", false, "write 32-bit float instead of 16-bit PCM")
+
+	name, err := c.parse()
+	if err != nil {
+		return err
+	}
+
+	r, closeInput, err := c.open(name, false)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	m, err := mpeg.New(r)
+	if err != nil {
+		return err
+	}
+	if m.NumAudioStreams() == 0 {
+		return errors.New("audio: no audio stream")
+	}
+
+	m.SetVideoEnabled(false)
+	m.SetAudioStream(*stream)
+	m.SetAudioFormat(mpeg.AudioS16)
+	if *float {
+		m.SetAudioFormat(mpeg.AudioF32N)
+	}
+
+	w, closeOutput, err := c.create(*output)
+	if err != nil {
+		return err
+	}
+
+	err = writeWAV(w, m)
+
+	return errors.Join(err, closeOutput())
+}
+
+// writeWAV writes the decoded audio of m as WAV in the format of the samples.
+func writeWAV(w io.Writer, m *mpeg.MPEG) error {
+	wav, err := mpeg.NewWAVWriter(w, m.Samplerate(), m.Channels(), m.AudioFormat())
+	if err != nil {
+		return err
+	}
+
+	for samples := m.DecodeAudio(); samples != nil; samples = m.DecodeAudio() {
+		if err := wav.WriteSamples(samples); err != nil {
+			return err
+		}
+	}
+
+	return errors.Join(m.Err(), wav.Close())
+}
+
+func (c *command) demux() error {
+	videoOutput := c.flags.String("video", "", "video output file (.m1v), - for stdout")
+	audioOutput := c.flags.String("audio", "", "audio output file (.mp2), - for stdout")
+	stream := c.flags.Int("stream", 0, "audio stream index")
+
+	name, err := c.parse()
+	if err != nil {
+		return err
+	}
+
+	if *videoOutput == "" && *audioOutput == "" {
+		return errors.New("demux: no output, use -video and/or -audio")
+	}
+
+	r, closeInput, err := c.open(name, false)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	// VCD .dat files are unwrapped, raw elementary streams are not demuxed.
+	br := bufio.NewReader(r)
+	header, _ := br.Peek(12)
+	r = br
+	if len(header) == 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "CDXA" {
+		cdxa, err := mpeg.NewCDXAReader(br)
+		if err != nil {
+			return err
+		}
+		r = cdxa
+	}
+
+	buf, err := mpeg.NewBuffer(struct{ io.Reader }{r})
+	if err != nil {
+		return err
+	}
+	buf.SetLoadCallback(buf.LoadReaderCallback)
+
+	d, err := mpeg.NewDemux(buf)
+	if err != nil {
+		return err
+	}
+
+	outputs := make(map[int]*bufio.Writer)
+	var closers []func() error
+	defer func() {
+		for _, closeOutput := range closers {
+			_ = closeOutput()
+		}
+	}()
+
+	for typ, output := range map[int]string{mpeg.PacketVideo1: *videoOutput, mpeg.PacketAudio1 + *stream: *audioOutput} {
+		if output == "" {
+			continue
+		}
+
+		w, closeOutput, err := c.create(output)
+		if err != nil {
+			return err
+		}
+		outputs[typ] = bufio.NewWriter(w)
+		closers = append(closers, closeOutput)
+	}
+
+	for packet := d.Decode(); packet != nil; packet = d.Decode() {
+		if w := outputs[packet.Type]; w != nil {
+			if _, err := w.Write(packet.Data); err != nil {
+				return err
+			}
+		}
+	}
+	if err := d.Err(); err != nil {
+		return err
+	}
+
+	for _, w := range outputs {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	for _, closeOutput := range closers {
+		if err := closeOutput(); err != nil {
+			return err
+		}
+	}
+	closers = nil
+
+	return nil
+}
+
+func (c *command) framemd5() error {
+	output := c.flags.String("o", "-", "output file, - for stdout")
+
+	name, err := c.parse()
+	if err != nil {
+		return err
+	}
+
+	r, closeInput, err := c.open(name, false)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	m, err := mpeg.New(r)
+	if err != nil {
+		return err
+	}
+	m.SetAudioEnabled(false)
+
+	out, closeOutput, err := c.create(*output)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(out)
+	num, den := m.FramerateRational()
+	duration := int64(0)
+	if num != 0 {
+		duration = mpeg.ClockRate * int64(den) / int64(num)
+	}
+
+	// Same layout as the framemd5 muxer of FFmpeg, with the planes hashed at the picture size.
+	fmt.Fprintf(w, "#format: frame checksums\n#version: 2\n#hash: MD5\n#tb 0: 1/%d\n", mpeg.ClockRate)
+	fmt.Fprintf(w, "#stream#, dts, pts, duration, size, hash\n")
+
+	for frame := m.DecodeVideo(); frame != nil; frame = m.DecodeVideo() {
+		h := md5.New()
+		size := 0
+		for _, p := range []struct {
+			plane         mpeg.Plane
+			width, height int
+		}{
+			{frame.Y, frame.Width, frame.Height},
+			{frame.Cb, (frame.Width + 1) / 2, (frame.Height + 1) / 2},
+			{frame.Cr, (frame.Width + 1) / 2, (frame.Height + 1) / 2},
+		} {
+			for y := 0; y < p.height; y++ {
+				h.Write(p.plane.Data[y*p.plane.Width : y*p.plane.Width+p.width])
+			}
+			size += p.width * p.height
+		}
+
+		fmt.Fprintf(w, "0, %10d, %10d, %8d, %8d, %x\n", frame.Ticks, frame.Ticks, duration, size, h.Sum(nil))
+	}
+
+	return errors.Join(m.Err(), w.Flush(), closeOutput())
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gen2brain/mpeg"
+)
+
+const testMpg = "../../testdata/test.mpg"
+
+// runCmd runs the command and returns its output.
+func runCmd(t *testing.T, stdin []byte, args ...string) []byte {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	if err := run(args, bytes.NewReader(stdin), &stdout, &stderr); err != nil {
+		t.Fatalf("%v: %v\n%s", args, err, stderr.String())
+	}
+
+	return stdout.Bytes()
+}
+
+func TestInfo(t *testing.T) {
+	var info mpeg.Info
+	if err := json.Unmarshal(runCmd(t, nil, "info", "-json", testMpg), &info); err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Container != "mpeg" || len(info.Streams) != 2 || info.Streams[1].Video == nil || info.Streams[1].Video.Width != 160 {
+		t.Errorf("info: got %+v", info)
+	}
+
+	data, err := os.ReadFile(testMpg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out := string(runCmd(t, data, "info")); !strings.Contains(out, "video mpeg1video") || !strings.Contains(out, "audio mp2") {
+		t.Errorf("info from stdin: got %q", out)
+	}
+}
+
+func TestFrames(t *testing.T) {
+	dir := t.TempDir()
+	runCmd(t, nil, "frames", "-start", "1s", "-end", "2s", "-exact", "-o", filepath.Join(dir, "f%03d.jpg"), testMpg)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 30 {
+		t.Fatalf("frames: got %d files, want %d", len(files), 30)
+	}
+
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	img, err := jpeg.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 160 || b.Dy() != 120 {
+		t.Errorf("frames: got %v image, want 160x120", b)
+	}
+}
+
+func TestAudio(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "out.wav")
+	runCmd(t, nil, "audio", "-o", name, testMpg)
+
+	wav, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Mono 16-bit PCM, the sizes are fixed up in a file.
+	if string(wav[0:4]) != "RIFF" || string(wav[8:16]) != "WAVEfmt " || binary.LittleEndian.Uint16(wav[22:]) != 1 {
+		t.Fatalf("audio: got header %q", wav[:44])
+	}
+	if size := binary.LittleEndian.Uint32(wav[40:]); int(size) != len(wav)-44 || size == 0 || size%(mpeg.SamplesPerFrame*2) != 0 {
+		t.Errorf("audio: got data size %d for %d bytes", size, len(wav))
+	}
+
+	// Streamed to stdout, the header can not be fixed up.
+	data, err := os.ReadFile(testMpg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := runCmd(t, data, "audio")
+	if !bytes.Equal(out[44:], wav[44:]) || binary.LittleEndian.Uint32(out[40:]) != 0xFFFFFFFF-36 {
+		t.Errorf("audio to stdout: got %d bytes, header %q", len(out), out[:44])
+	}
+}
+
+func TestDemux(t *testing.T) {
+	dir := t.TempDir()
+	video, audio := filepath.Join(dir, "out.m1v"), filepath.Join(dir, "out.mp2")
+	runCmd(t, nil, "demux", "-video", video, "-audio", audio, testMpg)
+
+	mp2, err := os.ReadFile(audio)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("../../testdata/test.mp2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(mp2, want) {
+		t.Errorf("demux: got %d bytes of audio, want the %d bytes of test.mp2", len(mp2), len(want))
+	}
+
+	// The elementary stream decodes to the frames of the program stream.
+	if got, want := runCmd(t, nil, "framemd5", video), runCmd(t, nil, "framemd5", testMpg); !bytes.Equal(got, want) {
+		t.Errorf("demux: framemd5 of the video differs from the program stream")
+	}
+}
+
+func TestFramemd5(t *testing.T) {
+	out := runCmd(t, nil, "framemd5", testMpg)
+
+	data, err := os.ReadFile(testMpg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(runCmd(t, data, "framemd5"), out) {
+		t.Errorf("framemd5: output from stdin differs from file")
+	}
+
+	var frames []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			frames = append(frames, line)
+		}
+	}
+
+	if len(frames) != 278 {
+		t.Fatalf("framemd5: got %d frames, want %d", len(frames), 278)
+	}
+	if fields := strings.Split(frames[1], ","); len(fields) != 6 || strings.TrimSpace(fields[1]) != "3000" || strings.TrimSpace(fields[4]) != "28800" {
+		t.Errorf("framemd5: got %q", frames[1])
+	}
+}
+
+func TestUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if err := run([]string{"nope"}, nil, &stdout, &stderr); err == nil || !strings.Contains(stderr.String(), "Commands:") {
+		t.Errorf("run: got error %v, usage %q", err, stderr.String())
+	}
+}
@@ -0,0 +1,238 @@
+package mpeg
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// ErrInvalidPixelFormat is the error reported when converting to an unknown PixelFormat.
+var ErrInvalidPixelFormat = errors.New("invalid pixel format")
+
+// ColorMatrix is the matrix of the YCbCr to RGB conversion.
+type ColorMatrix int
+
+const (
+	// BT601 - ITU-R BT.601, the matrix of MPEG-1 and standard definition video
+	BT601 ColorMatrix = iota
+	// BT709 - ITU-R BT.709, the matrix of high definition video
+	BT709
+)
+
+// ColorRange is the range of the YCbCr values.
+type ColorRange int
+
+const (
+	// RangeLimited - Y in 16-235, Cb and Cr in 16-240, as MPEG-1 video is coded
+	RangeLimited ColorRange = iota
+	// RangeFull - Y, Cb and Cr in 0-255, as in JPEG and image.YCbCr
+	RangeFull
+)
+
+// PixelFormat is the layout of the converted pixels.
+type PixelFormat int
+
+const (
+	// PixelRGBA - 4 bytes per pixel, red, green, blue and alpha, alpha is 255
+	PixelRGBA PixelFormat = iota
+	// PixelBGRA - 4 bytes per pixel, blue, green, red and alpha, alpha is 255
+	PixelBGRA
+	// PixelRGB24 - 3 bytes per pixel, red, green and blue
+	PixelRGB24
+	// PixelRGB565 - 2 bytes per pixel, little-endian, 5 bits of red, 6 of green and 5 of blue
+	PixelRGB565
+)
+
+// BytesPerPixel returns the size of a pixel, or 0 for an unknown format.
+func (f PixelFormat) BytesPerPixel() int {
+	switch f {
+	case PixelRGBA, PixelBGRA:
+		return 4
+	case PixelRGB24:
+		return 3
+	case PixelRGB565:
+		return 2
+	}
+
+	return 0
+}
+
+// Converter converts decoded frames to packed RGB pixels.
+// The chroma planes are upsampled bilinearly, the chroma samples of MPEG-1 are centered between the luma samples.
+// The conversion uses SSE2 or AVX2 where available.
+type Converter struct {
+	format PixelFormat
+	coeffs yuvCoeffs
+}
+
+// NewConverter returns a new Converter with the given matrix and range of the source, and pixel format of the output.
+func NewConverter(matrix ColorMatrix, colorRange ColorRange, format PixelFormat) *Converter {
+	kr, kb := 0.299, 0.114
+	if matrix == BT709 {
+		kr, kb = 0.2126, 0.0722
+	}
+	kg := 1 - kr - kb
+
+	c := &Converter{format: format}
+
+	ys, cs := 1.0, 1.0
+	if colorRange == RangeLimited {
+		ys, cs = 255.0/219, 255.0/224
+		c.coeffs.yOffset = 16
+	}
+
+	fixed := func(v float64) int32 {
+		return int32(math.Round(v * (1 << yuvFractionBits)))
+	}
+
+	c.coeffs.y = fixed(ys)
+	c.coeffs.crR = fixed(2 * (1 - kr) * cs)
+	c.coeffs.cbG = fixed(2 * kb * (1 - kb) / kg * cs)
+	c.coeffs.crG = fixed(2 * kr * (1 - kr) / kg * cs)
+	c.coeffs.cbB = fixed(2 * (1 - kb) * cs)
+
+	return c
+}
+
+// Convert converts frame to dst, with stride bytes per row, or Width * BytesPerPixel if stride is 0.
+// Returns io.ErrShortBuffer if dst is too small for the frame.
+func (c *Converter) Convert(dst []byte, stride int, frame *Frame) error {
+	bpp := c.format.BytesPerPixel()
+	if bpp == 0 {
+		return ErrInvalidPixelFormat
+	}
+
+	width, height := frame.Width, frame.Height
+	if width <= 0 || height <= 0 {
+		return nil
+	}
+
+	if stride == 0 {
+		stride = width * bpp
+	}
+
+	if stride < width*bpp || len(dst) < stride*(height-1)+width*bpp {
+		return io.ErrShortBuffer
+	}
+
+	lastRow := (height+1)/2 - 1
+	chromaLen := (width + 1) / 2
+
+	for row := 0; row < height; row++ {
+		// Each row is interpolated from the nearest chroma row and the one above or below it.
+		near := row >> 1
+		far := min(near+1, lastRow)
+		if row&1 == 0 {
+			far = max(near-1, 0)
+		}
+
+		y := frame.Y.Data[row*frame.Y.Width:][:width]
+		cb0 := frame.Cb.Data[near*frame.Cb.Width:][:chromaLen]
+		cb1 := frame.Cb.Data[far*frame.Cb.Width:][:chromaLen]
+		cr0 := frame.Cr.Data[near*frame.Cr.Width:][:chromaLen]
+		cr1 := frame.Cr.Data[far*frame.Cr.Width:][:chromaLen]
+
+		yuvRow(dst[row*stride:][:width*bpp], y, cb0, cb1, cr0, cr1, width, &c.coeffs, c.format)
+	}
+
+	return nil
+}
+
+// yuvFractionBits is the precision of the fixed-point coefficients.
+// The products of 8-bit values and the coefficients fit in 32 bits, and the coefficients in 16 bits.
+const yuvFractionBits = 13
+
+// yuvCoeffs holds the fixed-point coefficients of the conversion, the field order is used by the asm kernels.
+type yuvCoeffs struct {
+	yOffset int32 // black level of Y
+	y       int32 // gain of Y
+
+	crR int32
+	cbG int32
+	crG int32
+	cbB int32
+}
+
+// rgb converts a luma value and the chroma values, less 128, to RGB.
+func (c *yuvCoeffs) rgb(y byte, cb, cr int32) (r, g, b byte) {
+	l := (int32(y)-c.yOffset)*c.y + 1<<(yuvFractionBits-1)
+
+	return yuvClamp(l + cr*c.crR), yuvClamp(l - cb*c.cbG - cr*c.crG), yuvClamp(l + cb*c.cbB)
+}
+
+// yuvClamp returns v as a byte, clamped to 0-255, like image/color does.
+func yuvClamp(v int32) byte {
+	if uint32(v)&^(1<<(8+yuvFractionBits)-1) == 0 {
+		return byte(v >> yuvFractionBits)
+	}
+
+	return byte(^(v >> 31))
+}
+
+// yuvUpsample returns the chroma value, less 128, at a luma sample. The nearest chroma sample n
+// is weighted 9:3:3:1 with its vertical neighbour v, horizontal neighbour h and diagonal neighbour d.
+func yuvUpsample(n, v, h, d byte) int32 {
+	return (3*(3*int32(n)+int32(v))+3*int32(h)+int32(d)+8)>>4 - 128
+}
+
+// yuvRowGeneric converts the pixels from to to of a row that is width pixels wide.
+// y is the luma row, cb0 and cr0 the nearest chroma rows and cb1 and cr1 the other rows of the interpolation.
+func yuvRowGeneric(dst, y, cb0, cb1, cr0, cr1 []byte, from, to, width int, c *yuvCoeffs, format PixelFormat) {
+	last := (width+1)/2 - 1
+	k := *c // not reloaded after the stores to dst
+
+	for x := from; x < to; x++ {
+		i := x >> 1
+		j := min(i+1, last)
+		if x&1 == 0 {
+			j = max(i-1, 0)
+		}
+
+		cb := yuvUpsample(cb0[i], cb1[i], cb0[j], cb1[j])
+		cr := yuvUpsample(cr0[i], cr1[i], cr0[j], cr1[j])
+		r, g, b := k.rgb(y[x], cb, cr)
+
+		switch format {
+		case PixelRGBA:
+			p := dst[4*x : 4*x+4]
+			p[0], p[1], p[2], p[3] = r, g, b, 0xff
+		case PixelBGRA:
+			p := dst[4*x : 4*x+4]
+			p[0], p[1], p[2], p[3] = b, g, r, 0xff
+		case PixelRGB24:
+			p := dst[3*x : 3*x+3]
+			p[0], p[1], p[2] = r, g, b
+		case PixelRGB565:
+			binary.LittleEndian.PutUint16(dst[2*x:], uint16(r>>3)<<11|uint16(g>>2)<<5|uint16(b>>3))
+		}
+	}
+}
+
+// yuvKernelFunc converts blocks of 2*size pixels, starting at the second chroma sample, see yuvRowKernel.
+type yuvKernelFunc func(dst, y, cb0, cb1, cr0, cr1 *byte, blocks int, c *yuvCoeffs, format PixelFormat)
+
+// yuvRowKernel converts a row with a SIMD kernel that handles size chroma samples at a time.
+// The kernels read the chroma samples on both sides of a block, so they convert the pixels of the
+// chroma samples from the second to the one before the last, and leave the others to the generic code.
+// The samples that do not fill a block are converted by one more block that overlaps the previous one.
+// The generic code runs after the kernel, which may write a few bytes past its last block.
+func yuvRowKernel(kernel yuvKernelFunc, size int, dst, y, cb0, cb1, cr0, cr1 []byte, width int, c *yuvCoeffs, format PixelFormat) {
+	from, to := 0, 0
+	bpp := format.BytesPerPixel()
+
+	last := (width+1)/2 - 1
+	if blocks := (last - 1) / size; blocks > 0 {
+		kernel(&dst[2*bpp], &y[2], &cb0[1], &cb1[1], &cr0[1], &cr1[1], blocks, c, format)
+
+		if (last-1)%size != 0 {
+			i := last - size
+			kernel(&dst[2*i*bpp], &y[2*i], &cb0[i], &cb1[i], &cr0[i], &cr1[i], 1, c, format)
+		}
+
+		from, to = 2, 2*last
+	}
+
+	yuvRowGeneric(dst, y, cb0, cb1, cr0, cr1, 0, from, width, c, format)
+	yuvRowGeneric(dst, y, cb0, cb1, cr0, cr1, to, width, width, c, format)
+}
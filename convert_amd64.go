@@ -0,0 +1,17 @@
+//go:build amd64 && !noasm
+
+package mpeg
+
+//go:noescape
+func yuvRowSSE2(dst, y, cb0, cb1, cr0, cr1 *byte, blocks int, c *yuvCoeffs, format PixelFormat)
+
+//go:noescape
+func yuvRowAVX2(dst, y, cb0, cb1, cr0, cr1 *byte, blocks int, c *yuvCoeffs, format PixelFormat)
+
+func yuvRow(dst, y, cb0, cb1, cr0, cr1 []byte, width int, c *yuvCoeffs, format PixelFormat) {
+	if isAVX2 {
+		yuvRowKernel(yuvRowAVX2, 8, dst, y, cb0, cb1, cr0, cr1, width, c, format)
+	} else {
+		yuvRowKernel(yuvRowSSE2, 4, dst, y, cb0, cb1, cr0, cr1, width, c, format)
+	}
+}
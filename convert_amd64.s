@@ -0,0 +1,454 @@
+//go:build amd64 && !noasm
+
+#include "textflag.h"
+
+// yuvRowSSE2 converts blocks of 8 pixels (4 chroma samples) of a row, see
+// yuvRowGeneric for the arithmetic, which this matches exactly.
+//
+// func yuvRowSSE2(dst, y, cb0, cb1, cr0, cr1 *byte, blocks int, c *yuvCoeffs, format PixelFormat)
+//
+// The chroma samples are upsampled with Cb in the low and Cr in the high words
+// of a register. The conversion runs in dwords with PMADDWD on pairs of words:
+// (Y-yOffset, 1) by (y, round) and (Cr, Cb) by the chroma coefficients.
+//
+// Persistent registers:
+//   DI = dst, SI = y, R8/R9 = cb0/cb1, R10/R11 = cr0/cr1, CX = blocks
+//   X8  = -2040 per word (upsampling round, less 128<<4)
+//   X9  = yOffset per word
+//   X10 = (0, cbB), X11 = (-crG, -cbG), X12 = (crR, 0), X13 = (y, round)
+//   X14 = 1 per word, X15 = zero
+
+// SUM4: 3*near + far of the 4 Cb and 4 Cr samples at off, in words.
+#define SUM4(off, d, t, u) \
+	MOVL      off(R8), d   \
+	MOVL      off(R10), t  \
+	PUNPCKLLQ t, d         \
+	PUNPCKLBW X15, d       \
+	MOVL      off(R9), t   \
+	MOVL      off(R11), u  \
+	PUNPCKLLQ u, t         \
+	PUNPCKLBW X15, t       \
+	MOVO      d, u         \
+	PADDW     d, d         \
+	PADDW     u, d         \
+	PADDW     t, d
+
+// CONVERT8: 8 pixels as words of R in X5, G in X6 and B in X3, not clamped.
+#define CONVERT8 \
+	SUM4(-1, X0, X6, X7) \
+	SUM4(0, X1, X6, X7)  \
+	SUM4(1, X2, X6, X7)  \
+	MOVO      X1, X3     \
+	PADDW     X1, X1     \
+	PADDW     X3, X1     \
+	PADDW     X1, X0     \
+	PADDW     X8, X0     \
+	PSRAW     $4, X0     \
+	PADDW     X1, X2     \
+	PADDW     X8, X2     \
+	PSRAW     $4, X2     \
+	MOVO      X0, X1     \
+	PUNPCKLWL X2, X1     \
+	PUNPCKHWL X2, X0     \
+	MOVQ      (SI), X2   \
+	PUNPCKLBW X15, X2    \
+	PSUBW     X9, X2     \
+	MOVO      X0, X3     \
+	PUNPCKLWL X1, X3     \
+	PUNPCKHWL X1, X0     \
+	MOVO      X2, X4     \
+	PUNPCKLWL X14, X4    \
+	PUNPCKHWL X14, X2    \
+	PMADDWL   X13, X4    \
+	PMADDWL   X13, X2    \
+	MOVO      X3, X5     \
+	PMADDWL   X12, X5    \
+	PADDL     X4, X5     \
+	PSRAL     $13, X5    \
+	MOVO      X3, X6     \
+	PMADDWL   X11, X6    \
+	PADDL     X4, X6     \
+	PSRAL     $13, X6    \
+	PMADDWL   X10, X3    \
+	PADDL     X4, X3     \
+	PSRAL     $13, X3    \
+	MOVO      X0, X4     \
+	PMADDWL   X12, X4    \
+	PADDL     X2, X4     \
+	PSRAL     $13, X4    \
+	MOVO      X0, X7     \
+	PMADDWL   X11, X7    \
+	PADDL     X2, X7     \
+	PSRAL     $13, X7    \
+	PMADDWL   X10, X0    \
+	PADDL     X2, X0     \
+	PSRAL     $13, X0    \
+	PACKSSLW  X4, X5     \
+	PACKSSLW  X7, X6     \
+	PACKSSLW  X0, X3
+
+// INTERLEAVE8: bytes of x, y, z and w interleaved to the 8 dwords of x and X0.
+#define INTERLEAVE8(x, y, z, w) \
+	PACKUSWB  x, x    \
+	PACKUSWB  y, y    \
+	PACKUSWB  z, z    \
+	PUNPCKLBW y, x    \
+	PUNPCKLBW w, z    \
+	MOVO      x, X0   \
+	PUNPCKLWL z, X0   \
+	PUNPCKHWL z, x
+
+// PACK24: the 4 dwords of x to 2 qwords of 6 bytes, the high bytes of the dwords are 0.
+#define PACK24(x, t) \
+	MOVO  x, t       \
+	PSLLQ $32, x     \
+	PSRLQ $32, x     \
+	PSRLQ $32, t     \
+	PSLLQ $24, t     \
+	POR   t, x
+
+// NEXT8: advances the pointers by a block of 8 pixels of n bytes.
+#define NEXT8(n) \
+	ADDQ $n, DI  \
+	ADDQ $8, SI  \
+	ADDQ $4, R8  \
+	ADDQ $4, R9  \
+	ADDQ $4, R10 \
+	ADDQ $4, R11 \
+	DECQ CX
+
+TEXT ·yuvRowSSE2(SB), NOSPLIT, $0-72
+	MOVQ dst+0(FP), DI
+	MOVQ y+8(FP), SI
+	MOVQ cb0+16(FP), R8
+	MOVQ cb1+24(FP), R9
+	MOVQ cr0+32(FP), R10
+	MOVQ cr1+40(FP), R11
+	MOVQ blocks+48(FP), CX
+	MOVQ c+56(FP), DX
+
+	PXOR    X15, X15
+	PCMPEQW X14, X14
+	PSRLW   $15, X14
+
+	MOVL   4(DX), AX
+	ORL    $0x10000000, AX
+	MOVQ   AX, X13
+	PSHUFL $0, X13, X13
+
+	MOVL   8(DX), AX
+	MOVQ   AX, X12
+	PSHUFL $0, X12, X12
+
+	MOVL   16(DX), AX
+	NEGL   AX
+	ANDL   $0xffff, AX
+	MOVL   12(DX), BX
+	NEGL   BX
+	SHLL   $16, BX
+	ORL    BX, AX
+	MOVQ   AX, X11
+	PSHUFL $0, X11, X11
+
+	MOVL   20(DX), AX
+	SHLL   $16, AX
+	MOVQ   AX, X10
+	PSHUFL $0, X10, X10
+
+	MOVL    0(DX), AX
+	MOVQ    AX, X9
+	PSHUFLW $0, X9, X9
+	PSHUFL  $0, X9, X9
+
+	MOVL    $0xf808, AX
+	MOVQ    AX, X8
+	PSHUFLW $0, X8, X8
+	PSHUFL  $0, X8, X8
+
+	MOVQ format+64(FP), BX
+	CMPQ BX, $1
+	JEQ  yuv_sse2_bgra
+	CMPQ BX, $2
+	JEQ  yuv_sse2_rgb24
+	CMPQ BX, $3
+	JEQ  yuv_sse2_rgb565
+
+yuv_sse2_rgba:
+	CONVERT8
+	PCMPEQB X7, X7
+	INTERLEAVE8(X5, X6, X3, X7)
+	MOVOU   X0, (DI)
+	MOVOU   X5, 16(DI)
+	NEXT8(32)
+	JNZ     yuv_sse2_rgba
+	RET
+
+yuv_sse2_bgra:
+	CONVERT8
+	PCMPEQB X7, X7
+	INTERLEAVE8(X3, X6, X5, X7)
+	MOVOU   X0, (DI)
+	MOVOU   X3, 16(DI)
+	NEXT8(32)
+	JNZ     yuv_sse2_bgra
+	RET
+
+	// The stores of 8 bytes write 2 bytes past the block, which belong
+	// to the next block or to the pixels left to the generic code.
+yuv_sse2_rgb24:
+	CONVERT8
+	INTERLEAVE8(X5, X6, X3, X15)
+	PACK24(X0, X1)
+	PACK24(X5, X1)
+	MOVQ    X0, (DI)
+	PSRLDQ  $8, X0
+	MOVQ    X0, 6(DI)
+	MOVQ    X5, 12(DI)
+	PSRLDQ  $8, X5
+	MOVQ    X5, 18(DI)
+	NEXT8(24)
+	JNZ     yuv_sse2_rgb24
+	RET
+
+yuv_sse2_rgb565:
+	CONVERT8
+	PACKUSWB  X5, X5
+	PUNPCKLBW X15, X5
+	PACKUSWB  X6, X6
+	PUNPCKLBW X15, X6
+	PACKUSWB  X3, X3
+	PUNPCKLBW X15, X3
+	PSRLW     $3, X5
+	PSLLW     $11, X5
+	PSRLW     $2, X6
+	PSLLW     $5, X6
+	PSRLW     $3, X3
+	POR       X6, X5
+	POR       X3, X5
+	MOVOU     X5, (DI)
+	NEXT8(16)
+	JNZ       yuv_sse2_rgb565
+	RET
+
+DATA yuvShuffle24<>+0(SB)/8, $0x0908060504020100
+DATA yuvShuffle24<>+8(SB)/8, $0x808080800e0d0c0a
+DATA yuvShuffle24<>+16(SB)/8, $0x0908060504020100
+DATA yuvShuffle24<>+24(SB)/8, $0x808080800e0d0c0a
+GLOBL yuvShuffle24<>(SB), RODATA|NOPTR, $32
+
+// yuvRowAVX2 converts blocks of 16 pixels (8 chroma samples) of a row, the
+// same way as yuvRowSSE2.
+//
+// func yuvRowAVX2(dst, y, cb0, cb1, cr0, cr1 *byte, blocks int, c *yuvCoeffs, format PixelFormat)
+//
+// The chroma samples are upsampled with Cb in the low and Cr in the high lane.
+// The unpacks and packs work within the lanes, the pixels are put in order by
+// VPERM2I128 after the upsampling and before the stores.
+//
+// Persistent registers as in yuvRowSSE2, in Y8-Y15.
+
+// SUM8: 3*near + far of the 8 Cb and 8 Cr samples at off, in words.
+#define SUM8(off, x, y, tx, ty, u) \
+	VMOVQ     off(R8), x           \
+	VPINSRQ   $1, off(R10), x, x   \
+	VPMOVZXBW x, y                 \
+	VMOVQ     off(R9), tx          \
+	VPINSRQ   $1, off(R11), tx, tx \
+	VPMOVZXBW tx, ty               \
+	VPADDW    y, y, u              \
+	VPADDW    u, y, y              \
+	VPADDW    ty, y, y
+
+// VCONVERT16: 16 pixels as words of R in Y5, G in Y6 and B in Y3, not clamped.
+#define VCONVERT16 \
+	SUM8(-1, X0, Y0, X6, Y6, Y7) \
+	SUM8(0, X1, Y1, X6, Y6, Y7)  \
+	SUM8(1, X2, Y2, X6, Y6, Y7)  \
+	VPADDW     Y1, Y1, Y3        \
+	VPADDW     Y3, Y1, Y1        \
+	VPADDW     Y1, Y0, Y0        \
+	VPADDW     Y8, Y0, Y0        \
+	VPSRAW     $4, Y0, Y0        \
+	VPADDW     Y1, Y2, Y2        \
+	VPADDW     Y8, Y2, Y2        \
+	VPSRAW     $4, Y2, Y2        \
+	VPUNPCKLWD Y2, Y0, Y1        \
+	VPUNPCKHWD Y2, Y0, Y0        \
+	VPERM2I128 $0x20, Y0, Y1, Y2 \
+	VPERM2I128 $0x31, Y0, Y1, Y0 \
+	VPMOVZXBW  (SI), Y1          \
+	VPSUBW     Y9, Y1, Y1        \
+	VPUNPCKLWD Y2, Y0, Y3        \
+	VPUNPCKHWD Y2, Y0, Y0        \
+	VPUNPCKLWD Y14, Y1, Y4       \
+	VPUNPCKHWD Y14, Y1, Y1       \
+	VPMADDWD   Y13, Y4, Y4       \
+	VPMADDWD   Y13, Y1, Y1       \
+	VPMADDWD   Y12, Y3, Y5       \
+	VPADDD     Y4, Y5, Y5        \
+	VPSRAD     $13, Y5, Y5       \
+	VPMADDWD   Y11, Y3, Y6       \
+	VPADDD     Y4, Y6, Y6        \
+	VPSRAD     $13, Y6, Y6       \
+	VPMADDWD   Y10, Y3, Y3       \
+	VPADDD     Y4, Y3, Y3        \
+	VPSRAD     $13, Y3, Y3       \
+	VPMADDWD   Y12, Y0, Y4       \
+	VPADDD     Y1, Y4, Y4        \
+	VPSRAD     $13, Y4, Y4       \
+	VPMADDWD   Y11, Y0, Y7       \
+	VPADDD     Y1, Y7, Y7        \
+	VPSRAD     $13, Y7, Y7       \
+	VPMADDWD   Y10, Y0, Y0       \
+	VPADDD     Y1, Y0, Y0        \
+	VPSRAD     $13, Y0, Y0       \
+	VPACKSSDW  Y4, Y5, Y5        \
+	VPACKSSDW  Y7, Y6, Y6        \
+	VPACKSSDW  Y0, Y3, Y3
+
+// VINTERLEAVE16: bytes of x, y, z and w interleaved to the dwords of pixels
+// 0-3 and 8-11 in Y2, and of pixels 4-7 and 12-15 in Y0.
+#define VINTERLEAVE16(x, y, z, w) \
+	VPACKUSWB  y, x, x  \
+	VPACKUSWB  w, z, z  \
+	VPUNPCKLBW z, x, Y0 \
+	VPUNPCKHBW z, x, Y1 \
+	VPUNPCKLBW Y1, Y0, Y2 \
+	VPUNPCKHBW Y1, Y0, Y0
+
+// VSTORE32: the dwords of Y2 and Y0 in pixel order to (DI).
+#define VSTORE32 \
+	VPERM2I128 $0x20, Y0, Y2, Y1 \
+	VPERM2I128 $0x31, Y0, Y2, Y0 \
+	VMOVDQU    Y1, (DI)          \
+	VMOVDQU    Y0, 32(DI)
+
+// VSTORE24: the 12 bytes of each lane of y to off(DI) and off+24(DI).
+#define VSTORE24(y, x, off) \
+	VMOVQ        x, off(DI)       \
+	VPEXTRD      $2, x, off+8(DI) \
+	VEXTRACTI128 $1, y, X1        \
+	VMOVQ        X1, off+24(DI)   \
+	VPEXTRD      $2, X1, off+32(DI)
+
+// VNEXT16: advances the pointers by a block of 16 pixels of n bytes.
+#define VNEXT16(n) \
+	ADDQ $n, DI  \
+	ADDQ $16, SI \
+	ADDQ $8, R8  \
+	ADDQ $8, R9  \
+	ADDQ $8, R10 \
+	ADDQ $8, R11 \
+	DECQ CX
+
+TEXT ·yuvRowAVX2(SB), NOSPLIT, $0-72
+	MOVQ dst+0(FP), DI
+	MOVQ y+8(FP), SI
+	MOVQ cb0+16(FP), R8
+	MOVQ cb1+24(FP), R9
+	MOVQ cr0+32(FP), R10
+	MOVQ cr1+40(FP), R11
+	MOVQ blocks+48(FP), CX
+	MOVQ c+56(FP), DX
+
+	VPXOR    Y15, Y15, Y15
+	VPCMPEQW Y14, Y14, Y14
+	VPSRLW   $15, Y14, Y14
+
+	MOVL         4(DX), AX
+	ORL          $0x10000000, AX
+	VMOVQ        AX, X13
+	VPBROADCASTD X13, Y13
+
+	MOVL         8(DX), AX
+	VMOVQ        AX, X12
+	VPBROADCASTD X12, Y12
+
+	MOVL         16(DX), AX
+	NEGL         AX
+	ANDL         $0xffff, AX
+	MOVL         12(DX), BX
+	NEGL         BX
+	SHLL         $16, BX
+	ORL          BX, AX
+	VMOVQ        AX, X11
+	VPBROADCASTD X11, Y11
+
+	MOVL         20(DX), AX
+	SHLL         $16, AX
+	VMOVQ        AX, X10
+	VPBROADCASTD X10, Y10
+
+	MOVL         0(DX), AX
+	VMOVQ        AX, X9
+	VPBROADCASTW X9, Y9
+
+	MOVL         $0xf808, AX
+	VMOVQ        AX, X8
+	VPBROADCASTW X8, Y8
+
+	MOVQ format+64(FP), BX
+	CMPQ BX, $1
+	JEQ  yuv_avx2_bgra
+	CMPQ BX, $2
+	JEQ  yuv_avx2_rgb24
+	CMPQ BX, $3
+	JEQ  yuv_avx2_rgb565
+
+yuv_avx2_rgba:
+	VCONVERT16
+	VPCMPEQW Y7, Y7, Y7
+	VPSRLW   $8, Y7, Y7
+	VINTERLEAVE16(Y5, Y6, Y3, Y7)
+	VSTORE32
+	VNEXT16(64)
+	JNZ      yuv_avx2_rgba
+	VZEROUPPER
+	RET
+
+yuv_avx2_bgra:
+	VCONVERT16
+	VPCMPEQW Y7, Y7, Y7
+	VPSRLW   $8, Y7, Y7
+	VINTERLEAVE16(Y3, Y6, Y5, Y7)
+	VSTORE32
+	VNEXT16(64)
+	JNZ      yuv_avx2_bgra
+	VZEROUPPER
+	RET
+
+yuv_avx2_rgb24:
+	VCONVERT16
+	VMOVDQU   yuvShuffle24<>(SB), Y4
+	VINTERLEAVE16(Y5, Y6, Y3, Y15)
+	VPSHUFB   Y4, Y2, Y2
+	VPSHUFB   Y4, Y0, Y0
+	VSTORE24(Y2, X2, 0)
+	VSTORE24(Y0, X0, 12)
+	VNEXT16(48)
+	JNZ       yuv_avx2_rgb24
+	VZEROUPPER
+	RET
+
+yuv_avx2_rgb565:
+	VCONVERT16
+	VPCMPEQW Y7, Y7, Y7
+	VPSRLW   $8, Y7, Y7
+	VPMAXSW  Y15, Y5, Y5
+	VPMINSW  Y7, Y5, Y5
+	VPMAXSW  Y15, Y6, Y6
+	VPMINSW  Y7, Y6, Y6
+	VPMAXSW  Y15, Y3, Y3
+	VPMINSW  Y7, Y3, Y3
+	VPSRLW   $3, Y5, Y5
+	VPSLLW   $11, Y5, Y5
+	VPSRLW   $2, Y6, Y6
+	VPSLLW   $5, Y6, Y6
+	VPSRLW   $3, Y3, Y3
+	VPOR     Y6, Y5, Y5
+	VPOR     Y3, Y5, Y5
+	VMOVDQU  Y5, (DI)
+	VNEXT16(32)
+	JNZ      yuv_avx2_rgb565
+	VZEROUPPER
+	RET
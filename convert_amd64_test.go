@@ -0,0 +1,20 @@
+//go:build amd64 && !noasm
+
+package mpeg
+
+import "testing"
+
+func TestYuvRowParitySSE2(t *testing.T) {
+	runYuvRowParity(t, func(dst, y, cb0, cb1, cr0, cr1 []byte, width int, c *yuvCoeffs, format PixelFormat) {
+		yuvRowKernel(yuvRowSSE2, 4, dst, y, cb0, cb1, cr0, cr1, width, c, format)
+	})
+}
+
+func TestYuvRowParityAVX2(t *testing.T) {
+	if !isAVX2 {
+		t.Skip("CPU does not support AVX2")
+	}
+	runYuvRowParity(t, func(dst, y, cb0, cb1, cr0, cr1 []byte, width int, c *yuvCoeffs, format PixelFormat) {
+		yuvRowKernel(yuvRowAVX2, 8, dst, y, cb0, cb1, cr0, cr1, width, c, format)
+	})
+}
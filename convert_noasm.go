@@ -0,0 +1,7 @@
+//go:build !amd64 || noasm
+
+package mpeg
+
+func yuvRow(dst, y, cb0, cb1, cr0, cr1 []byte, width int, c *yuvCoeffs, format PixelFormat) {
+	yuvRowGeneric(dst, y, cb0, cb1, cr0, cr1, 0, width, width, c, format)
+}
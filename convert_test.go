@@ -0,0 +1,264 @@
+package mpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"testing"
+)
+
+type yuvRowFunc func(dst, y, cb0, cb1, cr0, cr1 []byte, width int, c *yuvCoeffs, format PixelFormat)
+
+func TestYuvRowParity(t *testing.T) {
+	runYuvRowParity(t, yuvRow)
+}
+
+// TestConverterLevels checks black, white and gray of the limited and full ranges.
+func TestConverterLevels(t *testing.T) {
+	for _, tc := range []struct {
+		colorRange ColorRange
+		y, want    byte
+	}{
+		{RangeLimited, 16, 0},
+		{RangeLimited, 235, 255},
+		{RangeLimited, 126, 128},
+		{RangeFull, 0, 0},
+		{RangeFull, 255, 255},
+		{RangeFull, 128, 128},
+	} {
+		for _, matrix := range []ColorMatrix{BT601, BT709} {
+			c := NewConverter(matrix, tc.colorRange, PixelRGBA)
+			if r, g, b := c.coeffs.rgb(tc.y, 0, 0); r != tc.want || g != tc.want || b != tc.want {
+				t.Errorf("matrix %d, range %d, Y %d: got %d %d %d, want %d", matrix, tc.colorRange, tc.y, r, g, b, tc.want)
+			}
+		}
+	}
+}
+
+// runYuvRowParity compares fn with yuvRowGeneric on random rows of all widths up to 80 and a few wider ones.
+// The rows are as long as the width, and the bytes of dst past the row must be left alone.
+func runYuvRowParity(t *testing.T, fn yuvRowFunc) {
+	r := rand.New(rand.NewPCG(5, 6))
+
+	random := func(n int) []byte {
+		data := make([]byte, n)
+		for i := range data {
+			data[i] = byte(r.Uint32())
+			// Extremes of the chroma values saturate the colors.
+			if r.IntN(4) == 0 {
+				data[i] = []byte{0, 16, 235, 240, 255}[r.IntN(5)]
+			}
+		}
+
+		return data
+	}
+
+	widths := []int{}
+	for width := 1; width <= 80; width++ {
+		widths = append(widths, width)
+	}
+	widths = append(widths, 320, 352, 719, 720)
+
+	for _, matrix := range []ColorMatrix{BT601, BT709} {
+		for _, colorRange := range []ColorRange{RangeLimited, RangeFull} {
+			for _, format := range []PixelFormat{PixelRGBA, PixelBGRA, PixelRGB24, PixelRGB565} {
+				c := NewConverter(matrix, colorRange, format)
+				bpp := format.BytesPerPixel()
+
+				for _, width := range widths {
+					chromaLen := (width + 1) / 2
+					y := random(width)
+					cb0, cb1, cr0, cr1 := random(chromaLen), random(chromaLen), random(chromaLen), random(chromaLen)
+
+					got := bytes.Repeat([]byte{0xa5}, (width+8)*bpp)
+					want := bytes.Clone(got)
+
+					fn(got[:width*bpp], y, cb0, cb1, cr0, cr1, width, &c.coeffs, format)
+					yuvRowGeneric(want[:width*bpp], y, cb0, cb1, cr0, cr1, 0, width, width, &c.coeffs, format)
+
+					if !bytes.Equal(got, want) {
+						for i := range got {
+							if got[i] != want[i] {
+								t.Fatalf("matrix %d, range %d, format %d, width %d: byte %d (pixel %d) is %d, want %d",
+									matrix, colorRange, format, width, i, i/bpp, got[i], want[i])
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkYuvRow(b *testing.B) {
+	c := NewConverter(BT601, RangeLimited, PixelRGBA)
+	y, chroma := make([]byte, 320), make([]byte, 160)
+	dst := make([]byte, 4*320)
+
+	b.SetBytes(int64(len(dst)))
+	for i := 0; i < b.N; i++ {
+		yuvRow(dst, y, chroma, chroma, chroma, chroma, 320, &c.coeffs, c.format)
+	}
+}
+
+func TestConverter(t *testing.T) {
+	data, err := os.ReadFile("testdata/test.mpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mpg, err := New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := mpg.DecodeVideo()
+	if frame == nil {
+		t.Fatal("DecodeVideo: frame is nil")
+	}
+
+	width, height := frame.Width, frame.Height
+	convert := func(matrix ColorMatrix, colorRange ColorRange, format PixelFormat) []byte {
+		dst := make([]byte, width*height*format.BytesPerPixel())
+		if err := NewConverter(matrix, colorRange, format).Convert(dst, 0, frame); err != nil {
+			t.Fatal(err)
+		}
+
+		return dst
+	}
+
+	// The full range BT.601 matrix is the one of image.YCbCr, which upsamples the chroma by repeating it.
+	rgba := convert(BT601, RangeFull, PixelRGBA)
+	var diff, count int
+	for i, v := range frame.RGBA().Pix {
+		d := int(rgba[i]) - int(v)
+		diff += d * d
+		count++
+	}
+	if rms := math.Sqrt(float64(diff) / float64(count)); rms > 4 {
+		t.Errorf("RGBA: RMS difference from image.YCbCr is %.2f", rms)
+	}
+
+	for _, matrix := range []ColorMatrix{BT601, BT709} {
+		for _, colorRange := range []ColorRange{RangeLimited, RangeFull} {
+			rgba := convert(matrix, colorRange, PixelRGBA)
+			bgra := convert(matrix, colorRange, PixelBGRA)
+			rgb24 := convert(matrix, colorRange, PixelRGB24)
+			rgb565 := convert(matrix, colorRange, PixelRGB565)
+
+			for p := 0; p < width*height; p++ {
+				r, g, b, a := rgba[4*p], rgba[4*p+1], rgba[4*p+2], rgba[4*p+3]
+				if a != 0xff || !bytes.Equal(bgra[4*p:4*p+4], []byte{b, g, r, a}) || !bytes.Equal(rgb24[3*p:3*p+3], []byte{r, g, b}) ||
+					binary.LittleEndian.Uint16(rgb565[2*p:]) != uint16(r>>3)<<11|uint16(g>>2)<<5|uint16(b>>3) {
+					t.Fatalf("matrix %d, range %d: formats differ at pixel %d", matrix, colorRange, p)
+				}
+			}
+		}
+	}
+
+	// Rows with padding, which is left alone.
+	stride := width*4 + 12
+	dst := bytes.Repeat([]byte{0xa5}, stride*height)
+	if err := NewConverter(BT601, RangeFull, PixelRGBA).Convert(dst, stride, frame); err != nil {
+		t.Fatal(err)
+	}
+	for row := 0; row < height; row++ {
+		if !bytes.Equal(dst[row*stride:row*stride+width*4], rgba[row*width*4:(row+1)*width*4]) ||
+			!bytes.Equal(dst[row*stride+width*4:(row+1)*stride], bytes.Repeat([]byte{0xa5}, 12)) {
+			t.Fatalf("stride: row %d differs", row)
+		}
+	}
+
+	c := NewConverter(BT601, RangeLimited, PixelRGB565)
+	if err := c.Convert(make([]byte, width*height*2-1), 0, frame); !errors.Is(err, io.ErrShortBuffer) {
+		t.Errorf("Convert: got %v, want %v", err, io.ErrShortBuffer)
+	}
+	if err := c.Convert(make([]byte, width*height*2), width, frame); !errors.Is(err, io.ErrShortBuffer) {
+		t.Errorf("Convert: got %v, want %v for a short stride", err, io.ErrShortBuffer)
+	}
+
+	c = NewConverter(BT601, RangeLimited, PixelFormat(-1))
+	if err := c.Convert(make([]byte, width*height*4), 0, frame); !errors.Is(err, ErrInvalidPixelFormat) {
+		t.Errorf("Convert: got %v, want %v", err, ErrInvalidPixelFormat)
+	}
+}
+
+// TestConverterGolden hashes the conversion of every frame in every format.
+// The output is identical on all backends.
+func TestConverterGolden(t *testing.T) {
+	data, err := os.ReadFile("testdata/test.mpeg1video")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := NewBuffer(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.SetLoadCallback(buf.LoadReaderCallback)
+
+	video := NewVideo(buf)
+
+	var converters []*Converter
+	var sizes []int
+	for _, matrix := range []ColorMatrix{BT601, BT709} {
+		for _, colorRange := range []ColorRange{RangeLimited, RangeFull} {
+			for _, format := range []PixelFormat{PixelRGBA, PixelBGRA, PixelRGB24, PixelRGB565} {
+				converters = append(converters, NewConverter(matrix, colorRange, format))
+				sizes = append(sizes, format.BytesPerPixel())
+			}
+		}
+	}
+
+	h := fnv.New64a()
+	frames := 0
+	dst := make([]byte, video.Width()*video.Height()*4)
+	for {
+		frame := video.Decode()
+		if frame == nil {
+			break
+		}
+		for i, c := range converters {
+			if err := c.Convert(dst, 0, frame); err != nil {
+				t.Fatal(err)
+			}
+			h.Write(dst[:frame.Width*frame.Height*sizes[i]])
+		}
+		frames++
+	}
+
+	const want uint64 = 0x279c3bdf960225dd
+	if got := h.Sum64(); got != want {
+		t.Fatalf("converter output hash: got %#016x want %#016x (frames=%d)", got, want, frames)
+	}
+}
+
+func BenchmarkConvert(b *testing.B) {
+	data, err := os.ReadFile("testdata/test.mpg")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	mpg, err := New(bytes.NewReader(data))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	frame := mpg.DecodeVideo()
+	if frame == nil {
+		b.Fatal("DecodeVideo: frame is nil")
+	}
+
+	c := NewConverter(BT601, RangeLimited, PixelRGBA)
+	dst := make([]byte, frame.Width*frame.Height*4)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c.Convert(dst, 0, frame)
+	}
+}
@@ -1,21 +1,51 @@
 package mpeg
 
 import (
+	"context"
 	"errors"
+	"math"
 	"sort"
 )
 
 // Packet is demuxed MPEG PS packet.
 // The Type maps directly to the various MPEG-PES start codes.
 // Pts is the presentation time stamp of the packet in seconds (not all packets have a pts Value).
+// PtsTicks is the same time stamp in ticks of ClockRate, PacketInvalidTS if there is none.
+// The Pts is unwrapped onto a monotonically increasing timeline, see Discontinuity.
+// Discontinuity is true for the first packet of its type after a splice.
 type Packet struct {
-	Type int
-	Pts  float64
-	Data []byte
+	Type          int
+	Pts           float64
+	PtsTicks      int64
+	Data          []byte
+	Discontinuity bool
+
+	length   int
+	position int
+}
 
-	length int
+// Discontinuity is a jump in the timestamps of the source, detected on a packet of Type at byte Position.
+// Wrap is true when the 33-bit system clock wrapped around (about every 26.5 hours), otherwise the source was spliced.
+// Timestamps of all packets from Position onwards are shifted by Delta seconds, so they continue the
+// timeline of the packets before it. Pts is the shifted timestamp of the packet the jump was detected on.
+// PtsTicks and DeltaTicks are the same values in ticks of ClockRate.
+type Discontinuity struct {
+	Type       int
+	Position   int
+	Pts        float64
+	PtsTicks   int64
+	Delta      float64
+	DeltaTicks int64
+	Wrap       bool
 }
 
+// DiscontinuityFunc callback function.
+type DiscontinuityFunc func(demux *Demux, disc Discontinuity)
+
+// ClockRate is the rate of the MPEG system clock in ticks per second. Timestamps in ticks
+// are exact, while timestamps in seconds are subject to floating point rounding.
+const ClockRate = 90000
+
 // Various packet types.
 const (
 	PacketInvalidTS = -1
@@ -31,11 +61,14 @@ const (
 // ErrInvalidHeader is the error returned when pack and system headers are not found.
 var ErrInvalidHeader = errors.New("invalid MPEG-PS header")
 
+// ErrCorruptPacket is the error reported when the header of a packet is invalid.
+var ErrCorruptPacket = errors.New("corrupt packet")
+
 // Demux an MPEG Program Stream (PS) data into separate packages.
 type Demux struct {
 	buf *Buffer
 
-	sysClockRef    float64
+	sysClockRef    int64
 	lastFileSize   int
 	lastDecodedPts float64
 	startTime      map[int]float64
@@ -55,20 +88,50 @@ type Demux struct {
 
 	currentPacket Packet
 	nextPacket    Packet
+
+	// Timeline state: clocks per type and the discontinuities found so far, sorted by position.
+	clocks                 map[int]*clock
+	discontinuities        []Discontinuity
+	discontinuityThreshold int64
+	discontinuityCallback  DiscontinuityFunc
+	seekWrap               int64
+	timelineChecked        bool
+	timelineRate           float64 // seconds per byte of a source with splices that were not read yet
+
+	index       *Index
+	indexPacket Packet
+
+	// Raw elementary stream source, nil for program streams, see NewElementaryDemux.
+	elementary *elementaryStream
+
+	// Error of the last Decode, and whether the source is an MPEG-2 program stream.
+	err         error
+	unsupported bool
+
+	limits Limits
 }
 
-// NewDemux creates a demuxer with buffer as a source.
-func NewDemux(buf *Buffer) (*Demux, error) {
+// NewDemux creates a demuxer with buffer as a source. Optional limits bound the size of
+// the buffer and of the packets, and the start codes examined by Decode.
+func NewDemux(buf *Buffer, limits ...Limits) (*Demux, error) {
 	dmux := &Demux{}
 
 	dmux.buf = buf
+	dmux.limits = limitsOf(limits)
+	dmux.buf.setLimits(dmux.limits)
 	dmux.startTime = make(map[int]float64)
 	dmux.duration = make(map[int]float64)
 	dmux.firstPts = make(map[int]float64)
 	dmux.lastPts = make(map[int]float64)
+	dmux.clocks = make(map[int]*clock)
+	dmux.discontinuityThreshold = 10 * ClockRate
 	dmux.startCode = -1
 
 	if !dmux.HasHeaders() {
+		if dmux.unsupported {
+			return nil, ErrUnsupportedCodec
+		}
+
 		return nil, ErrInvalidHeader
 	}
 
@@ -87,6 +150,10 @@ func (d *Demux) HasHeaders() bool {
 		return true
 	}
 
+	if d.unsupported {
+		return false
+	}
+
 	// Decode pack header
 	if !d.hasPackHeader {
 		if d.startCode != startPack && d.buf.findStartCode(startPack) == -1 {
@@ -99,7 +166,12 @@ func (d *Demux) HasHeaders() bool {
 		}
 		d.startCode = -1
 
-		if d.buf.read(4) != 0x02 {
+		// MPEG-2 pack headers start with 01 instead of 0010.
+		marker := d.buf.read(4)
+		if marker>>2 == 0x01 {
+			d.unsupported = true
+		}
+		if marker != 0x02 {
 			return false
 		}
 
@@ -139,6 +211,10 @@ func (d *Demux) HasHeaders() bool {
 
 // Probe probes the file for the actual number of video/audio streams.
 func (d *Demux) Probe(probeSize int) bool {
+	if d.elementary != nil {
+		return true
+	}
+
 	prevPos := d.buf.tell()
 
 	videoStream := false
@@ -202,6 +278,63 @@ func (d *Demux) Rewind() {
 	d.currentPacket.length = 0
 	d.nextPacket.length = 0
 	d.startCode = -1
+	d.resetClocks()
+}
+
+// Discontinuities returns the timestamp discontinuities found so far, sorted by position.
+// Wraps of the system clock are corrected on any read, splices are only known once the
+// demuxer has read past them, see FindDiscontinuities.
+func (d *Demux) Discontinuities() []Discontinuity {
+	return d.discontinuities
+}
+
+// FindDiscontinuities reads the whole source to find all of its discontinuities. Until then, Duration
+// estimates the duration of a source with splices that were not read yet, and the first Seek calls this.
+// BuildIndex and SetIndex find them as well. This can only be used when the underlying Buffer is seekable,
+// returns nil otherwise.
+func (d *Demux) FindDiscontinuities() []Discontinuity {
+	return d.findDiscontinuities(context.Background())
+}
+
+// findDiscontinuities is FindDiscontinuities, stopping between packets once ctx is done.
+func (d *Demux) findDiscontinuities(ctx context.Context) []Discontinuity {
+	if !d.hasHeaders || !d.buf.Seekable() || d.elementary != nil {
+		return nil
+	}
+
+	prevPos := d.buf.tell()
+	prevStartCode := d.startCode
+
+	d.Rewind()
+	for ctx.Err() == nil && d.next() != nil {
+	}
+
+	// A canceled scan is done again by the next call.
+	if ctx.Err() == nil {
+		d.timelineScanned()
+	}
+
+	d.bufferSeek(prevPos)
+	d.startCode = prevStartCode
+
+	return d.discontinuities
+}
+
+// SetDiscontinuityCallback sets a callback that is called whenever a new discontinuity is found.
+func (d *Demux) SetDiscontinuityCallback(callback DiscontinuityFunc) {
+	d.discontinuityCallback = callback
+}
+
+// DiscontinuityThreshold returns the largest forward jump in seconds between two timestamps
+// of the same type that is not considered a discontinuity.
+func (d *Demux) DiscontinuityThreshold() float64 {
+	return float64(d.discontinuityThreshold) / ClockRate
+}
+
+// SetDiscontinuityThreshold sets the largest forward jump in seconds between two timestamps
+// of the same type that is not considered a discontinuity. Default 10.
+func (d *Demux) SetDiscontinuityThreshold(threshold float64) {
+	d.discontinuityThreshold = int64(threshold * ClockRate)
 }
 
 // HasEnded checks whether the file has ended. This will be cleared on seeking or rewind.
@@ -213,11 +346,27 @@ func (d *Demux) HasEnded() bool {
 // If forceIntra is true, only packets containing an intra frame will be
 // considered - this only makes sense when the type is video.
 // Note that the specified time is considered 0-based, regardless of the first PTS in the data source.
+// On a source with splices that were not read yet, see Duration, the first seek reads the whole source to find them.
 func (d *Demux) Seek(seekTime float64, typ int, forceIntra bool) *Packet {
+	return d.SeekTicks(secondsToTicks(seekTime), typ, forceIntra)
+}
+
+// SeekTicks seeks, similar to Seek(), to a packet with a PTS at or just before the specified
+// time in ticks of ClockRate. The time is considered 0-based, see StartTicks.
+func (d *Demux) SeekTicks(seekTicks int64, typ int, forceIntra bool) *Packet {
+	return d.seek(context.Background(), seekTicks, typ, forceIntra)
+}
+
+// seek is SeekTicks, stopping between packets once ctx is done and returning nil.
+func (d *Demux) seek(ctx context.Context, seekTicks int64, typ int, forceIntra bool) *Packet {
 	if !d.hasHeaders {
 		return nil
 	}
 
+	if d.elementary != nil {
+		return d.seekElementary(max(seekTicks, 0), typ)
+	}
+
 	// Using the current time, current byte position and the average bytes per
 	// second for this file, try to jump to a byte position that hopefully has
 	// packets containing timestamps within one second before to the desired seekTime.
@@ -234,7 +383,11 @@ func (d *Demux) Seek(seekTime float64, typ int, forceIntra bool) *Packet {
 	// infinite loop. 32 retries should be enough for anybody.
 
 	// Anchor on the raw PTS span, not the corrected StartTime/Duration, so the search is unchanged.
-	d.Duration(typ)
+	d.findDuration(ctx, typ)
+	if d.timelineRate > 0 {
+		d.findDiscontinuities(ctx)
+		d.findDuration(ctx, typ)
+	}
 	startPts := d.firstPts[typ]
 	span := d.lastPts[typ] - startPts
 
@@ -244,18 +397,25 @@ func (d *Demux) Seek(seekTime float64, typ int, forceIntra bool) *Packet {
 	curTime := d.lastDecodedPts
 	scanSpan := float64(1)
 
-	if seekTime > span {
-		seekTime = span
-	} else if seekTime < 0 {
-		seekTime = 0
+	// Compare timestamps in ticks, so a packet exactly at the specified time is found.
+	if spanTicks := secondsToTicks(span); seekTicks > spanTicks {
+		seekTicks = spanTicks
+	} else if seekTicks < 0 {
+		seekTicks = 0
+	}
+	// The index has the exact time of every intra frame, relative to the lowest PTS like the frame times.
+	if forceIntra && d.index != nil && d.index.Type == typ {
+		return d.seekIndex(seekTicks + d.StartTicks(typ))
 	}
-	seekTime += startPts
 
-	for retry := 0; retry < 32; retry++ {
+	seekTicks += secondsToTicks(startPts)
+	seekTime := float64(seekTicks) / ClockRate
+
+	for retry := 0; retry < 32 && ctx.Err() == nil; retry++ {
 		foundPacketWithPts := false
 		foundPacketInRange := false
 		lastValidPacketStart := -1
-		firstPacketTime := float64(PacketInvalidTS)
+		firstPacketTicks := int64(PacketInvalidTS)
 
 		curPos := d.buf.tell()
 
@@ -272,7 +432,7 @@ func (d *Demux) Seek(seekTime float64, typ int, forceIntra bool) *Packet {
 
 		// Scan through all packets up to the seekTime to find the last packet
 		// containing an intra frame.
-		for d.buf.findStartCode(typ) != -1 {
+		for ctx.Err() == nil && d.buf.findStartCode(typ) != -1 {
 			packetStart := d.buf.tell()
 			packet := d.decodePacket(typ)
 
@@ -283,7 +443,7 @@ func (d *Demux) Seek(seekTime float64, typ int, forceIntra bool) *Packet {
 
 			// Bail scanning through packets if we hit one that is outside seekTime - scanSpan.
 			// We also adjust the curTime and byteRate values here so the next iteration can be a bit more precise.
-			if packet.Pts > seekTime || packet.Pts < seekTime-scanSpan {
+			if packet.PtsTicks > seekTicks || packet.PtsTicks < seekTicks-secondsToTicks(scanSpan) {
 				foundPacketWithPts = true
 				byteRate = float64(seekPos-curPos) / (packet.Pts - curTime)
 				curTime = packet.Pts
@@ -298,7 +458,7 @@ func (d *Demux) Seek(seekTime float64, typ int, forceIntra bool) *Packet {
 			// this range again.
 			if !foundPacketInRange {
 				foundPacketInRange = true
-				firstPacketTime = packet.Pts
+				firstPacketTicks = packet.PtsTicks
 			}
 
 			// Check if this is an intra frame packet. If so, record the buffer
@@ -306,19 +466,8 @@ func (d *Demux) Seek(seekTime float64, typ int, forceIntra bool) *Packet {
 			// later, when we know it's the last intra frame before desired
 			// seek time.
 			if forceIntra {
-				for i := 0; i < packet.length-6; i++ {
-					// Find the startPicture code
-					if packet.Data[i] == 0x00 &&
-						packet.Data[i+1] == 0x00 &&
-						packet.Data[i+2] == 0x01 &&
-						packet.Data[i+3] == 0x00 {
-						// Bits 11--13 in the picture header contain the frame type, where 1=Intra
-						if (packet.Data[i+5] & 0x38) == 8 {
-							lastValidPacketStart = packetStart
-						}
-
-						break
-					}
+				if packet.intra() {
+					lastValidPacketStart = packetStart
 				}
 			} else { // If we don't want intra frames, just use the last PTS found.
 				lastValidPacketStart = packetStart
@@ -326,6 +475,8 @@ func (d *Demux) Seek(seekTime float64, typ int, forceIntra bool) *Packet {
 		}
 
 		switch {
+		case ctx.Err() != nil:
+			return nil
 		case lastValidPacketStart != -1:
 			// If there was at least one intra frame in the range scanned above,
 			// our search is over. Jump back to the packet and decode it again.
@@ -336,12 +487,13 @@ func (d *Demux) Seek(seekTime float64, typ int, forceIntra bool) *Packet {
 			// If we hit the right range, but still found no intra frame, we have to increase the scanSpan.
 			// This is done exponentially to also handle video files with very few intra frames.
 			scanSpan *= 2
-			seekTime = firstPacketTime
+			seekTicks = firstPacketTicks
+			seekTime = float64(seekTicks) / ClockRate
 		case !foundPacketWithPts:
 			// If we didn't find any packet with a PTS, it probably means we reached
 			// the end of the file. Estimate byteRate and curTime accordingly.
-			byteRate = float64(seekPos-curPos) / (span - curTime)
-			curTime = span
+			byteRate = float64(seekPos-curPos) / (startPts + span - curTime)
+			curTime = startPts + span
 		}
 	}
 
@@ -352,12 +504,20 @@ func (d *Demux) Seek(seekTime float64, typ int, forceIntra bool) *Packet {
 const reorderWindow = 1.0
 
 // StartTime gets the lowest PTS of all packets of this type.
-// Returns PacketInvalidTS if a packet of this type can not be found.
+// Returns PacketInvalidTS if a packet of this type can not be found. Elementary streams start at 0.
 func (d *Demux) StartTime(typ int) float64 {
 	if t, ok := d.startTime[typ]; ok {
 		return t
 	}
 
+	if d.elementary != nil {
+		if typ != d.elementary.typ {
+			return PacketInvalidTS
+		}
+
+		return 0
+	}
+
 	prevPos := d.buf.tell()
 	prevStartCode := d.startCode
 
@@ -366,7 +526,7 @@ func (d *Demux) StartTime(typ int) float64 {
 
 	d.Rewind()
 	for {
-		packet := d.Decode()
+		packet := d.next()
 		if packet == nil {
 			break
 		}
@@ -399,9 +559,35 @@ func (d *Demux) StartTime(typ int) float64 {
 	return startTime
 }
 
+// StartTicks gets the lowest PTS of all packets of this type in ticks of ClockRate.
+// Returns PacketInvalidTS if a packet of this type can not be found.
+func (d *Demux) StartTicks(typ int) int64 {
+	startTime := d.StartTime(typ)
+	if startTime == PacketInvalidTS {
+		return PacketInvalidTS
+	}
+
+	return secondsToTicks(startTime)
+}
+
 // Duration gets the duration for the specified packet type - the highest PTS
-// minus the lowest PTS, plus the length of the final frame.
+// minus the lowest PTS, plus the length of the final frame. The duration of elementary streams
+// is estimated, see NewElementaryDemux.
+//
+// The first call reads the end of the source, 64 KB and up to 4 MB, and on a seekable source samples
+// the timestamps at 16 positions across it, up to BufferSize bytes each. If they go backwards, the source
+// has splices that were not read yet, and the duration is estimated from the seconds per byte of the samples,
+// until FindDiscontinuities, BuildIndex or SetIndex finds the splices.
 func (d *Demux) Duration(typ int) float64 {
+	return d.findDuration(context.Background(), typ)
+}
+
+// findDuration is Duration, stopping between packets once ctx is done without caching the duration.
+func (d *Demux) findDuration(ctx context.Context, typ int) float64 {
+	if d.elementary != nil {
+		return float64(d.elementaryDuration(typ)) / ClockRate
+	}
+
 	fileSize := d.buf.Size()
 	if t, ok := d.duration[typ]; ok && d.lastFileSize == fileSize {
 		return t
@@ -410,6 +596,16 @@ func (d *Demux) Duration(typ int) float64 {
 	prevPos := d.buf.tell()
 	prevStartCode := d.startCode
 
+	// Splices that were not read yet would make the end of the source look earlier than it is.
+	// The duration is not known if the check for them was canceled.
+	d.checkTimeline(ctx, typ)
+	if ctx.Err() != nil {
+		d.bufferSeek(prevPos)
+		d.startCode = prevStartCode
+
+		return d.duration[typ]
+	}
+
 	// Find the highest PTS. Start searching 64kb from the end and go further back if needed.
 	startRange := 64 * 1024
 	maxRange := 4096 * 1024
@@ -425,7 +621,7 @@ func (d *Demux) Duration(typ int) float64 {
 
 		var ptsList []float64
 		for {
-			packet := d.Decode()
+			packet := d.next()
 			if packet == nil {
 				break
 			}
@@ -441,6 +637,10 @@ func (d *Demux) Duration(typ int) float64 {
 			d.lastPts[typ] = lastPts
 			d.duration[typ] = lastPts - d.StartTime(typ) + frameStep(ptsList)
 
+			if d.timelineRate > 0 {
+				d.duration[typ] = float64(fileSize) * d.timelineRate
+			}
+
 			break
 		}
 	}
@@ -452,6 +652,20 @@ func (d *Demux) Duration(typ int) float64 {
 	return d.duration[typ]
 }
 
+// DurationTicks gets the duration for the specified packet type in ticks of ClockRate, see Duration.
+func (d *Demux) DurationTicks(typ int) int64 {
+	return d.durationTicks(context.Background(), typ)
+}
+
+// durationTicks is DurationTicks, see findDuration.
+func (d *Demux) durationTicks(ctx context.Context, typ int) int64 {
+	if d.elementary != nil {
+		return d.elementaryDuration(typ)
+	}
+
+	return secondsToTicks(d.findDuration(ctx, typ))
+}
+
 // frameStep returns one frame's length: the smallest positive gap between sorted timestamps.
 func frameStep(sorted []float64) float64 {
 	step := float64(PacketInvalidTS)
@@ -469,12 +683,60 @@ func frameStep(sorted []float64) float64 {
 	return step
 }
 
-// Decode decodes and returns the next packet.
+// Err returns the reason the last Decode returned nil: nil at the end of the data, ErrNeedMoreData
+// if the buffer has no complete packet yet, ErrCorruptPacket if the header of a packet is invalid,
+// ErrUnsupportedCodec for MPEG-2 program streams, ErrLimitExceeded if a packet or the call exceeded
+// the limits passed to NewDemux, or the error of the buffer, see Buffer.Err.
+func (d *Demux) Err() error {
+	return d.err
+}
+
+// Decode decodes and returns the next packet. If no packet could be decoded it returns nil, see Err for the reason.
 func (d *Demux) Decode() *Packet {
+	d.err = nil
+
+	packet := d.decode()
+	if packet == nil && d.err == nil {
+		d.err = d.endErr()
+	}
+
+	return packet
+}
+
+// next returns the next packet for scans of the whole stream, which are not bound by the decode steps
+// and skip packets that exceed the limits.
+func (d *Demux) next() *Packet {
+	for {
+		packet := d.Decode()
+		if packet != nil || d.err != ErrLimitExceeded || d.buf.Err() != nil {
+			return packet
+		}
+	}
+}
+
+// endErr returns the reason no packet could be decoded from the data in the buffer.
+func (d *Demux) endErr() error {
+	switch {
+	case d.unsupported:
+		return ErrUnsupportedCodec
+	case d.buf.Err() != nil:
+		return d.buf.Err()
+	case !d.buf.HasEnded():
+		return ErrNeedMoreData
+	}
+
+	return nil
+}
+
+func (d *Demux) decode() *Packet {
 	if !d.HasHeaders() {
 		return nil
 	}
 
+	if d.elementary != nil {
+		return d.decodeElementary()
+	}
+
 	if d.currentPacket.length != 0 {
 		bitsTillNextPacket := d.currentPacket.length << 3
 		if !d.buf.has(bitsTillNextPacket) {
@@ -495,7 +757,14 @@ func (d *Demux) Decode() *Packet {
 		return d.decodePacket(d.startCode)
 	}
 
-	for {
+	for steps := 1; ; steps++ {
+		if !d.limits.steps(steps) {
+			d.startCode = -1
+			d.err = ErrLimitExceeded
+
+			return nil
+		}
+
 		d.startCode = d.buf.nextStartCode()
 		if d.startCode == PacketVideo1 || d.startCode == PacketPrivate ||
 			(d.startCode >= PacketAudio1 && d.startCode <= PacketAudio4) {
@@ -515,9 +784,10 @@ func (d *Demux) bufferSeek(pos int) {
 	d.currentPacket.length = 0
 	d.nextPacket.length = 0
 	d.startCode = -1
+	d.resetClocks()
 }
 
-func (d *Demux) decodeTime() float64 {
+func (d *Demux) decodeTime() int64 {
 	clock := d.buf.read(3) << 30
 	d.buf.skip(1)
 	clock |= d.buf.read(15) << 15
@@ -525,7 +795,7 @@ func (d *Demux) decodeTime() float64 {
 	clock |= d.buf.read(15)
 	d.buf.skip(1)
 
-	return float64(clock) / 90000.0
+	return int64(clock)
 }
 
 func (d *Demux) decodePacket(typ int) *Packet {
@@ -533,9 +803,11 @@ func (d *Demux) decodePacket(typ int) *Packet {
 		return nil
 	}
 
+	pos := d.buf.tell()
 	d.startCode = -1
 
 	d.nextPacket.Type = typ
+	d.nextPacket.position = pos - 4
 	d.nextPacket.length = d.buf.read(16)
 	d.nextPacket.length -= d.buf.skipBytes(0xff) // stuffing
 
@@ -545,28 +817,69 @@ func (d *Demux) decodePacket(typ int) *Packet {
 		d.nextPacket.length -= 2
 	}
 
+	d.nextPacket.Discontinuity = false
+
 	ptsDtsMarker := d.buf.read(2)
 	switch {
 	case ptsDtsMarker == 0x03:
-		d.nextPacket.Pts = d.decodeTime()
-		d.lastDecodedPts = d.nextPacket.Pts
-		d.buf.skip(40) // skip DTS
+		pts := d.decodeTime()
+		d.buf.skip(4)
+		dts := d.decodeTime()
+		d.setTimestamp(typ, pos, pts, dts)
 		d.nextPacket.length -= 10
 	case ptsDtsMarker == 0x02:
-		d.nextPacket.Pts = d.decodeTime()
-		d.lastDecodedPts = d.nextPacket.Pts
+		pts := d.decodeTime()
+		d.setTimestamp(typ, pos, pts, pts)
 		d.nextPacket.length -= 5
 	case ptsDtsMarker == 0x00:
 		d.nextPacket.Pts = PacketInvalidTS
+		d.nextPacket.PtsTicks = PacketInvalidTS
 		d.buf.skip(4)
 		d.nextPacket.length -= 1
 	default:
+		// Resync at the next start code.
+		d.nextPacket.length = 0
+		d.err = ErrCorruptPacket
+
 		return nil // invalid
 	}
 
+	// The length does not cover the header read above.
+	if d.nextPacket.length < 0 {
+		d.nextPacket.length = 0
+		d.err = ErrCorruptPacket
+
+		return nil
+	}
+
+	// Skip the payload with the next Decode.
+	if !d.limits.packet(d.nextPacket.length) {
+		d.currentPacket.length = d.nextPacket.length
+		d.nextPacket.length = 0
+		d.err = ErrLimitExceeded
+
+		return nil
+	}
+
 	return d.packet()
 }
 
+// intra checks whether the first picture that starts in the packet is an intra frame.
+func (p *Packet) intra() bool {
+	for i := 0; i < p.length-6; i++ {
+		// Find the startPicture code
+		if p.Data[i] == 0x00 &&
+			p.Data[i+1] == 0x00 &&
+			p.Data[i+2] == 0x01 &&
+			p.Data[i+3] == 0x00 {
+			// Bits 11--13 in the picture header contain the frame type, where 1=Intra
+			return (p.Data[i+5] & 0x38) == 8
+		}
+	}
+
+	return false
+}
+
 func (d *Demux) packet() *Packet {
 	if !d.buf.has(d.nextPacket.length << 3) {
 		return nil
@@ -576,6 +889,9 @@ func (d *Demux) packet() *Packet {
 	d.currentPacket.Data = d.buf.Bytes()[index : index+d.nextPacket.length : index+d.nextPacket.length]
 	d.currentPacket.Type = d.nextPacket.Type
 	d.currentPacket.Pts = d.nextPacket.Pts
+	d.currentPacket.PtsTicks = d.nextPacket.PtsTicks
+	d.currentPacket.Discontinuity = d.nextPacket.Discontinuity
+	d.currentPacket.position = d.nextPacket.position
 
 	d.currentPacket.length = d.nextPacket.length
 	d.nextPacket.length = 0
@@ -583,6 +899,219 @@ func (d *Demux) packet() *Packet {
 	return &d.currentPacket
 }
 
+// setTimestamp unwraps the raw pts and dts of the next packet onto the timeline.
+// Discontinuities are detected on the decode timestamp, which only increases in a
+// continuous stream, the pts keeps its distance to it.
+func (d *Demux) setTimestamp(typ, pos int, pts, dts int64) {
+	c := d.clocks[typ]
+	if c == nil {
+		c = &clock{}
+		d.clocks[typ] = c
+	}
+
+	offset, splices := d.offsetAt(pos)
+	offset += d.seekWrap
+
+	switch {
+	case !c.valid:
+		// First timestamp since a seek, there is nothing to compare it to. Wraps between
+		// the last known timestamp and here were not seen yet, correct for them.
+		if dts+offset < d.referenceAt(pos)-clockWrap/2 {
+			d.seekWrap += clockWrap
+			offset += clockWrap
+		}
+	case d.continuous(dts + offset - c.last):
+	case offset != c.offset && d.continuous(dts+c.offset-c.last):
+		// A late packet from before a discontinuity that was detected on another type.
+		offset, splices = c.offset, c.splices
+	case dts+offset-c.last < -clockWrap/2:
+		d.addDiscontinuity(Discontinuity{Type: typ, Position: pos, Wrap: true, PtsTicks: dts + offset + clockWrap, DeltaTicks: clockWrap})
+		offset += clockWrap
+	default:
+		delta := c.last + c.step - (dts + offset)
+		d.addDiscontinuity(Discontinuity{Type: typ, Position: pos, PtsTicks: c.last + c.step, DeltaTicks: delta})
+		offset += delta
+		splices += delta
+	}
+
+	t := dts + offset
+	d.nextPacket.Discontinuity = c.valid && splices != c.splices
+	c.update(t, offset, splices)
+
+	// The pts may have wrapped while the dts has not, or the other way around.
+	diff := (pts - dts) & (clockWrap - 1)
+	if diff >= clockWrap/2 {
+		diff -= clockWrap
+	}
+
+	d.nextPacket.PtsTicks = t + diff
+	d.nextPacket.Pts = float64(d.nextPacket.PtsTicks) / ClockRate
+	d.lastDecodedPts = d.nextPacket.Pts
+}
+
+// continuous checks whether a step between two decode timestamps of the same type is within a continuous stream.
+func (d *Demux) continuous(step int64) bool {
+	return step >= -reorderWindow*ClockRate && step <= d.discontinuityThreshold
+}
+
+// offsetAt returns the sum of the deltas of all discontinuities up to pos, and the part of it caused by splices.
+func (d *Demux) offsetAt(pos int) (offset, splices int64) {
+	for _, disc := range d.discontinuities {
+		if disc.Position > pos {
+			break
+		}
+
+		offset += disc.DeltaTicks
+		if !disc.Wrap {
+			splices += disc.DeltaTicks
+		}
+	}
+
+	return offset, splices
+}
+
+// referenceAt returns the last known timestamp before pos, the system clock reference of the first pack if there is none.
+func (d *Demux) referenceAt(pos int) int64 {
+	ref := d.sysClockRef
+	for _, disc := range d.discontinuities {
+		if disc.Position > pos {
+			break
+		}
+
+		ref = disc.PtsTicks
+	}
+
+	return ref
+}
+
+func (d *Demux) addDiscontinuity(disc Discontinuity) {
+	i := sort.Search(len(d.discontinuities), func(i int) bool {
+		return d.discontinuities[i].Position >= disc.Position
+	})
+	if i < len(d.discontinuities) && d.discontinuities[i].Position == disc.Position {
+		return
+	}
+
+	disc.Pts = float64(disc.PtsTicks) / ClockRate
+	disc.Delta = float64(disc.DeltaTicks) / ClockRate
+
+	d.discontinuities = append(d.discontinuities, Discontinuity{})
+	copy(d.discontinuities[i+1:], d.discontinuities[i:])
+	d.discontinuities[i] = disc
+
+	// Everything measured past this point moved.
+	clear(d.duration)
+
+	if d.discontinuityCallback != nil {
+		d.discontinuityCallback(d, disc)
+	}
+}
+
+func (d *Demux) resetClocks() {
+	for _, c := range d.clocks {
+		c.valid = false
+	}
+
+	d.seekWrap = 0
+}
+
+// timelineProbes is the number of positions sampled by checkTimeline.
+const timelineProbes = 16
+
+// checkTimeline samples the timestamps of the type across a seekable source. If they go
+// backwards anywhere, the source contains splices that were not read yet, and the seconds per
+// byte of the samples are kept to estimate the duration. This is only done once.
+func (d *Demux) checkTimeline(ctx context.Context, typ int) {
+	if d.timelineChecked || !d.buf.Seekable() {
+		return
+	}
+	d.timelineChecked = true
+
+	fileSize := d.buf.Size()
+	last, lastPos := float64(PacketInvalidTS), 0
+	seconds, bytes := 0.0, 0
+	spliced := false
+
+	for i := 0; i < timelineProbes && ctx.Err() == nil; i++ {
+		seekPos := fileSize / timelineProbes * i
+		d.bufferSeek(seekPos)
+
+		for d.buf.tell()-seekPos < BufferSize {
+			packet := d.next()
+			if packet == nil {
+				break
+			}
+
+			if packet.Type != typ || packet.Pts == PacketInvalidTS {
+				continue
+			}
+
+			if last != PacketInvalidTS {
+				if packet.Pts < last-reorderWindow {
+					spliced = true
+				} else {
+					seconds += packet.Pts - last
+					bytes += packet.position - lastPos
+				}
+			}
+			last, lastPos = packet.Pts, packet.position
+
+			break
+		}
+	}
+
+	// A canceled check is done again by the next call.
+	if ctx.Err() != nil {
+		d.timelineChecked = false
+
+		return
+	}
+
+	d.timelineRate = 0
+	if spliced && bytes > 0 {
+		d.timelineRate = seconds / float64(bytes)
+	}
+}
+
+// timelineScanned records that all discontinuities are known, the duration is not estimated anymore.
+func (d *Demux) timelineScanned() {
+	if d.timelineRate > 0 {
+		clear(d.duration)
+	}
+
+	d.timelineChecked = true
+	d.timelineRate = 0
+}
+
+// clock tracks the decode timestamps of one packet type, in 90kHz ticks.
+type clock struct {
+	last    int64 // highest timestamp since the last seek
+	step    int64 // smallest increment of last, about one packet
+	offset  int64 // offset applied to the last timestamp
+	splices int64 // part of offset caused by splices
+	valid   bool
+}
+
+func (c *clock) update(t, offset, splices int64) {
+	if c.valid && t > c.last && (c.step == 0 || t-c.last < c.step) {
+		c.step = t - c.last
+	}
+	if !c.valid || t > c.last {
+		c.last = t
+	}
+
+	c.offset = offset
+	c.splices = splices
+	c.valid = true
+}
+
+const clockWrap = int64(1) << 33 // range of the 33-bit system clock
+
+// secondsToTicks converts seconds to the nearest tick of ClockRate.
+func secondsToTicks(seconds float64) int64 {
+	return int64(math.Round(seconds * ClockRate))
+}
+
 const (
 	startPack   = 0xBA
 	startEnd    = 0xB9
@@ -0,0 +1,186 @@
+package mpeg
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+// shiftTimestamps returns a copy of an MPEG-PS stream with every SCR, PTS and DTS
+// moved by ticks, modulo the 33-bit clock.
+func shiftTimestamps(data []byte, ticks int64) []byte {
+	out := append([]byte(nil), data...)
+
+	shift := func(b []byte) {
+		t := int64(b[0]>>1&0x07)<<30 | int64(b[1])<<22 | int64(b[2]>>1)<<15 | int64(b[3])<<7 | int64(b[4]>>1)
+		t = (t + ticks) & (1<<33 - 1)
+		b[0] = b[0]&0xf1 | byte(t>>29)&0x0e
+		b[1] = byte(t >> 22)
+		b[2] = byte(t>>14)&0xfe | 1
+		b[3] = byte(t >> 7)
+		b[4] = byte(t<<1) | 1
+	}
+
+	for i := 0; i+6 < len(out); {
+		if out[i] != 0x00 || out[i+1] != 0x00 || out[i+2] != 0x01 {
+			i++
+			continue
+		}
+
+		code := out[i+3]
+		switch {
+		case code == 0xBA:
+			shift(out[i+4:])
+			i += 12
+		case code == PacketVideo1 || code == PacketPrivate || (code >= PacketAudio1 && code <= PacketAudio4):
+			length := int(out[i+4])<<8 | int(out[i+5])
+			j := i + 6
+			for out[j] == 0xff {
+				j++
+			}
+			if out[j]&0xc0 == 0x40 {
+				j += 2
+			}
+			switch out[j] & 0xf0 {
+			case 0x30:
+				shift(out[j:])
+				shift(out[j+5:])
+			case 0x20:
+				shift(out[j:])
+			}
+			i += 6 + length
+		default:
+			i += 4
+		}
+	}
+
+	return out
+}
+
+// TestDemuxWrap shifts the test stream so the 33-bit clock wraps 5 seconds in.
+func TestDemuxWrap(t *testing.T) {
+	mpg, err := os.ReadFile("testdata/test.mpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const shift = 1<<33 - 5*90000
+	data := shiftTimestamps(mpg, shift)
+
+	d, err := NewDemux(NewBufferBytes(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantStart := 0.810078 + float64(shift)/90000
+	if got := d.StartTime(PacketVideo1); math.Abs(got-wantStart) > 0.001 {
+		t.Errorf("StartTime: got %.6f, want %.6f", got, wantStart)
+	}
+	if got := d.Duration(PacketVideo1); math.Abs(got-9.233333) > 0.001 {
+		t.Errorf("Duration: got %.6f, want %.6f", got, 9.233333)
+	}
+
+	// Reading through the wrap records it and keeps the timestamps increasing.
+	d.Rewind()
+	last := 0.0
+	for {
+		packet := d.Decode()
+		if packet == nil {
+			break
+		}
+		if packet.Type != PacketAudio1 || packet.Pts == PacketInvalidTS {
+			continue
+		}
+		if packet.Pts < last {
+			t.Fatalf("audio PTS went backwards: %.6f after %.6f", packet.Pts, last)
+		}
+		last = packet.Pts
+	}
+
+	discs := d.Discontinuities()
+	if len(discs) != 1 || !discs[0].Wrap {
+		t.Fatalf("Discontinuities: got %+v, want a single wrap", discs)
+	}
+
+	m, err := New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := m.SeekFrame(7*time.Second, true)
+	if frame == nil {
+		t.Fatal("SeekFrame: frame is nil")
+	}
+	if math.Abs(frame.Time-7) > 0.05 {
+		t.Errorf("SeekFrame: got time %.4f, want 7", frame.Time)
+	}
+}
+
+// TestDemuxSplice concatenates the test stream with itself, so the timestamps
+// jump back to the start half way through.
+func TestDemuxSplice(t *testing.T) {
+	mpg, err := os.ReadFile("testdata/test.mpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := append(append([]byte(nil), mpg...), mpg...)
+
+	d, err := NewDemux(NewBufferBytes(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found []Discontinuity
+	d.SetDiscontinuityCallback(func(_ *Demux, disc Discontinuity) {
+		found = append(found, disc)
+	})
+
+	// The splice was not read, the duration is estimated from the bytes per second across the source.
+	if got := d.Duration(PacketVideo1); math.Abs(got-2*9.233333) > 1 {
+		t.Errorf("Duration: got %.6f, want about %.6f", got, 2*9.233333)
+	}
+	if len(found) != 0 {
+		t.Fatalf("Discontinuities: got %+v, want none before the splice is read", found)
+	}
+
+	if discs := d.FindDiscontinuities(); len(discs) != 1 || len(found) != 1 || found[0].Wrap || found[0].Position < len(mpg) {
+		t.Fatalf("FindDiscontinuities: got %+v, want a single splice in the second copy", found)
+	}
+
+	// The splice is placed by decode timestamps, the last frame of this clip is shown without delay.
+	if got := d.Duration(PacketVideo1); math.Abs(got-2*9.233333) > 1.0/30+0.001 {
+		t.Errorf("Duration: got %.6f, want %.6f", got, 2*9.233333)
+	}
+
+	// The second copy starts with video and audio in sync, as the first one does. The
+	// audio of the first copy is longer, so counting samples alone would run ahead.
+	decodeAll := func(data []byte) (video, audio []float64) {
+		m, err := New(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.SetVideoCallback(func(_ *MPEG, f *Frame) { video = append(video, f.Time) })
+		m.SetAudioCallback(func(_ *MPEG, s *Samples) { audio = append(audio, s.Time) })
+		for !m.HasEnded() {
+			m.Decode(100 * time.Millisecond)
+		}
+
+		return video, audio
+	}
+
+	video, audio := decodeAll(mpg)
+	splicedVideo, splicedAudio := decodeAll(data)
+
+	if len(splicedVideo) < 2*len(video) || len(splicedAudio) < 2*len(audio) {
+		t.Fatalf("decoded %d frames and %d samples, want at least %d and %d",
+			len(splicedVideo), len(splicedAudio), 2*len(video), 2*len(audio))
+	}
+
+	// The frames and samples of the second copy start together.
+	v, a := splicedVideo[len(video)], splicedAudio[len(audio)]
+	if math.Abs(v-a-(video[0]-audio[0])) > 1152.0/44100 {
+		t.Errorf("second copy starts with video at %.4f and audio at %.4f", v, a)
+	}
+}
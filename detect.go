@@ -0,0 +1,264 @@
+package mpeg
+
+import (
+	"math"
+	"time"
+)
+
+// DefaultSilenceFloor is a level in dBFS for NewSilenceDetector and Silences, under which audio is silent.
+const DefaultSilenceFloor = -60
+
+// Defaults of the black frame detector, Thumbnails skips frames that are black by blackLuma too.
+const (
+	blackLuma       = 32 // luma of black pixels, a little above the video black level of 16
+	blackPixelRatio = 0.98
+)
+
+// TimeRange is a span of time, from the start up to, not including, the end.
+// Times are in seconds, ticks in ticks of ClockRate.
+type TimeRange struct {
+	Start      float64
+	End        float64
+	StartTicks int64
+	EndTicks   int64
+}
+
+// Duration returns the duration of the range.
+func (r TimeRange) Duration() time.Duration {
+	return time.Duration((r.EndTicks - r.StartTicks) * int64(time.Second) / ClockRate)
+}
+
+func newTimeRange(startTicks, endTicks int64) TimeRange {
+	return TimeRange{
+		Start:      float64(startTicks) / ClockRate,
+		End:        float64(endTicks) / ClockRate,
+		StartTicks: startTicks,
+		EndTicks:   endTicks,
+	}
+}
+
+// span tracks a span of consecutive flagged frames or samples.
+type span struct {
+	minTicks int64
+
+	active     bool
+	startTicks int64
+	endTicks   int64
+}
+
+// write adds a frame from ticks to endTicks and returns the span that ended before it, if it lasted long enough.
+func (s *span) write(flagged bool, ticks, endTicks int64) (TimeRange, bool) {
+	if flagged {
+		if !s.active {
+			s.active = true
+			s.startTicks = ticks
+		}
+		s.endTicks = endTicks
+
+		return TimeRange{}, false
+	}
+
+	return s.end(ticks)
+}
+
+// end ends the span at the ticks.
+func (s *span) end(ticks int64) (TimeRange, bool) {
+	if !s.active {
+		return TimeRange{}, false
+	}
+	s.active = false
+
+	if ticks-s.startTicks < s.minTicks {
+		return TimeRange{}, false
+	}
+
+	return newTimeRange(s.startTicks, ticks), true
+}
+
+// BlackDetector finds spans of black frames, given one after the other in display order.
+// A frame is black if nearly all pixels of its displayed picture have a luma below the threshold.
+type BlackDetector struct {
+	threshold byte
+	span      span
+
+	prevTicks     int64
+	hasPrev       bool
+	frameDuration int64
+}
+
+// NewBlackDetector creates a detector of black spans of at least minDuration, with pixels darker than the
+// luma threshold, or a default threshold of 32 if it is 0.
+func NewBlackDetector(threshold int, minDuration time.Duration) *BlackDetector {
+	if threshold <= 0 {
+		threshold = blackLuma
+	}
+
+	return &BlackDetector{
+		threshold: byte(min(threshold, 255)),
+		span:      span{minTicks: secondsToTicks(minDuration.Seconds())},
+	}
+}
+
+// Write adds the frame and returns the black span that ended with it, if any.
+func (b *BlackDetector) Write(frame *Frame) (TimeRange, bool) {
+	if b.hasPrev && frame.Ticks > b.prevTicks {
+		b.frameDuration = frame.Ticks - b.prevTicks
+	}
+	b.prevTicks, b.hasPrev = frame.Ticks, true
+
+	return b.span.write(isBlack(frame, b.threshold), frame.Ticks, frame.Ticks+b.frameDuration)
+}
+
+// Flush ends the stream and returns the black span that lasted until its end, if any.
+func (b *BlackDetector) Flush() (TimeRange, bool) {
+	return b.span.end(b.span.endTicks)
+}
+
+// isBlack returns true if nearly all pixels of the displayed picture of the frame are darker than the threshold.
+func isBlack(frame *Frame, threshold byte) bool {
+	if frame.Width == 0 || frame.Height == 0 {
+		return false
+	}
+
+	bright := 0
+	maxBright := int(float64(frame.Width*frame.Height) * (1 - blackPixelRatio))
+	for y := 0; y < frame.Height; y++ {
+		for _, v := range frame.Y.Data[y*frame.Y.Width:][:frame.Width] {
+			if v >= threshold {
+				bright++
+			}
+		}
+
+		if bright > maxBright {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SilenceDetector finds spans of silence in decoded samples, given one after the other.
+// Samples are silent if their RMS level, of both channels, is below the floor.
+type SilenceDetector struct {
+	samplerate int
+	floor      float64
+	span       span
+}
+
+// NewSilenceDetector creates a detector of silent spans of at least minDuration, in samples with the samplerate,
+// with a level below the floor in dBFS, e.g. DefaultSilenceFloor.
+func NewSilenceDetector(samplerate int, floor float64, minDuration time.Duration) *SilenceDetector {
+	return &SilenceDetector{
+		samplerate: samplerate,
+		floor:      floor,
+		span:       span{minTicks: secondsToTicks(minDuration.Seconds())},
+	}
+}
+
+// Write adds the samples and returns the silent span that ended with them, if any.
+func (s *SilenceDetector) Write(samples *Samples) (TimeRange, bool) {
+	frames := samples.frames()
+	if frames == 0 || s.samplerate <= 0 {
+		return TimeRange{}, false
+	}
+
+	sum := 0.0
+	for i := 0; i < frames; i++ {
+		l, r := float64(samples.f32(i, 0)), float64(samples.f32(i, 1))
+		sum += l*l + r*r
+	}
+
+	level := math.Inf(-1)
+	if sum > 0 {
+		level = 10 * math.Log10(sum/float64(frames*2))
+	}
+
+	endTicks := samples.Ticks + int64(frames)*ClockRate/int64(s.samplerate)
+
+	return s.span.write(level < s.floor, samples.Ticks, endTicks)
+}
+
+// Flush ends the stream and returns the silent span that lasted until its end, if any.
+func (s *SilenceDetector) Flush() (TimeRange, bool) {
+	return s.span.end(s.span.endTicks)
+}
+
+// BlackFrames decodes the whole video stream and returns the spans of black frames, see NewBlackDetector.
+// The position is rewound before and after.
+func (m *MPEG) BlackFrames(threshold int, minDuration time.Duration) []TimeRange {
+	if !m.initDecoders() || m.videoPacketType == 0 {
+		return nil
+	}
+
+	detector := NewBlackDetector(threshold, minDuration)
+
+	var ranges []TimeRange
+	m.scanVideo(func(frame *Frame) {
+		if r, ok := detector.Write(frame); ok {
+			ranges = append(ranges, r)
+		}
+	})
+	if r, ok := detector.Flush(); ok {
+		ranges = append(ranges, r)
+	}
+
+	return ranges
+}
+
+// Silences decodes the whole audio stream and returns the spans of silence, see NewSilenceDetector.
+// The position is rewound before and after.
+func (m *MPEG) Silences(floor float64, minDuration time.Duration) []TimeRange {
+	if !m.initDecoders() || m.audioPacketType == 0 {
+		return nil
+	}
+
+	detector := NewSilenceDetector(m.Samplerate(), floor, minDuration)
+
+	var ranges []TimeRange
+	m.scanAudio(func(samples *Samples) {
+		if r, ok := detector.Write(samples); ok {
+			ranges = append(ranges, r)
+		}
+	})
+	if r, ok := detector.Flush(); ok {
+		ranges = append(ranges, r)
+	}
+
+	return ranges
+}
+
+// scanVideo decodes the whole video stream, from the start, and calls fn with the frames.
+// The position is rewound afterwards.
+func (m *MPEG) scanVideo(fn func(frame *Frame)) {
+	m.Rewind()
+	defer m.Rewind()
+
+	// Disable writing to the audio buffer while decoding video
+	prevAudioPacketType := m.audioPacketType
+	m.audioPacketType = 0
+	defer func() {
+		m.audioPacketType = prevAudioPacketType
+	}()
+
+	for frame := m.decodeVideo(); frame != nil; frame = m.decodeVideo() {
+		fn(frame)
+	}
+}
+
+// scanAudio decodes the whole audio stream, from the start, and calls fn with the samples.
+// The position is rewound afterwards.
+func (m *MPEG) scanAudio(fn func(samples *Samples)) {
+	m.Rewind()
+	defer m.Rewind()
+
+	// Disable writing to the video buffer while decoding audio
+	prevVideoPacketType := m.videoPacketType
+	m.videoPacketType = 0
+	defer func() {
+		m.videoPacketType = prevVideoPacketType
+	}()
+
+	for samples := m.decodeAudio(); samples != nil; samples = m.decodeAudio() {
+		fn(samples)
+	}
+}
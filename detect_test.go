@@ -0,0 +1,89 @@
+package mpeg_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gen2brain/mpeg"
+)
+
+func TestBlackFrames(t *testing.T) {
+	m, err := mpeg.New(bytes.NewReader(testMpg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ranges := m.BlackFrames(0, 0); len(ranges) != 0 {
+		t.Errorf("BlackFrames: got %+v, want none", ranges)
+	}
+
+	// Black frames in the padding of the planes are still black.
+	frame := func(i int, luma byte) *mpeg.Frame {
+		data := bytes.Repeat([]byte{235}, 160*128)
+		copy(data, bytes.Repeat([]byte{luma}, 160*120))
+
+		return &mpeg.Frame{Ticks: int64(i) * 3000, Width: 160, Height: 120, Y: mpeg.Plane{Width: 160, Height: 128, Data: data}}
+	}
+
+	detector := mpeg.NewBlackDetector(0, 100*time.Millisecond)
+
+	var ranges []mpeg.TimeRange
+	for i := 0; i < 20; i++ {
+		luma := byte(100)
+		switch {
+		case i >= 3 && i < 8, i >= 10 && i < 12, i >= 16:
+			luma = 16
+		}
+
+		if r, ok := detector.Write(frame(i, luma)); ok {
+			ranges = append(ranges, r)
+		}
+	}
+	if r, ok := detector.Flush(); ok {
+		ranges = append(ranges, r)
+	}
+
+	// The span of two frames is too short.
+	want := []mpeg.TimeRange{
+		{Start: 0.1, End: 8 * 3000.0 / mpeg.ClockRate, StartTicks: 3 * 3000, EndTicks: 8 * 3000},
+		{Start: 16 * 3000.0 / mpeg.ClockRate, End: 20 * 3000.0 / mpeg.ClockRate, StartTicks: 16 * 3000, EndTicks: 20 * 3000},
+	}
+	if !reflect.DeepEqual(ranges, want) {
+		t.Errorf("Write: got %+v, want %+v", ranges, want)
+	}
+	if d := want[0].Duration(); d != 5*time.Second/30 {
+		t.Errorf("Duration: got %v", d)
+	}
+}
+
+func TestSilences(t *testing.T) {
+	m, err := mpeg.New(bytes.NewReader(testMp2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ranges := m.Silences(-40, 50*time.Millisecond)
+	if len(ranges) != 2 || ranges[0].StartTicks != 4702 || ranges[0].EndTicks != 11755 || ranges[1].StartTicks != 284473 {
+		t.Errorf("Silences: got %+v", ranges)
+	}
+	if ranges := m.Silences(mpeg.DefaultSilenceFloor, 0); len(ranges) != 0 {
+		t.Errorf("Silences: got %+v, want none below -60 dBFS", ranges)
+	}
+
+	// All of the audio is below full scale.
+	if ranges := m.Silences(0, 0); len(ranges) != 1 || ranges[0].StartTicks != 0 {
+		t.Errorf("Silences: got %+v, want all below 0 dBFS", ranges)
+	}
+
+	// Digital silence until the end.
+	detector := mpeg.NewSilenceDetector(44100, mpeg.DefaultSilenceFloor, time.Second)
+	for i := int64(0); i < 50; i++ {
+		if r, ok := detector.Write(&mpeg.Samples{Ticks: i * 2351, Interleaved: make([]float32, mpeg.SamplesPerFrame*2)}); ok {
+			t.Errorf("Write: got %+v before the end", r)
+		}
+	}
+	if r, ok := detector.Flush(); !ok || r.StartTicks != 0 || r.EndTicks != 49*2351+2351 {
+		t.Errorf("Flush: got %+v, %v", r, ok)
+	}
+}
@@ -0,0 +1,296 @@
+package mpeg
+
+import (
+	"sort"
+)
+
+// elementaryPacketSize is the size of the packets the data of an elementary stream is split into.
+const elementaryPacketSize = 4096
+
+// elementaryProbeSize is how much of a video elementary stream is read to estimate its duration.
+const elementaryProbeSize = 1024 * 1024
+
+// elementaryStream is a raw MPEG-1 video or MP2 audio stream, without a program stream around it.
+type elementaryStream struct {
+	typ int
+
+	// Video, from the first sequence header.
+	frameRateNum int
+	frameRateDen int
+
+	// Audio, from the first frame header, bitrate in bits per second.
+	bitrate    int
+	samplerate int
+
+	// Groups of pictures, found by reading the whole stream.
+	gops     []elementaryGOP
+	pictures int
+	scanned  bool
+}
+
+// elementaryGOP is a group of pictures at byte position, including the sequence header before it.
+// Picture is the number of pictures before the group, which is also the display number of its first picture.
+// Intra is the display number of the intra frame the group starts with, after leading B-frames of an open group.
+type elementaryGOP struct {
+	position int
+	picture  int
+	intra    int
+}
+
+// NewElementaryDemux creates a demuxer with a raw elementary stream of the specified type as a source,
+// PacketVideo1 for MPEG-1 video (.m1v) or PacketAudio1 for MP2 audio (.mp2).
+// The data is split into packets without a PTS, except for the packet returned by Seek.
+// Times are 0-based and the duration is estimated, see Duration. Seeking requires a seekable Buffer,
+// video is seeked by groups of pictures, which are found by reading the whole stream once.
+// Optional limits are applied as with NewDemux, packets are split to fit MaxPacketSize.
+func NewElementaryDemux(buf *Buffer, typ int, limits ...Limits) (*Demux, error) {
+	dmux := &Demux{}
+
+	dmux.buf = buf
+	dmux.limits = limitsOf(limits)
+	dmux.buf.setLimits(dmux.limits)
+	dmux.startTime = make(map[int]float64)
+	dmux.duration = make(map[int]float64)
+	dmux.firstPts = make(map[int]float64)
+	dmux.lastPts = make(map[int]float64)
+	dmux.clocks = make(map[int]*clock)
+	dmux.discontinuityThreshold = 10 * ClockRate
+	dmux.startCode = -1
+
+	es := &elementaryStream{typ: typ}
+
+	if !buf.has(8 << 3) {
+		return nil, ErrInvalidHeader
+	}
+	data := buf.Bytes()[buf.Index():]
+
+	switch typ {
+	case PacketVideo1:
+		if data[0] != 0x00 || data[1] != 0x00 || data[2] != 0x01 || data[3] != startSequence {
+			return nil, ErrInvalidHeader
+		}
+
+		rate := data[7] & 0x0F
+		es.frameRateNum, es.frameRateDen = videoPictureRateNum[rate], videoPictureRateDen[rate]
+		dmux.numVideoStreams = 1
+	case PacketAudio1:
+		if data[0] != 0xFF || data[1]&0xFE != 0xFC {
+			return nil, ErrInvalidHeader
+		}
+
+		bitrateIndex := int(data[2]>>4) - 1
+		samplerateIndex := int(data[2]>>2) & 0x03
+		if bitrateIndex < 0 || bitrateIndex > 13 || samplerateIndex == 3 {
+			return nil, ErrInvalidHeader
+		}
+
+		es.bitrate = int(bitrate[bitrateIndex]) * 1000
+		es.samplerate = int(samplerate[samplerateIndex])
+		dmux.numAudioStreams = 1
+	default:
+		return nil, ErrInvalidHeader
+	}
+
+	dmux.elementary = es
+	dmux.hasHeaders = true
+
+	return dmux, nil
+}
+
+// decodeElementary returns the next packet of the elementary stream.
+func (d *Demux) decodeElementary() *Packet {
+	if d.currentPacket.length != 0 {
+		d.buf.skip(d.currentPacket.length << 3)
+		d.currentPacket.length = 0
+	}
+
+	size := elementaryPacketSize
+	if d.limits.MaxPacketSize > 0 {
+		size = min(size, d.limits.MaxPacketSize)
+	}
+
+	d.buf.has(size << 3)
+
+	length := min(size, d.buf.Remaining())
+	if length <= 0 {
+		return nil
+	}
+
+	index := d.buf.Index()
+	d.currentPacket.Data = d.buf.Bytes()[index : index+length : index+length]
+	d.currentPacket.Type = d.elementary.typ
+	d.currentPacket.Pts = PacketInvalidTS
+	d.currentPacket.PtsTicks = PacketInvalidTS
+	d.currentPacket.Discontinuity = false
+	d.currentPacket.position = d.buf.tell()
+	d.currentPacket.length = length
+
+	return &d.currentPacket
+}
+
+// elementaryDuration returns the duration of the elementary stream in ticks of ClockRate.
+// Audio is expected to have a constant bitrate. For video, the pictures are counted in the first
+// elementaryProbeSize bytes, the duration is exact once the whole stream was read.
+func (d *Demux) elementaryDuration(typ int) int64 {
+	es := d.elementary
+	if typ != es.typ {
+		return 0
+	}
+
+	fileSize := d.buf.Size()
+
+	if typ != PacketVideo1 {
+		if es.bitrate == 0 {
+			return 0
+		}
+
+		return int64(fileSize) * 8 * ClockRate / int64(es.bitrate)
+	}
+
+	if es.frameRateNum == 0 {
+		return 0
+	}
+
+	if es.scanned {
+		return es.pictureTicks(es.pictures)
+	}
+
+	if !d.buf.Seekable() {
+		return 0
+	}
+
+	pictures, n := d.scanElementary(elementaryProbeSize)
+	if es.scanned || n == 0 {
+		return es.pictureTicks(pictures)
+	}
+
+	return es.pictureTicks(pictures) * int64(fileSize) / int64(n)
+}
+
+// pictureTicks returns the time of the picture with the display number in ticks of ClockRate.
+func (es *elementaryStream) pictureTicks(picture int) int64 {
+	return int64(picture) * ClockRate * int64(es.frameRateDen) / int64(es.frameRateNum)
+}
+
+// scanElementary reads the video elementary stream from the start, up to limit bytes, and returns the
+// number of pictures and bytes read. If the whole stream was read, its groups of pictures are stored.
+func (d *Demux) scanElementary(limit int) (pictures, n int) {
+	es := d.elementary
+
+	prevPos := d.buf.tell()
+	d.bufferSeek(0)
+
+	var gops []elementaryGOP
+	header := -1
+	first := false
+
+	for {
+		code := d.buf.nextStartCode()
+		if code == -1 {
+			es.gops = gops
+			es.pictures = pictures
+			es.scanned = true
+			n = d.buf.Size()
+
+			break
+		}
+
+		pos := d.buf.tell() - 4
+		if pos > limit {
+			n = pos
+
+			break
+		}
+
+		switch code {
+		case startSequence:
+			header = pos
+		case startGOP:
+			if header < 0 {
+				header = pos
+			}
+			gops = append(gops, elementaryGOP{position: header, picture: pictures, intra: pictures})
+			header = -1
+			first = true
+		case startPicture:
+			if first && d.buf.has(10) {
+				gops[len(gops)-1].intra += d.buf.read(10) // temporal reference
+			}
+			pictures++
+			header = -1
+			first = false
+		}
+	}
+
+	d.bufferSeek(prevPos)
+
+	return pictures, n
+}
+
+// seekElementary seeks to the packet at the group of pictures with the intra frame (video), or the frame (audio),
+// at or just before the seekTicks. The returned packet starts there and has the time of the intra frame, or the frame, as the PTS.
+func (d *Demux) seekElementary(seekTicks int64, typ int) *Packet {
+	es := d.elementary
+	if typ != es.typ || !d.buf.Seekable() {
+		return nil
+	}
+
+	var ticks int64
+
+	if typ == PacketVideo1 {
+		if es.frameRateNum == 0 {
+			return nil
+		}
+
+		if !es.scanned {
+			d.scanElementary(d.buf.Size())
+		}
+
+		gops := es.gops
+		if len(gops) == 0 {
+			return nil
+		}
+
+		i := sort.Search(len(gops), func(i int) bool {
+			return es.pictureTicks(gops[i].intra) > seekTicks
+		})
+		if i > 0 {
+			i--
+		}
+
+		d.bufferSeek(gops[i].position)
+		ticks = es.pictureTicks(gops[i].intra)
+	} else {
+		if es.bitrate == 0 {
+			return nil
+		}
+
+		// Frames have a constant size on average, padding aside. Jump close to the frame and find its
+		// sync word. The frameSize is the size of a frame in bytes times the samplerate, to stay exact.
+		frameSize := int64(SamplesPerFrame) * int64(es.bitrate) / 8
+		frame := seekTicks * int64(es.samplerate) / (SamplesPerFrame * ClockRate)
+
+		d.bufferSeek(int(frame * frameSize / int64(es.samplerate)))
+		if !d.buf.has(elementaryPacketSize<<3) && d.buf.Remaining() < 4 {
+			return nil
+		}
+		if !d.buf.findFrameSync() {
+			return nil
+		}
+		d.buf.bitIndex -= 11
+
+		pos := d.buf.tell()
+		frame = (int64(pos)*int64(es.samplerate) + frameSize - 1) / frameSize
+		ticks = frame * SamplesPerFrame * ClockRate / int64(es.samplerate)
+	}
+
+	packet := d.decodeElementary()
+	if packet == nil {
+		return nil
+	}
+
+	packet.PtsTicks = ticks
+	packet.Pts = float64(ticks) / ClockRate
+
+	return packet
+}
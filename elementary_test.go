@@ -0,0 +1,139 @@
+package mpeg_test
+
+import (
+	"bytes"
+	"errors"
+	"hash/fnv"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gen2brain/mpeg"
+)
+
+func TestElementary(t *testing.T) {
+	if _, err := mpeg.New(bytes.NewReader(testMpg[4:])); !errors.Is(err, mpeg.ErrInvalidMPEG) {
+		t.Errorf("New: got error %v, want %v", err, mpeg.ErrInvalidMPEG)
+	}
+
+	m, err := mpeg.New(bytes.NewReader(testMpeg1video))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.NumVideoStreams() != 1 || m.NumAudioStreams() != 0 {
+		t.Errorf("NumVideoStreams, NumAudioStreams: got %d, %d, want 1, 0", m.NumVideoStreams(), m.NumAudioStreams())
+	}
+
+	// The whole stream fits in the probe, the duration is exact: 277 pictures at 30 fps.
+	if m.DurationTicks() != 277*3000 {
+		t.Errorf("DurationTicks: got %d, want %d", m.DurationTicks(), 277*3000)
+	}
+
+	if frame := m.DecodeVideo(); frame == nil || frame.Width != 160 || frame.Height != 120 {
+		t.Errorf("DecodeVideo: got %+v, want a 160x120 frame", frame)
+	}
+
+	// Extract the video of the program stream, which decodes the same way with and without seeking.
+	var video []byte
+	d := newDemux(t, testMpg)
+	for packet := d.Decode(); packet != nil; packet = d.Decode() {
+		if packet.Type == mpeg.PacketVideo1 {
+			video = append(video, packet.Data...)
+		}
+	}
+
+	seq, err := mpeg.New(bytes.NewReader(video))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ticks []int64
+	var hashes []uint64
+	for frame := seq.DecodeVideo(); frame != nil; frame = seq.DecodeVideo() {
+		h := fnv.New64a()
+		h.Write(frame.Y.Data)
+		ticks = append(ticks, frame.Ticks)
+		hashes = append(hashes, h.Sum64())
+	}
+
+	m, err = mpeg.New(bytes.NewReader(video))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first group starts with two B-frames predicted from before the stream, seeks before its intra frame find it.
+	for _, seekExact := range []bool{false, true} {
+		i := slices.Index(ticks, 6000)
+		frame := m.SeekFrame(0, seekExact)
+		if frame == nil || frame.Ticks != ticks[i] {
+			t.Fatalf("SeekFrame(0, %v): got %+v, want %d ticks", seekExact, frame, ticks[i])
+		}
+		h := fnv.New64a()
+		h.Write(frame.Y.Data)
+		if h.Sum64() != hashes[i] {
+			t.Errorf("SeekFrame(0, %v): frame at %d ticks differs from sequential decoding", seekExact, ticks[i])
+		}
+	}
+
+	for ms := 350; ms < 9000; ms += 350 {
+		tm := time.Duration(ms) * time.Millisecond
+		target := int64(ms) * mpeg.ClockRate / 1000
+
+		frame := m.SeekFrame(tm, false)
+		if frame == nil || frame.Ticks > target || !slices.Contains(ticks, frame.Ticks) {
+			t.Fatalf("SeekFrame(%v, false): got %+v, want a frame before %d", tm, frame, target)
+		}
+
+		frame = m.SeekFrame(tm, true)
+		i, _ := slices.BinarySearch(ticks, target)
+		if frame == nil || frame.Ticks != ticks[i] {
+			t.Fatalf("SeekFrame(%v, true): got %+v, want %d ticks", tm, frame, ticks[i])
+		}
+		h := fnv.New64a()
+		h.Write(frame.Y.Data)
+		if h.Sum64() != hashes[i] {
+			t.Errorf("SeekFrame(%v, true): frame at %d ticks differs from sequential decoding", tm, ticks[i])
+		}
+	}
+
+	m, err = mpeg.New(bytes.NewReader(testMp2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.NumVideoStreams() != 0 || m.NumAudioStreams() != 1 {
+		t.Errorf("NumVideoStreams, NumAudioStreams: got %d, %d, want 0, 1", m.NumVideoStreams(), m.NumAudioStreams())
+	}
+
+	if m.Samplerate() != 44100 {
+		t.Errorf("Samplerate: got %d, want %d", m.Samplerate(), 44100)
+	}
+
+	frames := 0
+	for samples := m.DecodeAudio(); samples != nil; samples = m.DecodeAudio() {
+		frames++
+	}
+
+	duration := float64(frames*mpeg.SamplesPerFrame) / 44100
+	if math.Abs(m.Duration().Seconds()-duration) > float64(mpeg.SamplesPerFrame)/44100 {
+		t.Errorf("Duration: got %v, want %v", m.Duration().Seconds(), duration)
+	}
+
+	buf, err := mpeg.NewBuffer(bytes.NewReader(testMp2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.SetLoadCallback(buf.LoadReaderCallback)
+
+	d, err = mpeg.NewElementaryDemux(buf, mpeg.PacketAudio1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packet := d.Seek(5, mpeg.PacketAudio1, false)
+	if packet == nil || packet.Data[0] != 0xFF || math.Abs(packet.Pts-5) > float64(mpeg.SamplesPerFrame)/44100 {
+		t.Errorf("Seek: got %+v, want a frame at 5s", packet)
+	}
+}
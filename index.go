@@ -0,0 +1,440 @@
+package mpeg
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+)
+
+// ErrInvalidIndex is the error returned when an index can not be read or does not belong to the source.
+var ErrInvalidIndex = errors.New("invalid MPEG-PS index")
+
+// indexMagic and indexVersion identify the serialized index.
+const (
+	indexMagic   = "MPGI"
+	indexVersion = 1
+)
+
+// IndexEntry is an intra frame of the indexed stream.
+// Position is the byte offset of the packet the frame starts in, and Offset the offset of the frame in
+// the packet data, including the sequence and GOP headers before it. PtsTicks is the PTS of the frame in
+// ticks of ClockRate, and GOP the number of the group of pictures the frame belongs to.
+// GOPPtsTicks is the PTS of the first frame of the group in display order. It is lower than PtsTicks
+// if the group starts with B-frames, which follow the intra frame in the stream.
+type IndexEntry struct {
+	Position    int
+	Offset      int
+	PtsTicks    int64
+	GOP         int
+	GOPPtsTicks int64
+}
+
+// Index lists the intra frames of a stream of the source, sorted by position, with the discontinuities
+// of the timestamps found while building it. Size is the size of the indexed source.
+// With an index, Demux.Seek and MPEG.SeekFrame jump directly to the intra frame just before the desired time.
+// The packet returned by Demux.Seek starts with the frame, its PTS is the time of the first frame decoded
+// from it in display order, see IndexEntry.
+type Index struct {
+	Type            int
+	Size            int
+	Entries         []IndexEntry
+	Discontinuities []Discontinuity
+}
+
+// BuildIndex reads the whole source and builds an index of the intra frames of the specified type,
+// which is used for seeking from then on. This can only be used when the underlying Buffer is seekable.
+// Returns nil if the source is not seekable or no intra frame could be found. Elementary streams
+// have no timestamps to index, they are seeked by groups of pictures, see NewElementaryDemux.
+func (d *Demux) BuildIndex(typ int) *Index {
+	if !d.hasHeaders || !d.buf.Seekable() || d.elementary != nil {
+		return nil
+	}
+
+	prevPos := d.buf.tell()
+	prevStartCode := d.startCode
+
+	index := &Index{Type: typ, Size: d.buf.Size()}
+	b := newIndexBuilder()
+
+	d.Rewind()
+	for {
+		packet := d.next()
+		if packet == nil {
+			break
+		}
+
+		if packet.Type == typ {
+			b.write(packet.position, packet.PtsTicks, packet.Data)
+		}
+	}
+
+	d.timelineScanned()
+	index.Entries = b.entries
+	index.Discontinuities = append([]Discontinuity(nil), d.discontinuities...)
+
+	d.bufferSeek(prevPos)
+	d.startCode = prevStartCode
+
+	if len(index.Entries) == 0 {
+		return nil
+	}
+
+	d.index = index
+
+	return index
+}
+
+// indexLookahead is the number of bytes after a start code that are read with it, the sequence header
+// has the frame rate in its fourth byte.
+const indexLookahead = 8
+
+// indexSpan is the part of the scanned bytes that came from one packet.
+type indexSpan struct {
+	start    int // index of the first byte in the scanned bytes
+	position int // position of the packet
+	offset   int // offset of the first byte in the packet data
+	ptsTicks int64
+	first    bool // no picture started in the packet before
+}
+
+// indexBuilder finds the intra frames in the packets of a stream, for BuildIndex.
+// Start codes may span packets, so the last bytes of a packet are scanned again with the next one.
+// A start code belongs to the packet its first byte is in.
+type indexBuilder struct {
+	entries []IndexEntry
+
+	scan  []byte
+	spans []indexSpan
+
+	// The sequence or GOP header before the next picture, the index starts there.
+	headerPosition, headerOffset int
+
+	// The PTS of a packet belongs to the first picture that starts in it. Intra frames without one
+	// get it from another picture of their group, by the temporal reference and the frame rate.
+	pending  []IndexEntry
+	temporal []int
+	gop      int
+	num, den int
+	base     int64
+	hasBase  bool
+}
+
+func newIndexBuilder() *indexBuilder {
+	return &indexBuilder{headerOffset: -1, gop: -1, den: 1}
+}
+
+// ticks returns the time of a temporal reference from the start of its group.
+func (b *indexBuilder) ticks(temporalReference int) int64 {
+	return int64(temporalReference) * ClockRate * int64(b.den) / int64(b.num)
+}
+
+// write scans the data of a packet.
+func (b *indexBuilder) write(position int, ptsTicks int64, data []byte) {
+	b.spans = append(b.spans, indexSpan{start: len(b.scan), position: position, ptsTicks: ptsTicks, first: true})
+	b.scan = append(b.scan, data...)
+
+	s := 0
+	for i := 0; i+indexLookahead < len(b.scan); i++ {
+		for s+1 < len(b.spans) && b.spans[s+1].start <= i {
+			s++
+		}
+
+		if b.scan[i] != 0x00 || b.scan[i+1] != 0x00 || b.scan[i+2] != 0x01 {
+			continue
+		}
+
+		span := &b.spans[s]
+		offset := span.offset + i - span.start
+
+		switch b.scan[i+3] {
+		case startSequence:
+			rate := b.scan[i+7] & 0x0F
+			b.num, b.den = videoPictureRateNum[rate], videoPictureRateDen[rate]
+			if b.headerOffset < 0 {
+				b.headerPosition, b.headerOffset = span.position, offset
+			}
+		case startGOP:
+			b.gop++
+			b.hasBase = false
+			b.pending, b.temporal = b.pending[:0], b.temporal[:0]
+			if b.headerOffset < 0 {
+				b.headerPosition, b.headerOffset = span.position, offset
+			}
+		case startPicture:
+			b.picture(span, offset, int(b.scan[i+4])<<2|int(b.scan[i+5])>>6, int(b.scan[i+5]>>3)&0x07)
+		}
+	}
+
+	// Keep the bytes that were not scanned, with the spans they came from.
+	from := max(len(b.scan)-indexLookahead, 0)
+	for len(b.spans) > 1 && b.spans[1].start <= from {
+		b.spans = b.spans[1:]
+	}
+	for j := range b.spans {
+		if span := &b.spans[j]; span.start < from {
+			span.offset += from - span.start
+			span.start = 0
+		} else {
+			span.start -= from
+		}
+	}
+	b.scan = append(b.scan[:0], b.scan[from:]...)
+}
+
+// picture adds the entry of an intra frame, or sets the base of the group from the PTS of another picture.
+func (b *indexBuilder) picture(span *indexSpan, offset, temporalReference, pictureType int) {
+	hasPts := span.first && span.ptsTicks != PacketInvalidTS
+	span.first = false
+
+	entry := IndexEntry{Position: span.position, Offset: offset, PtsTicks: span.ptsTicks, GOP: max(b.gop, 0), GOPPtsTicks: span.ptsTicks}
+	if b.headerOffset >= 0 {
+		entry.Position, entry.Offset = b.headerPosition, b.headerOffset
+	}
+	b.headerOffset = -1
+
+	if hasPts && !b.hasBase && b.num != 0 {
+		b.base = span.ptsTicks - b.ticks(temporalReference)
+		b.hasBase = true
+
+		for j, e := range b.pending {
+			e.PtsTicks = b.base + b.ticks(b.temporal[j])
+			e.GOPPtsTicks = b.base
+			b.entries = append(b.entries, e)
+		}
+		b.pending, b.temporal = b.pending[:0], b.temporal[:0]
+	}
+
+	if pictureType != pictureTypeIntra {
+		return
+	}
+
+	switch {
+	case hasPts:
+		if b.hasBase {
+			entry.GOPPtsTicks = b.base
+		}
+		b.entries = append(b.entries, entry)
+	case b.hasBase:
+		entry.PtsTicks = b.base + b.ticks(temporalReference)
+		entry.GOPPtsTicks = b.base
+		b.entries = append(b.entries, entry)
+	default:
+		b.pending = append(b.pending, entry)
+		b.temporal = append(b.temporal, temporalReference)
+	}
+}
+
+// Index returns the index used for seeking, nil if there is none.
+func (d *Demux) Index() *Index {
+	return d.index
+}
+
+// SetIndex sets the index used for seeking, e.g. one read from a sidecar file with ReadIndex.
+// Returns ErrInvalidIndex if the index was built for a source of a different size, has no entries,
+// or its entries are not sorted or lie outside of the source.
+func (d *Demux) SetIndex(index *Index) error {
+	if index == nil {
+		d.index = nil
+
+		return nil
+	}
+
+	if index.Size != d.buf.Size() || !index.valid() {
+		return ErrInvalidIndex
+	}
+
+	for _, disc := range index.Discontinuities {
+		d.addDiscontinuity(disc)
+	}
+	d.timelineScanned()
+	d.index = index
+
+	return nil
+}
+
+// valid reports whether the index has entries, sorted by position and PTS, that lie within the source.
+func (index *Index) valid() bool {
+	if len(index.Entries) == 0 {
+		return false
+	}
+
+	for i, e := range index.Entries {
+		if e.Position < 0 || e.Position >= index.Size || e.Offset < 0 {
+			return false
+		}
+
+		if i > 0 && (e.Position < index.Entries[i-1].Position || e.PtsTicks < index.Entries[i-1].PtsTicks) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// seekIndex seeks to the last indexed intra frame at or before the seekTicks, on the timeline of the source.
+// The returned packet starts with the frame and has its PTS.
+func (d *Demux) seekIndex(seekTicks int64) *Packet {
+	entries := d.index.Entries
+
+	i := sort.Search(len(entries), func(i int) bool {
+		return entries[i].PtsTicks > seekTicks
+	})
+	if i > 0 {
+		i--
+	}
+	entry := entries[i]
+
+	d.bufferSeek(entry.Position)
+	if d.buf.findStartCode(d.index.Type) == -1 {
+		return nil
+	}
+
+	packet := d.decodePacket(d.index.Type)
+	if packet == nil || entry.Offset >= len(packet.Data) {
+		return nil
+	}
+
+	// The current packet is left as is, so decoding continues after it.
+	d.indexPacket = *packet
+	d.indexPacket.Data = packet.Data[entry.Offset:]
+	d.indexPacket.length = len(d.indexPacket.Data)
+	d.indexPacket.PtsTicks = entry.PtsTicks
+	d.indexPacket.Pts = float64(entry.PtsTicks) / ClockRate
+
+	return &d.indexPacket
+}
+
+// WriteTo writes the index to w in a compact binary format, e.g. to store it as a sidecar file.
+func (index *Index) WriteTo(w io.Writer) (int64, error) {
+	buf := append([]byte(indexMagic), indexVersion)
+	buf = binary.AppendUvarint(buf, uint64(index.Type))
+	buf = binary.AppendUvarint(buf, uint64(index.Size))
+
+	// Entries are sorted, store the differences to the previous one.
+	buf = binary.AppendUvarint(buf, uint64(len(index.Entries)))
+	var prev IndexEntry
+	for _, e := range index.Entries {
+		buf = binary.AppendUvarint(buf, uint64(e.Position-prev.Position))
+		buf = binary.AppendUvarint(buf, uint64(e.Offset))
+		buf = binary.AppendVarint(buf, e.PtsTicks-prev.PtsTicks)
+		buf = binary.AppendUvarint(buf, uint64(e.GOP-prev.GOP))
+		buf = binary.AppendVarint(buf, e.PtsTicks-e.GOPPtsTicks)
+		prev = e
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(index.Discontinuities)))
+	for _, disc := range index.Discontinuities {
+		buf = binary.AppendUvarint(buf, uint64(disc.Type))
+		buf = binary.AppendUvarint(buf, uint64(disc.Position))
+		buf = binary.AppendVarint(buf, disc.PtsTicks)
+		buf = binary.AppendVarint(buf, disc.DeltaTicks)
+
+		wrap := byte(0)
+		if disc.Wrap {
+			wrap = 1
+		}
+		buf = append(buf, wrap)
+	}
+
+	n, err := w.Write(buf)
+
+	return int64(n), err
+}
+
+// ReadIndex reads an index written by Index.WriteTo from r.
+// If r is not an io.ByteReader, it may read past the end of the index.
+// Returns ErrInvalidIndex if the index can not be read, or does not pass the checks of Demux.SetIndex.
+func ReadIndex(r io.Reader) (*Index, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	var err error
+	readUvarint := func() int {
+		if err != nil {
+			return 0
+		}
+
+		var v uint64
+		v, err = binary.ReadUvarint(br)
+
+		return int(v)
+	}
+	readVarint := func() int64 {
+		if err != nil {
+			return 0
+		}
+
+		var v int64
+		v, err = binary.ReadVarint(br)
+
+		return v
+	}
+	readByte := func() byte {
+		if err != nil {
+			return 0
+		}
+
+		var v byte
+		v, err = br.ReadByte()
+
+		return v
+	}
+
+	header := make([]byte, len(indexMagic)+1)
+	for i := range header {
+		header[i] = readByte()
+	}
+	if err == nil && (string(header[:len(indexMagic)]) != indexMagic || header[len(indexMagic)] != indexVersion) {
+		return nil, ErrInvalidIndex
+	}
+
+	index := &Index{}
+	index.Type = readUvarint()
+	index.Size = readUvarint()
+
+	n := readUvarint()
+	var prev IndexEntry
+	for i := 0; i < n && err == nil; i++ {
+		e := IndexEntry{
+			Position: prev.Position + readUvarint(),
+			Offset:   readUvarint(),
+			PtsTicks: prev.PtsTicks + readVarint(),
+			GOP:      prev.GOP + readUvarint(),
+		}
+		e.GOPPtsTicks = e.PtsTicks - readVarint()
+		index.Entries = append(index.Entries, e)
+		prev = e
+	}
+
+	n = readUvarint()
+	for i := 0; i < n && err == nil; i++ {
+		disc := Discontinuity{
+			Type:       readUvarint(),
+			Position:   readUvarint(),
+			PtsTicks:   readVarint(),
+			DeltaTicks: readVarint(),
+			Wrap:       readByte() == 1,
+		}
+		disc.Pts = float64(disc.PtsTicks) / ClockRate
+		disc.Delta = float64(disc.DeltaTicks) / ClockRate
+		index.Discontinuities = append(index.Discontinuities, disc)
+	}
+
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return nil, errors.Join(ErrInvalidIndex, err)
+	}
+
+	if !index.valid() {
+		return nil, ErrInvalidIndex
+	}
+
+	return index, nil
+}
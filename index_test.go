@@ -0,0 +1,232 @@
+package mpeg
+
+import (
+	"bytes"
+	"errors"
+	"hash/fnv"
+	"os"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestIndexBuilderSplit checks that the intra frames are found at the same places when the packets are
+// split in pieces of a few bytes, so that the start codes and headers span several packets.
+func TestIndexBuilderSplit(t *testing.T) {
+	data, err := os.ReadFile("testdata/test.mpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := NewBuffer(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.SetLoadCallback(buf.LoadReaderCallback)
+
+	d, err := NewDemux(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type packet struct {
+		ptsTicks int64
+		data     []byte
+	}
+
+	var packets []packet
+	for p := d.Decode(); p != nil; p = d.Decode() {
+		if p.Type == PacketVideo1 {
+			packets = append(packets, packet{p.PtsTicks, bytes.Clone(p.Data)})
+		}
+	}
+
+	// The positions are the offsets in the video stream, entries point to the same bytes however it is split.
+	build := func(size int) []IndexEntry {
+		b := newIndexBuilder()
+
+		position := 0
+		for _, p := range packets {
+			// The PTS goes with the piece the first picture starts in.
+			first := bytes.Index(p.data, []byte{0x00, 0x00, 0x01, startPicture})
+
+			for i := 0; i < len(p.data); i += size {
+				piece := p.data[i:min(i+size, len(p.data))]
+
+				ptsTicks := int64(PacketInvalidTS)
+				if first >= i && first < i+len(piece) {
+					ptsTicks = p.ptsTicks
+				}
+
+				b.write(position, ptsTicks, piece)
+				position += len(piece)
+			}
+		}
+
+		for i := range b.entries {
+			b.entries[i].Position += b.entries[i].Offset
+			b.entries[i].Offset = 0
+		}
+
+		return b.entries
+	}
+
+	want := build(len(data))
+	if len(want) < 10 {
+		t.Fatalf("got %d entries, want more", len(want))
+	}
+
+	for size := 1; size <= 12; size++ {
+		if got := build(size); !slices.Equal(got, want) {
+			t.Errorf("pieces of %d bytes: got %+v, want %+v", size, got, want)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	mpg, err := os.ReadFile("testdata/test.mpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New(bytes.NewReader(mpg))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := m.BuildIndex()
+	if index == nil || len(index.Entries) < 2 {
+		t.Fatalf("BuildIndex: got %+v, want several entries", index)
+	}
+	for i := 1; i < len(index.Entries); i++ {
+		prev, e := index.Entries[i-1], index.Entries[i]
+		if e.Position < prev.Position || e.PtsTicks <= prev.PtsTicks || e.GOP <= prev.GOP {
+			t.Fatalf("entry %d: %+v after %+v", i, e, prev)
+		}
+	}
+
+	var b bytes.Buffer
+	if _, err := index.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadIndex(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, index) {
+		t.Fatalf("ReadIndex: got %+v, want %+v", read, index)
+	}
+
+	if _, err := ReadIndex(bytes.NewReader(b.Bytes()[:b.Len()/2])); !errors.Is(err, ErrInvalidIndex) {
+		t.Errorf("ReadIndex: got error %v, want %v", err, ErrInvalidIndex)
+	}
+	d, err := NewDemux(NewBufferBytes(mpg[:len(mpg)-2048]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetIndex(index); !errors.Is(err, ErrInvalidIndex) {
+		t.Errorf("SetIndex: got error %v, want %v", err, ErrInvalidIndex)
+	}
+
+	// Indexes that would make seeking fail are rejected, also when read from a sidecar.
+	for name, fn := range map[string]func(index *Index){
+		"empty":             func(index *Index) { index.Entries = nil },
+		"unsorted position": func(index *Index) { index.Entries[1].Position = index.Entries[0].Position - 1 },
+		"unsorted PTS":      func(index *Index) { index.Entries[1].PtsTicks = index.Entries[0].PtsTicks - 1 },
+		"negative position": func(index *Index) { index.Entries[0].Position = -1 },
+		"position past end": func(index *Index) { index.Entries[len(index.Entries)-1].Position = index.Size },
+		"negative offset":   func(index *Index) { index.Entries[0].Offset = -1 },
+	} {
+		invalid := *index
+		invalid.Entries = slices.Clone(index.Entries)
+		fn(&invalid)
+
+		d, err := NewDemux(NewBufferBytes(mpg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.SetIndex(&invalid); !errors.Is(err, ErrInvalidIndex) {
+			t.Errorf("SetIndex %s: got error %v, want %v", name, err, ErrInvalidIndex)
+		}
+
+		var b bytes.Buffer
+		if _, err := invalid.WriteTo(&b); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadIndex(&b); !errors.Is(err, ErrInvalidIndex) {
+			t.Errorf("ReadIndex %s: got error %v, want %v", name, err, ErrInvalidIndex)
+		}
+	}
+
+	// Exact seeks find the frames of sequential decoding.
+	seq, err := New(bytes.NewReader(mpg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq.SetAudioEnabled(false)
+
+	var ticks []int64
+	var hashes []uint64
+	for frame := seq.DecodeVideo(); frame != nil; frame = seq.DecodeVideo() {
+		h := fnv.New64a()
+		h.Write(frame.Y.Data)
+		ticks = append(ticks, frame.Ticks)
+		hashes = append(hashes, h.Sum64())
+	}
+
+	for ms := 1000; ms < 9000; ms += 250 {
+		tm := time.Duration(ms) * time.Millisecond
+		target := int64(ms) * ClockRate / 1000
+
+		frame := m.SeekFrame(tm, false)
+		if frame == nil || frame.Ticks > target || !slices.Contains(ticks, frame.Ticks) {
+			t.Fatalf("SeekFrame(%v, false): got %+v, want a frame before %d", tm, frame, target)
+		}
+
+		frame = m.SeekFrame(tm, true)
+		i, _ := slices.BinarySearch(ticks, target)
+		if frame == nil || frame.Ticks != ticks[i] {
+			t.Fatalf("SeekFrame(%v, true): got %+v, want %d ticks", tm, frame, ticks[i])
+		}
+		h := fnv.New64a()
+		h.Write(frame.Y.Data)
+		if h.Sum64() != hashes[i] {
+			t.Errorf("SeekFrame(%v, true): frame at %d ticks differs from sequential decoding", tm, ticks[i])
+		}
+	}
+
+	// An index read from a sidecar brings the timeline of the source with it.
+	data := shiftTimestamps(mpg, 1<<33-5*90000)
+	m, err = New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Reset()
+	if _, err := m.BuildIndex().WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err = ReadIndex(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetIndex(read); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Discontinuities()) != 1 {
+		t.Errorf("Discontinuities: got %+v, want a single wrap", m.Discontinuities())
+	}
+
+	frame := m.SeekFrame(7*time.Second, true)
+	if frame == nil {
+		t.Fatal("SeekFrame: frame is nil")
+	}
+	if frame.Ticks != 7*ClockRate {
+		t.Errorf("SeekFrame: got %d ticks, want %d", frame.Ticks, 7*ClockRate)
+	}
+}
@@ -0,0 +1,337 @@
+package mpeg
+
+import (
+	"sort"
+)
+
+// Info describes the source and its streams, see Demux.Info. It can be serialized to JSON.
+// Container is "mpeg" for program streams, or the codec of an elementary stream.
+// Times are in seconds, Bitrate in bits per second of the whole source.
+type Info struct {
+	Container     string       `json:"container"`
+	Size          int          `json:"size"`
+	Duration      float64      `json:"duration"`
+	DurationTicks int64        `json:"duration_ticks"`
+	Bitrate       int          `json:"bitrate"`
+	Streams       []StreamInfo `json:"streams"`
+}
+
+// StreamInfo describes a stream of the source. ID is the packet type, see PacketVideo1.
+// Type is "video", "audio" or "private", Codec is "mpeg1video", "mp2" or empty if not known.
+// Bitrate is the average bitrate of the payload, Packets the number of packets of the stream.
+type StreamInfo struct {
+	ID            int        `json:"id"`
+	Type          string     `json:"type"`
+	Codec         string     `json:"codec,omitempty"`
+	StartTime     float64    `json:"start_time"`
+	StartTicks    int64      `json:"start_ticks"`
+	Duration      float64    `json:"duration"`
+	DurationTicks int64      `json:"duration_ticks"`
+	Bitrate       int        `json:"bitrate"`
+	Packets       int        `json:"packets"`
+	Size          int        `json:"size"`
+	Video         *VideoInfo `json:"video,omitempty"`
+	Audio         *AudioInfo `json:"audio,omitempty"`
+}
+
+// VideoInfo describes a video stream, from its first sequence header and its pictures.
+// PixelAspectRatio is the pel aspect ratio (height to width of a pixel), DisplayAspectRatio the
+// resulting width to height of the picture. Bitrate is the one of the sequence header, 0 for variable.
+// IntraQuantMatrix and NonIntraQuantMatrix are true if the sequence header loads custom matrices.
+type VideoInfo struct {
+	Width               int     `json:"width"`
+	Height              int     `json:"height"`
+	PixelAspectRatio    float64 `json:"pixel_aspect_ratio"`
+	DisplayAspectRatio  float64 `json:"display_aspect_ratio"`
+	FrameRate           float64 `json:"frame_rate"`
+	FrameRateNum        int     `json:"frame_rate_num"`
+	FrameRateDen        int     `json:"frame_rate_den"`
+	Bitrate             int     `json:"bitrate"`
+	IntraQuantMatrix    bool    `json:"intra_quant_matrix"`
+	NonIntraQuantMatrix bool    `json:"non_intra_quant_matrix"`
+	GOP                 GOPInfo `json:"gop"`
+}
+
+// GOPInfo describes the groups of pictures of a video stream. Pattern holds the picture types
+// of the first group in coding order, e.g. "IBBPBBPBB". MaxSize is the largest number of pictures in a group.
+type GOPInfo struct {
+	Count     int    `json:"count"`
+	Closed    int    `json:"closed"`
+	MaxSize   int    `json:"max_size"`
+	Pattern   string `json:"pattern"`
+	Pictures  int    `json:"pictures"`
+	IFrames   int    `json:"i_frames"`
+	PFrames   int    `json:"p_frames"`
+	BFrames   int    `json:"b_frames"`
+	Sequences int    `json:"sequences"`
+}
+
+// AudioInfo describes an audio stream, from its first frame header.
+// Mode is "stereo", "joint_stereo", "dual_channel" or "mono", Bitrate in bits per second.
+type AudioInfo struct {
+	Layer      int    `json:"layer"`
+	Mode       string `json:"mode"`
+	Channels   int    `json:"channels"`
+	Samplerate int    `json:"samplerate"`
+	Bitrate    int    `json:"bitrate"`
+}
+
+// Info reads the whole source, without decoding it, and returns a description of it and its streams.
+// This can only be used when the underlying Buffer is seekable, returns nil otherwise.
+func (d *Demux) Info() *Info {
+	if !d.HasHeaders() || !d.buf.Seekable() {
+		return nil
+	}
+
+	prevPos := d.buf.tell()
+	prevStartCode := d.startCode
+
+	info := &Info{Container: "mpeg", Size: d.buf.Size()}
+	if d.elementary != nil {
+		info.Container = streamCodec(d.elementary.typ)
+	}
+
+	streams := make(map[int]*StreamInfo)
+	scanners := make(map[int]*videoScanner)
+
+	d.Rewind()
+	for {
+		packet := d.next()
+		if packet == nil {
+			break
+		}
+
+		s := streams[packet.Type]
+		if s == nil {
+			s = &StreamInfo{ID: packet.Type, Type: streamType(packet.Type), Codec: streamCodec(packet.Type)}
+			streams[packet.Type] = s
+		}
+		s.Packets++
+		s.Size += len(packet.Data)
+
+		switch {
+		case packet.Type == PacketVideo1:
+			if scanners[packet.Type] == nil {
+				s.Video = &VideoInfo{}
+				scanners[packet.Type] = &videoScanner{info: s.Video}
+			}
+			scanners[packet.Type].write(packet.Data)
+		case packet.Type >= PacketAudio1 && packet.Type <= PacketAudio4:
+			if s.Audio == nil {
+				s.Audio = audioInfo(packet.Data)
+			}
+		}
+	}
+
+	for _, scanner := range scanners {
+		scanner.endGOP()
+	}
+
+	d.bufferSeek(prevPos)
+	d.startCode = prevStartCode
+
+	for _, s := range streams {
+		if startTicks := d.StartTicks(s.ID); startTicks != PacketInvalidTS {
+			s.StartTicks = startTicks
+			s.StartTime = float64(startTicks) / ClockRate
+		}
+
+		s.DurationTicks = d.DurationTicks(s.ID)
+		s.Duration = float64(s.DurationTicks) / ClockRate
+		if s.DurationTicks > 0 {
+			s.Bitrate = int(int64(s.Size) * 8 * ClockRate / s.DurationTicks)
+		}
+
+		info.DurationTicks = max(info.DurationTicks, s.DurationTicks)
+		info.Streams = append(info.Streams, *s)
+	}
+
+	sort.Slice(info.Streams, func(i, j int) bool {
+		return info.Streams[i].ID < info.Streams[j].ID
+	})
+
+	info.Duration = float64(info.DurationTicks) / ClockRate
+	if info.DurationTicks > 0 {
+		info.Bitrate = int(int64(info.Size) * 8 * ClockRate / info.DurationTicks)
+	}
+
+	return info
+}
+
+func streamType(typ int) string {
+	switch {
+	case typ == PacketVideo1:
+		return "video"
+	case typ >= PacketAudio1 && typ <= PacketAudio4:
+		return "audio"
+	}
+
+	return "private"
+}
+
+func streamCodec(typ int) string {
+	switch {
+	case typ == PacketVideo1:
+		return "mpeg1video"
+	case typ >= PacketAudio1 && typ <= PacketAudio4:
+		return "mp2"
+	}
+
+	return ""
+}
+
+// audioInfo returns the description of the first Layer II frame header found in data, nil if there is none.
+func audioInfo(data []byte) *AudioInfo {
+	for i := 0; i+3 < len(data); i++ {
+		if data[i] != 0xFF || data[i+1]&0xE0 != 0xE0 {
+			continue
+		}
+
+		version := int(data[i+1]>>3) & 0x03
+		layer := int(data[i+1]>>1) & 0x03
+		bitrateIndex := int(data[i+2]>>4) - 1
+		samplerateIndex := int(data[i+2]>>2) & 0x03
+		mode := int(data[i+3] >> 6)
+
+		if version != mpeg1 && version != mpeg2 || layer != layerII || bitrateIndex < 0 || bitrateIndex > 13 || samplerateIndex == 3 {
+			continue
+		}
+
+		if version == mpeg2 {
+			bitrateIndex += 14
+			samplerateIndex += 4
+		}
+
+		info := &AudioInfo{
+			Layer:      4 - layer,
+			Mode:       audioModes[mode],
+			Channels:   2,
+			Samplerate: int(samplerate[samplerateIndex]),
+			Bitrate:    int(bitrate[bitrateIndex]) * 1000,
+		}
+		if mode == modeMono {
+			info.Channels = 1
+		}
+
+		return info
+	}
+
+	return nil
+}
+
+var audioModes = [4]string{"stereo", "joint_stereo", "dual_channel", "mono"}
+
+// videoScanner collects the description of a video stream from its start codes. Start codes and
+// headers may be split between packets, the unfinished tail of a packet is kept for the next one.
+type videoScanner struct {
+	info    *VideoInfo
+	pending []byte
+
+	gopSize    int
+	hasPattern bool
+	pattern    []byte
+}
+
+// write scans the packet data.
+func (s *videoScanner) write(p []byte) {
+	data := append(s.pending, p...)
+
+	i := 0
+	for ; i+3 < len(data); i++ {
+		if data[i] != 0x00 || data[i+1] != 0x00 || data[i+2] != 0x01 {
+			continue
+		}
+
+		// The longest header needed is the sequence header with an intra quant matrix.
+		need := 4
+		switch data[i+3] {
+		case startSequence:
+			need = 4 + 72
+		case startGOP, startPicture:
+			need = 8
+		}
+		if i+need > len(data) {
+			break
+		}
+
+		s.startCode(data[i+3], data[i+4:i+need])
+	}
+
+	// Keep an unfinished start code or header for the next packet.
+	if i > len(data)-3 {
+		i = max(len(data)-3, 0)
+	}
+	s.pending = append(s.pending[:0:0], data[i:]...)
+}
+
+func (s *videoScanner) startCode(code byte, header []byte) {
+	info := s.info
+
+	switch code {
+	case startSequence:
+		info.GOP.Sequences++
+		if info.GOP.Sequences > 1 {
+			return
+		}
+
+		info.Width = int(header[0])<<4 | int(header[1])>>4
+		info.Height = int(header[1]&0x0F)<<8 | int(header[2])
+		info.PixelAspectRatio = videoAspectRatio[header[3]>>4]
+		if info.PixelAspectRatio != 0 && info.Height != 0 {
+			info.DisplayAspectRatio = float64(info.Width) / (float64(info.Height) * info.PixelAspectRatio)
+		}
+
+		rate := header[3] & 0x0F
+		info.FrameRate = videoPictureRate[rate]
+		info.FrameRateNum, info.FrameRateDen = videoPictureRateNum[rate], videoPictureRateDen[rate]
+
+		if bitRate := int(header[4])<<10 | int(header[5])<<2 | int(header[6])>>6; bitRate != 0x3FFFF {
+			info.Bitrate = bitRate * 400
+		}
+
+		// Bit 62 loads the intra matrix, the non-intra flag follows it or the 64 byte matrix.
+		bit := func(n int) bool {
+			return header[n>>3]>>(7-n&7)&1 != 0
+		}
+		info.IntraQuantMatrix = bit(62)
+		if info.IntraQuantMatrix {
+			info.NonIntraQuantMatrix = bit(63 + 64*8)
+		} else {
+			info.NonIntraQuantMatrix = bit(63)
+		}
+	case startGOP:
+		s.endGOP()
+		info.GOP.Count++
+		if header[3]&0x40 != 0 {
+			info.GOP.Closed++
+		}
+	case startPicture:
+		s.gopSize++
+		info.GOP.Pictures++
+
+		pictureType := int(header[1]>>3) & 0x07
+		switch pictureType {
+		case pictureTypeIntra:
+			info.GOP.IFrames++
+		case pictureTypePredictive:
+			info.GOP.PFrames++
+		case pictureTypeB:
+			info.GOP.BFrames++
+		}
+
+		if !s.hasPattern && pictureType >= pictureTypeIntra && pictureType <= pictureTypeB {
+			s.pattern = append(s.pattern, "IPB"[pictureType-pictureTypeIntra])
+		}
+	}
+}
+
+// endGOP finishes the current group of pictures.
+func (s *videoScanner) endGOP() {
+	s.info.GOP.MaxSize = max(s.info.GOP.MaxSize, s.gopSize)
+	s.gopSize = 0
+
+	if len(s.pattern) > 0 && !s.hasPattern {
+		s.info.GOP.Pattern = string(s.pattern)
+		s.hasPattern = true
+	}
+}
@@ -0,0 +1,77 @@
+package mpeg_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/gen2brain/mpeg"
+)
+
+func TestInfo(t *testing.T) {
+	m, err := mpeg.New(bytes.NewReader(testMpg))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Info restores the position, decoding continues where it was.
+	frame := m.DecodeVideo()
+	if frame == nil {
+		t.Fatal("DecodeVideo: frame is nil")
+	}
+
+	info := m.Info()
+	if info == nil {
+		t.Fatal("Info: info is nil")
+	}
+
+	if frame = m.DecodeVideo(); frame == nil || frame.Ticks != 3000 {
+		t.Errorf("DecodeVideo: got %+v, want the second frame", frame)
+	}
+
+	if info.Container != "mpeg" || info.Size != len(testMpg) || len(info.Streams) != 2 {
+		t.Fatalf("Info: got %+v", info)
+	}
+
+	audio, video := info.Streams[0], info.Streams[1]
+	if audio.ID != mpeg.PacketAudio1 || audio.Codec != "mp2" || audio.Audio == nil || video.ID != mpeg.PacketVideo1 || video.Codec != "mpeg1video" || video.Video == nil {
+		t.Fatalf("Streams: got %+v", info.Streams)
+	}
+
+	if video.DurationTicks != m.DurationTicks() || video.StartTicks != 72907 || video.Packets != 143 || video.Size != 288470 {
+		t.Errorf("video: got %+v", video)
+	}
+
+	want := mpeg.VideoInfo{
+		Width: 160, Height: 120, PixelAspectRatio: 1, DisplayAspectRatio: 160.0 / 120, FrameRate: 30, FrameRateNum: 30, FrameRateDen: 1, Bitrate: 247600,
+		GOP: mpeg.GOPInfo{Count: 19, MaxSize: 15, Pattern: "IBBPBBPBBPBBPBB", Pictures: 279, IFrames: 19, PFrames: 74, BFrames: 186, Sequences: 1},
+	}
+	if *video.Video != want {
+		t.Errorf("video: got %+v, want %+v", *video.Video, want)
+	}
+
+	if *audio.Audio != (mpeg.AudioInfo{Layer: 2, Mode: "mono", Channels: 1, Samplerate: 44100, Bitrate: 64000}) || audio.Size != len(testMp2) {
+		t.Errorf("audio: got %+v, %+v", audio, *audio.Audio)
+	}
+
+	b, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read mpeg.Info
+	if err := json.Unmarshal(b, &read); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&read, info) {
+		t.Errorf("json: got %+v, want %+v", read, info)
+	}
+
+	m, err = mpeg.New(bytes.NewReader(testMp2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := m.Info(); info == nil || info.Container != "mp2" || len(info.Streams) != 1 || info.Streams[0].Audio == nil {
+		t.Errorf("Info: got %+v, want a single mp2 stream", info)
+	}
+}
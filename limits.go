@@ -0,0 +1,53 @@
+package mpeg
+
+import (
+	"errors"
+)
+
+// ErrLimitExceeded is the error reported when a stream exceeds one of the Limits.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// Limits bounds the resources used to decode untrusted streams, see New, NewDemux and NewVideo.
+// A zero value means no limit.
+type Limits struct {
+	// MaxWidth and MaxHeight bound the video dimensions. Frames are not allocated for a
+	// sequence header that exceeds them, the video is not decoded.
+	MaxWidth  int
+	MaxHeight int
+
+	// MaxBufferSize bounds the number of bytes held by a buffer. Data that would exceed it
+	// is not written, and the buffer reports ErrLimitExceeded, see Buffer.Write.
+	MaxBufferSize int
+
+	// MaxPacketSize bounds the payload size of demuxed packets. Larger packets are skipped.
+	MaxPacketSize int
+
+	// MaxDecodeSteps bounds the work done by one decode call: the start codes examined by Demux.Decode,
+	// the pictures examined by Video.Decode, and the packets demuxed by a decode or seek of MPEG.
+	// A call that runs out of steps returns nil, the next call continues where it stopped.
+	MaxDecodeSteps int
+}
+
+// limitsOf returns the optional limits passed to a constructor.
+func limitsOf(limits []Limits) Limits {
+	if len(limits) == 0 {
+		return Limits{}
+	}
+
+	return limits[0]
+}
+
+// dimensions checks whether the video dimensions are within the limits.
+func (l Limits) dimensions(width, height int) bool {
+	return (l.MaxWidth <= 0 || width <= l.MaxWidth) && (l.MaxHeight <= 0 || height <= l.MaxHeight)
+}
+
+// packet checks whether the packet size is within the limits.
+func (l Limits) packet(size int) bool {
+	return l.MaxPacketSize <= 0 || size <= l.MaxPacketSize
+}
+
+// steps checks whether the number of decode steps is within the limits.
+func (l Limits) steps(n int) bool {
+	return l.MaxDecodeSteps <= 0 || n <= l.MaxDecodeSteps
+}
@@ -0,0 +1,115 @@
+package mpeg_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/gen2brain/mpeg"
+)
+
+func TestLimits(t *testing.T) {
+	t.Run("dimensions", func(t *testing.T) {
+		if _, err := mpeg.New(bytes.NewReader(testMpg), mpeg.Limits{MaxWidth: 128}); !errors.Is(err, mpeg.ErrLimitExceeded) {
+			t.Errorf("New: got error %v, want %v", err, mpeg.ErrLimitExceeded)
+		}
+
+		buf, err := mpeg.NewBuffer(bytes.NewReader(testMpeg1video))
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.SetLoadCallback(buf.LoadReaderCallback)
+
+		video := mpeg.NewVideo(buf, mpeg.Limits{MaxHeight: 100})
+		if frame := video.Decode(); frame != nil || !errors.Is(video.Err(), mpeg.ErrLimitExceeded) {
+			t.Errorf("Video.Decode: got error %v, want %v", video.Err(), mpeg.ErrLimitExceeded)
+		}
+
+		m, err := mpeg.New(bytes.NewReader(testMpg), mpeg.Limits{MaxWidth: 160, MaxHeight: 120})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Width() != 160 || m.Height() != 120 {
+			t.Errorf("New: got %dx%d", m.Width(), m.Height())
+		}
+	})
+
+	t.Run("buffer size", func(t *testing.T) {
+		buf, err := mpeg.NewBuffer(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		video := mpeg.NewVideo(buf, mpeg.Limits{MaxBufferSize: 64 * 1024})
+		if n := buf.Write(testMpeg1video); n != 0 || !errors.Is(buf.Err(), mpeg.ErrLimitExceeded) {
+			t.Errorf("Write: got %d and error %v, want %v", n, buf.Err(), mpeg.ErrLimitExceeded)
+		}
+		if frame := video.Decode(); frame != nil || !errors.Is(video.Err(), mpeg.ErrLimitExceeded) {
+			t.Errorf("Video.Decode: got error %v, want %v", video.Err(), mpeg.ErrLimitExceeded)
+		}
+
+		m, err := mpeg.New(bytes.NewReader(testMpg), mpeg.Limits{MaxBufferSize: 64 * 1024})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.SetAudioEnabled(false)
+
+		frames := 0
+		for m.DecodeVideo() != nil {
+			frames++
+		}
+		if frames != 278 || m.Err() != nil {
+			t.Errorf("DecodeVideo: got %d frames and error %v", frames, m.Err())
+		}
+	})
+
+	t.Run("packet size", func(t *testing.T) {
+		buf, err := mpeg.NewBuffer(bytes.NewReader(testMpg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.SetLoadCallback(buf.LoadReaderCallback)
+
+		d, err := mpeg.NewDemux(buf, mpeg.Limits{MaxPacketSize: 1800})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		packets, skipped := 0, 0
+		for !d.HasEnded() {
+			packet := d.Decode()
+			switch {
+			case packet != nil:
+				packets++
+				if len(packet.Data) > 1800 {
+					t.Fatalf("Decode: got packet of %d bytes", len(packet.Data))
+				}
+			case errors.Is(d.Err(), mpeg.ErrLimitExceeded):
+				skipped++
+			}
+		}
+		if packets == 0 || skipped == 0 {
+			t.Errorf("Decode: got %d packets, %d skipped", packets, skipped)
+		}
+	})
+
+	t.Run("decode steps", func(t *testing.T) {
+		m, err := mpeg.New(bytes.NewReader(testMpg), mpeg.Limits{MaxDecodeSteps: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.SetAudioEnabled(false)
+
+		frames, exceeded := 0, 0
+		for !m.HasEnded() {
+			if m.DecodeVideo() != nil {
+				frames++
+			} else if errors.Is(m.Err(), mpeg.ErrLimitExceeded) {
+				exceeded++
+			}
+		}
+		if frames != 278 || exceeded == 0 {
+			t.Errorf("DecodeVideo: got %d frames, %d calls over the limit", frames, exceeded)
+		}
+	})
+}
@@ -0,0 +1,188 @@
+package mpeg
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// LiveStats are the statistics of a live buffer, see NewBufferLive.
+type LiveStats struct {
+	// Written is the number of bytes written, Dropped the number of bytes Write dropped because the ring was full.
+	Written int64
+	Dropped int64
+
+	// Overruns is the number of calls to Write that dropped data, Underruns the number of times
+	// the decoder needed more data and the ring was empty.
+	Overruns  int
+	Underruns int
+}
+
+// liveRing is the fixed-capacity ring between the producer of a live buffer and the decoder.
+// The producer writes to the ring, the decoder moves the data from the ring to the buffer when it needs more.
+type liveRing struct {
+	mu sync.Mutex
+
+	data  []byte
+	start int
+	len   int
+
+	// Position of the next byte written, counted from the first byte, and the time stamps written with the data.
+	pos        int
+	timestamps []timestamp
+
+	ended bool
+	stats LiveStats
+
+	// Closed and replaced when data is read from the ring, to wake blocked writers.
+	read chan struct{}
+}
+
+// NewBufferLive creates a buffer for live input with a ring of fixed capacity in bytes, which the
+// data is written to. Write and WriteContext can be called from another goroutine than the one decoding,
+// as can WritePts, SignalEnd and LiveStats; Write drops what does not fit in the ring, WriteContext
+// waits for the decoder to make room. The decoder moves the data from the ring to the buffer when it
+// needs more, the buffer holds up to capacity bytes too. A frame or packet larger than that can not
+// be decoded, Err then reports ErrLimitExceeded.
+func NewBufferLive(capacity int) *Buffer {
+	capacity = max(capacity, 1)
+
+	buf := &Buffer{}
+	buf.bytes = make([]byte, 0, capacity)
+	buf.discardRead = true
+	buf.maxSize = capacity
+
+	buf.live = &liveRing{
+		data: make([]byte, capacity),
+		read: make(chan struct{}),
+	}
+	buf.loadCallback = buf.loadLive
+
+	return buf
+}
+
+// LiveStats returns the statistics of a live buffer, see NewBufferLive.
+func (b *Buffer) LiveStats() LiveStats {
+	if b.live == nil {
+		return LiveStats{}
+	}
+
+	b.live.mu.Lock()
+	defer b.live.mu.Unlock()
+
+	return b.live.stats
+}
+
+// WriteContext writes p to a live buffer (see NewBufferLive), and waits for room in the ring until
+// all of p is written or ctx is done. Returns the number of bytes written, and ctx.Err() if ctx is done
+// first, or io.ErrClosedPipe if the end was signaled. For other buffers this is the same as Write.
+func (b *Buffer) WriteContext(ctx context.Context, p []byte) (int, error) {
+	if b.live == nil {
+		return b.Write(p), nil
+	}
+
+	n := 0
+	for {
+		written, ended, read := b.live.write(p[n:], false, nil)
+		n += written
+
+		switch {
+		case n == len(p):
+			return n, nil
+		case ended:
+			return n, io.ErrClosedPipe
+		}
+
+		select {
+		case <-ctx.Done():
+			return n, ctx.Err()
+		case <-read:
+		}
+	}
+}
+
+// write copies as much of p to the ring as fits, with the time stamp ticks if not nil, see Buffer.WritePts.
+// Returns the number of bytes written, whether the end was signaled, and the channel closed on the next read.
+// With drop, the rest of p is counted as dropped.
+func (r *liveRing) write(p []byte, drop bool, ticks *int64) (int, bool, chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ended {
+		return 0, true, r.read
+	}
+
+	n := min(len(p), len(r.data)-r.len)
+	if ticks != nil && n > 0 {
+		r.timestamps = append(r.timestamps, timestamp{r.pos, r.pos + n, *ticks})
+	}
+
+	end := (r.start + r.len) % len(r.data)
+	c := copy(r.data[end:], p[:n])
+	copy(r.data, p[c:n])
+
+	r.len += n
+	r.pos += n
+	r.stats.Written += int64(n)
+
+	if drop && n < len(p) {
+		r.stats.Dropped += int64(len(p) - n)
+		r.stats.Overruns++
+	}
+
+	return n, false, r.read
+}
+
+// end signals the end of the data written to the ring, and wakes blocked writers.
+func (r *liveRing) end() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.ended {
+		r.ended = true
+		close(r.read)
+		r.read = make(chan struct{})
+	}
+}
+
+// loadLive moves the data from the ring to the buffer, as much as the buffer can hold.
+func (b *Buffer) loadLive(buffer *Buffer) {
+	r := b.live
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.len == 0 {
+		if r.ended {
+			b.totalSize = b.discarded + len(b.bytes)
+		} else {
+			r.stats.Underruns++
+		}
+
+		return
+	}
+
+	if b.discardRead {
+		b.discardReadBytes()
+	}
+
+	n := min(r.len, max(b.maxSize-len(b.bytes), 0))
+	if n == 0 {
+		b.err = ErrLimitExceeded
+
+		return
+	}
+
+	end := min(r.start+n, len(r.data))
+	b.bytes = append(b.bytes, r.data[r.start:end]...)
+	b.bytes = append(b.bytes, r.data[:n-(end-r.start)]...)
+
+	r.start = (r.start + n) % len(r.data)
+	r.len -= n
+
+	b.timestamps = append(b.timestamps, r.timestamps...)
+	r.timestamps = r.timestamps[:0]
+
+	close(r.read)
+	r.read = make(chan struct{})
+}
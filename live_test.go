@@ -0,0 +1,119 @@
+package mpeg_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/gen2brain/mpeg"
+)
+
+func TestBufferLive(t *testing.T) {
+	t.Run("concurrent", func(t *testing.T) {
+		buf := mpeg.NewBufferLive(64 * 1024)
+		video := mpeg.NewVideo(buf)
+
+		errc := make(chan error, 1)
+		go func() {
+			for data := testMpeg1video; len(data) > 0; {
+				n, err := buf.WriteContext(context.Background(), data[:min(len(data), 4096)])
+				if err != nil {
+					errc <- err
+
+					return
+				}
+				data = data[n:]
+			}
+			buf.SignalEnd()
+			errc <- nil
+		}()
+
+		frames := 0
+		for {
+			if video.Decode() != nil {
+				frames++
+
+				continue
+			}
+			if !errors.Is(video.Err(), mpeg.ErrNeedMoreData) {
+				break
+			}
+			runtime.Gosched()
+		}
+
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+		if frames != 260 || video.Err() != nil {
+			t.Errorf("Decode: got %d frames and error %v, want %d", frames, video.Err(), 260)
+		}
+
+		stats := buf.LiveStats()
+		if stats.Written != int64(len(testMpeg1video)) || stats.Dropped != 0 || stats.Overruns != 0 {
+			t.Errorf("LiveStats: got %+v", stats)
+		}
+	})
+
+	t.Run("overrun", func(t *testing.T) {
+		buf := mpeg.NewBufferLive(1000)
+
+		if n := buf.Write(testMpg[:1500]); n != 1000 {
+			t.Errorf("Write: got %d, want %d", n, 1000)
+		}
+		if n := buf.Write(testMpg[1500:1600]); n != 0 {
+			t.Errorf("Write: got %d to a full ring, want 0", n)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if n, err := buf.WriteContext(ctx, testMpg[1500:1600]); n != 0 || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("WriteContext: got %d and error %v, want %v", n, err, context.DeadlineExceeded)
+		}
+
+		want := mpeg.LiveStats{Written: 1000, Dropped: 600, Overruns: 2}
+		if stats := buf.LiveStats(); stats != want {
+			t.Errorf("LiveStats: got %+v, want %+v", stats, want)
+		}
+	})
+
+	t.Run("underrun", func(t *testing.T) {
+		buf := mpeg.NewBufferLive(64 * 1024)
+		buf.Write(testMpeg1video[:10000])
+
+		video := mpeg.NewVideo(buf)
+		for video.Decode() != nil {
+		}
+		if !errors.Is(video.Err(), mpeg.ErrNeedMoreData) {
+			t.Errorf("Decode: got error %v, want %v", video.Err(), mpeg.ErrNeedMoreData)
+		}
+		if stats := buf.LiveStats(); stats.Underruns == 0 {
+			t.Errorf("LiveStats: got %+v, want underruns", stats)
+		}
+
+		buf.SignalEnd()
+		if _, err := buf.WriteContext(context.Background(), testMpeg1video[10000:]); !errors.Is(err, io.ErrClosedPipe) {
+			t.Errorf("WriteContext: got error %v after the end, want %v", err, io.ErrClosedPipe)
+		}
+		for video.Decode() != nil {
+		}
+		if video.Err() != nil || !video.HasEnded() {
+			t.Errorf("Decode: got error %v at the end", video.Err())
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		buf := mpeg.NewBufferLive(2000)
+		video := mpeg.NewVideo(buf)
+
+		for data := testMpeg1video; len(data) > 0 && video.Err() != mpeg.ErrLimitExceeded; {
+			data = data[buf.Write(data):]
+			video.Decode()
+		}
+		if !errors.Is(video.Err(), mpeg.ErrLimitExceeded) {
+			t.Errorf("Decode: got error %v, want %v", video.Err(), mpeg.ErrLimitExceeded)
+		}
+	})
+}
@@ -0,0 +1,302 @@
+package mpeg
+
+import (
+	"math"
+	"slices"
+)
+
+// Gates and windows of ITU-R BS.1770-4 and EBU Tech 3342, in LUFS, LU and blocks of 100 ms.
+const (
+	loudnessAbsoluteGate   = -70.0
+	loudnessRelativeGate   = -10.0
+	loudnessRangeGate      = -20.0
+	loudnessMomentaryBlock = 4
+	loudnessShortTermBlock = 30
+)
+
+// truePeakPhases are the coefficients of the 4x oversampling interpolation filter of ITU-R BS.1770-4, Annex 2.
+var truePeakPhases = [4][12]float64{
+	{0.0017089843750, 0.0109863281250, -0.0196533203125, 0.0332031250000, -0.0594482421875, 0.1373291015625,
+		0.9721679687500, -0.1022949218750, 0.0476074218750, -0.0266113281250, 0.0148925781250, -0.0083007812500},
+	{-0.0291748046875, 0.0292968750000, -0.0517578125000, 0.0891113281250, -0.1665039062500, 0.4650878906250,
+		0.7797851562500, -0.2003173828125, 0.1015625000000, -0.0582275390625, 0.0330810546875, -0.0189208984375},
+	{-0.0189208984375, 0.0330810546875, -0.0582275390625, 0.1015625000000, -0.2003173828125, 0.7797851562500,
+		0.4650878906250, -0.1665039062500, 0.0891113281250, -0.0517578125000, 0.0292968750000, -0.0291748046875},
+	{-0.0083007812500, 0.0148925781250, -0.0266113281250, 0.0476074218750, -0.1022949218750, 0.9721679687500,
+		0.1373291015625, -0.0594482421875, 0.0332031250000, -0.0196533203125, 0.0109863281250, 0.0017089843750},
+}
+
+// Loudness is the result of a loudness measurement, see LoudnessMeter.
+// Loudness is in LUFS, the range in LU and peaks in dBTP and dBFS. Silence is -Inf.
+type Loudness struct {
+	Integrated   float64
+	Range        float64
+	TruePeak     float64
+	SamplePeak   float64
+	MaxMomentary float64
+	MaxShortTerm float64
+}
+
+// biquad is a second order IIR filter in direct form I.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+
+	return y
+}
+
+// kWeighting returns the two stages of the K-weighting filter for the samplerate:
+// the high shelf modelling the head, and the RLB high-pass.
+func kWeighting(samplerate int) (shelf, highPass biquad) {
+	fs := float64(samplerate)
+
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / fs)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf = biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / fs)
+	a0 = 1 + k/q + k*k
+	highPass = biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	return shelf, highPass
+}
+
+// loudnessChannel is the state of a channel of the meter.
+type loudnessChannel struct {
+	shelf, highPass biquad
+
+	history [12]float64 // last samples, for the true-peak interpolation
+	sum     float64     // sum of squares of the current 100 ms block
+}
+
+// LoudnessMeter measures loudness according to EBU R128 and ITU-R BS.1770-4 in decoded samples,
+// given one after the other: K-weighted momentary (400 ms), short-term (3 s) and gated integrated loudness,
+// loudness range (EBU Tech 3342) and true-peak with 4x oversampling.
+type LoudnessMeter struct {
+	channels []loudnessChannel
+
+	blockSize  int // samples in 100 ms
+	blockCount int // samples in the current block
+
+	// Energies of the last 100 ms blocks, the newest last.
+	recent []float64
+	blocks int
+
+	momentary []float64 // energies of the momentary blocks, for the integrated loudness
+	shortTerm []float64 // energies of the short-term blocks, for the loudness range
+
+	maxMomentary float64
+	maxShortTerm float64
+	truePeak     float64
+	samplePeak   float64
+}
+
+// NewLoudnessMeter creates a meter of samples with the samplerate and 1 or 2 channels.
+// Mono uses the left channel of the samples.
+func NewLoudnessMeter(samplerate, channels int) *LoudnessMeter {
+	l := &LoudnessMeter{
+		channels:  make([]loudnessChannel, min(max(channels, 1), 2)),
+		blockSize: max(samplerate/10, 1),
+	}
+
+	for i := range l.channels {
+		l.channels[i].shelf, l.channels[i].highPass = kWeighting(samplerate)
+	}
+
+	return l
+}
+
+// Write adds the samples.
+func (l *LoudnessMeter) Write(samples *Samples) {
+	for i, frames := 0, samples.frames(); i < frames; i++ {
+		for ch := range l.channels {
+			c := &l.channels[ch]
+			x := float64(samples.f32(i, ch))
+
+			y := c.highPass.process(c.shelf.process(x))
+			c.sum += y * y
+
+			copy(c.history[1:], c.history[:11])
+			c.history[0] = x
+
+			l.samplePeak = max(l.samplePeak, math.Abs(x))
+			for _, phase := range truePeakPhases {
+				v := 0.0
+				for k, h := range phase {
+					v += h * c.history[k]
+				}
+				l.truePeak = max(l.truePeak, math.Abs(v))
+			}
+		}
+
+		l.blockCount++
+		if l.blockCount == l.blockSize {
+			l.endBlock()
+		}
+	}
+}
+
+// endBlock ends a block of 100 ms, which ends a momentary and a short-term block when there are enough of them.
+func (l *LoudnessMeter) endBlock() {
+	energy := 0.0
+	for ch := range l.channels {
+		energy += l.channels[ch].sum / float64(l.blockSize)
+		l.channels[ch].sum = 0
+	}
+	l.blockCount = 0
+
+	l.recent = append(l.recent, energy)
+	if len(l.recent) > loudnessShortTermBlock {
+		l.recent = l.recent[1:]
+	}
+	l.blocks++
+
+	if l.blocks >= loudnessMomentaryBlock {
+		e := mean(l.recent[len(l.recent)-loudnessMomentaryBlock:])
+		l.momentary = append(l.momentary, e)
+		l.maxMomentary = max(l.maxMomentary, e)
+	}
+
+	if l.blocks >= loudnessShortTermBlock {
+		e := mean(l.recent)
+		l.shortTerm = append(l.shortTerm, e)
+		l.maxShortTerm = max(l.maxShortTerm, e)
+	}
+}
+
+// Momentary returns the loudness of the last 400 ms in LUFS.
+func (l *LoudnessMeter) Momentary() float64 {
+	return energyLoudness(mean(l.recent[max(len(l.recent)-loudnessMomentaryBlock, 0):]))
+}
+
+// ShortTerm returns the loudness of the last 3 s in LUFS.
+func (l *LoudnessMeter) ShortTerm() float64 {
+	return energyLoudness(mean(l.recent))
+}
+
+// Integrated returns the gated loudness of all the samples so far in LUFS.
+func (l *LoudnessMeter) Integrated() float64 {
+	return energyLoudness(mean(gate(l.momentary, loudnessRelativeGate)))
+}
+
+// LoudnessRange returns the loudness range of all the samples so far in LU,
+// the spread of the gated short-term loudness between the 10th and the 95th percentile.
+func (l *LoudnessMeter) LoudnessRange() float64 {
+	blocks := gate(l.shortTerm, loudnessRangeGate)
+	if len(blocks) == 0 {
+		return 0
+	}
+
+	loudness := make([]float64, len(blocks))
+	for i, e := range blocks {
+		loudness[i] = energyLoudness(e)
+	}
+	slices.Sort(loudness)
+
+	percentile := func(p float64) float64 {
+		return loudness[int(math.Round(float64(len(loudness)-1)*p))]
+	}
+
+	return percentile(0.95) - percentile(0.10)
+}
+
+// TruePeak returns the largest true-peak of all the samples so far in dBTP.
+func (l *LoudnessMeter) TruePeak() float64 {
+	return 20 * math.Log10(l.truePeak)
+}
+
+// SamplePeak returns the largest absolute sample of all the samples so far in dBFS.
+func (l *LoudnessMeter) SamplePeak() float64 {
+	return 20 * math.Log10(l.samplePeak)
+}
+
+// Loudness returns the measurements of all the samples so far.
+func (l *LoudnessMeter) Loudness() Loudness {
+	return Loudness{
+		Integrated:   l.Integrated(),
+		Range:        l.LoudnessRange(),
+		TruePeak:     l.TruePeak(),
+		SamplePeak:   l.SamplePeak(),
+		MaxMomentary: energyLoudness(l.maxMomentary),
+		MaxShortTerm: energyLoudness(l.maxShortTerm),
+	}
+}
+
+// Loudness decodes the whole audio stream and returns its loudness, see LoudnessMeter.
+// The position is rewound before and after.
+func (m *MPEG) Loudness() *Loudness {
+	if !m.initDecoders() || m.audioPacketType == 0 {
+		return nil
+	}
+
+	meter := NewLoudnessMeter(m.Samplerate(), m.Channels())
+	m.scanAudio(meter.Write)
+
+	loudness := meter.Loudness()
+
+	return &loudness
+}
+
+// energyLoudness returns the loudness of the mean square energy in LUFS.
+func energyLoudness(energy float64) float64 {
+	return -0.691 + 10*math.Log10(energy)
+}
+
+// gate returns the blocks above the absolute gate and the relative gate, relative to the loudness
+// of the blocks above the absolute gate.
+func gate(blocks []float64, relative float64) []float64 {
+	var gated []float64
+	for _, e := range blocks {
+		if energyLoudness(e) >= loudnessAbsoluteGate {
+			gated = append(gated, e)
+		}
+	}
+
+	threshold := energyLoudness(mean(gated)) + relative
+
+	n := 0
+	for _, e := range gated {
+		if energyLoudness(e) >= threshold {
+			gated[n] = e
+			n++
+		}
+	}
+
+	return gated[:n]
+}
+
+// mean returns the mean of the values, 0 if there are none.
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+
+	return sum / float64(len(values))
+}
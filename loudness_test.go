@@ -0,0 +1,84 @@
+package mpeg_test
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/gen2brain/mpeg"
+)
+
+// sine returns stereo samples of a sine with the frequency, amplitude in dBFS and phase, at 48 kHz.
+func sine(seconds, frequency, dbfs, phase float64) []*mpeg.Samples {
+	amplitude := math.Pow(10, dbfs/20)
+
+	var chunks []*mpeg.Samples
+	for n := 0; n < int(seconds*48000); n += mpeg.SamplesPerFrame {
+		s := &mpeg.Samples{Interleaved: make([]float32, mpeg.SamplesPerFrame*2)}
+		for i := 0; i < mpeg.SamplesPerFrame; i++ {
+			v := float32(amplitude * math.Sin(2*math.Pi*frequency*float64(n+i)/48000+phase))
+			s.Interleaved[i*2], s.Interleaved[i*2+1] = v, v
+		}
+		chunks = append(chunks, s)
+	}
+
+	return chunks
+}
+
+func TestLoudness(t *testing.T) {
+	meter := func(chunks ...[]*mpeg.Samples) *mpeg.LoudnessMeter {
+		l := mpeg.NewLoudnessMeter(48000, 2)
+		for _, samples := range chunks {
+			for _, s := range samples {
+				l.Write(s)
+			}
+		}
+
+		return l
+	}
+
+	// EBU Tech 3341: a stereo sine of 1 kHz at -23 dBFS is -23 LUFS.
+	l := meter(sine(20, 1000, -23, 0))
+	if got := l.Integrated(); math.Abs(got+23) > 0.1 {
+		t.Errorf("Integrated: got %.2f LUFS, want -23", got)
+	}
+	if got := l.Momentary(); math.Abs(got+23) > 0.1 {
+		t.Errorf("Momentary: got %.2f LUFS, want -23", got)
+	}
+	if got := l.ShortTerm(); math.Abs(got+23) > 0.1 {
+		t.Errorf("ShortTerm: got %.2f LUFS, want -23", got)
+	}
+	if got := l.LoudnessRange(); got > 0.1 {
+		t.Errorf("LoudnessRange: got %.2f LU, want 0", got)
+	}
+
+	// EBU Tech 3342: 20 s at -20 dBFS, then 20 s at -30 dBFS, is a range of 10 LU.
+	l = meter(sine(20, 1000, -20, 0), sine(20, 1000, -30, 0))
+	if got := l.LoudnessRange(); math.Abs(got-10) > 1 {
+		t.Errorf("LoudnessRange: got %.2f LU, want 10", got)
+	}
+
+	// The peaks of a quarter of the samplerate fall between the samples.
+	l = meter(sine(1, 12000, 0, math.Pi/4))
+	if got := l.SamplePeak(); math.Abs(got+3.01) > 0.01 {
+		t.Errorf("SamplePeak: got %.2f dBFS, want -3.01", got)
+	}
+	if got := l.TruePeak(); got < -0.5 || got > 0.5 {
+		t.Errorf("TruePeak: got %.2f dBTP, want 0", got)
+	}
+
+	// Silence is below the gate.
+	l = meter([]*mpeg.Samples{{Interleaved: make([]float32, mpeg.SamplesPerFrame*2)}})
+	if got := l.Integrated(); !math.IsInf(got, -1) {
+		t.Errorf("Integrated: got %.2f LUFS for silence", got)
+	}
+
+	m, err := mpeg.New(bytes.NewReader(testMp2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loudness := m.Loudness()
+	if loudness == nil || loudness.Integrated < -40 || loudness.Integrated > -5 || loudness.TruePeak < loudness.SamplePeak || loudness.MaxMomentary < loudness.Integrated {
+		t.Errorf("Loudness: got %+v", loudness)
+	}
+}
@@ -0,0 +1,34 @@
+//go:build linux
+
+package mpeg
+
+import (
+	"os"
+	"syscall"
+)
+
+// NewBufferMmap maps the file read-only into memory and creates a buffer that reads it in place, see NewBufferBytes.
+// The file can be closed after. The returned function unmaps the memory, the buffer and the packets demuxed
+// from it must not be used after calling it.
+func NewBufferMmap(f *os.File) (*Buffer, func() error, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	size := fi.Size()
+	if int64(int(size)) != size {
+		return nil, nil, syscall.EFBIG
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	unmap := func() error {
+		return syscall.Munmap(data)
+	}
+
+	return NewBufferBytes(data), unmap, nil
+}
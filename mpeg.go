@@ -17,7 +17,8 @@
 //
 // Video data is decoded into a struct with all 3 planes (Y, Cb, Cr) stored in separate buffers,
 // you can get image.YCbCr via YCbCr() function. You can either convert to image.RGBA on the CPU (slow)
-// via the RGBA() function or do it on the GPU with the following matrix:
+// via the RGBA() function, convert to packed RGBA, BGRA, RGB24 or RGB565 pixels with a Converter,
+// or do it on the GPU with the following matrix:
 //
 //	mat4 bt601 = mat4(
 //	    1.16438,  0.00000,  1.59603, -0.87079,
@@ -40,6 +41,8 @@ package mpeg
 
 import (
 	"bytes"
+	"cmp"
+	"context"
 	"errors"
 	"io"
 	"time"
@@ -51,9 +54,13 @@ type VideoFunc func(mpeg *MPEG, frame *Frame)
 // AudioFunc callback function.
 type AudioFunc func(mpeg *MPEG, samples *Samples)
 
-// ErrInvalidMPEG is the error returned when the reader is not a valid MPEG Program Stream.
+// ErrInvalidMPEG is the error returned when the reader is not a valid MPEG Program Stream or elementary stream.
 var ErrInvalidMPEG = errors.New("invalid MPEG-PS")
 
+// ErrUnsupportedCodec is the error reported for valid MPEG data that is not MPEG-1 Video or MPEG-1 Audio Layer II,
+// e.g. MPEG-2 program streams and video, or MP3 audio.
+var ErrUnsupportedCodec = errors.New("unsupported codec")
+
 // MPEG is high-level interface implementation.
 type MPEG struct {
 	demux *Demux
@@ -75,32 +82,110 @@ type MPEG struct {
 	audioBuffer      *Buffer
 	audioDecoder     *Audio
 
+	videoTimeline timeline
+	audioTimeline timeline
+
+	ptsTimestamps bool
+	ptsBase       int64
+	hasPtsBase    bool
+
 	done chan bool
 
+	// Error of the last decode or seek, and whether a corrupt packet was skipped since.
+	err           error
+	corruptPacket bool
+
+	// Limits, the packets demuxed by the current decode or seek, whether they exceeded the
+	// steps and whether a packet over the limits was skipped.
+	limits        Limits
+	steps         int
+	exceeded      bool
+	skippedPacket bool
+
 	videoCallback VideoFunc
 	audioCallback AudioFunc
 }
 
 // New creates a new MPEG instance.
-func New(r io.Reader) (*MPEG, error) {
-	m := &MPEG{}
-
+// The source is either an MPEG Program Stream, a Video CD .dat file (see NewCDXAReader), or a raw
+// MPEG-1 video (.m1v) or MP2 audio (.mp2) elementary stream, see NewElementaryDemux.
+// Optional limits bound the resources used to decode untrusted streams, they apply to the demuxer,
+// the decoders and their buffers. Returns ErrLimitExceeded if the video dimensions exceed them.
+func New(r io.Reader, limits ...Limits) (*MPEG, error) {
 	buf, err := NewBuffer(r)
 	if err != nil {
 		return nil, err
 	}
 
+	buf.setLimits(limitsOf(limits))
 	buf.SetLoadCallback(buf.LoadReaderCallback)
 
 	if !buf.has(32) {
 		return nil, ErrInvalidMPEG
 	}
-	if !bytes.Equal([]byte{0x00, 0x00, 0x01, 0xBA}, buf.Bytes()[0:4]) {
+
+	// VCD .dat files wrap the program stream in CDXA sectors, start over with the payload.
+	if data := buf.Bytes(); isCDXA(data) {
+		src := io.MultiReader(bytes.NewReader(data), r)
+		if seeker, ok := r.(io.Seeker); ok {
+			if _, err := seeker.Seek(-int64(len(data)), io.SeekCurrent); err != nil {
+				return nil, err
+			}
+			src = r
+		}
+
+		cdxa, err := NewCDXAReader(src)
+		if err != nil {
+			return nil, err
+		}
+
+		if !cdxa.Seekable() {
+			return New(struct{ io.Reader }{cdxa}, limits...)
+		}
+
+		return New(cdxa, limits...)
+	}
+
+	return newMPEG(buf, limitsOf(limits))
+}
+
+// NewBytes creates a new MPEG instance that decodes data in place, see NewBufferBytes. The source and the
+// limits are the same as for New. The payload of Video CD .dat files is copied out of the sectors, see NewCDXAReader.
+func NewBytes(data []byte, limits ...Limits) (*MPEG, error) {
+	if len(data) < 4 {
 		return nil, ErrInvalidMPEG
 	}
-	buf.Rewind()
 
-	m.demux, err = NewDemux(buf)
+	if isCDXA(data) {
+		return New(bytes.NewReader(data), limits...)
+	}
+
+	return newMPEG(NewBufferBytes(data), limitsOf(limits))
+}
+
+// newMPEG creates an MPEG instance with a demuxer for the stream that starts in buf.
+func newMPEG(buf *Buffer, limits Limits) (*MPEG, error) {
+	m := &MPEG{}
+	m.limits = limits
+
+	var err error
+
+	// Program streams start with a pack header, raw video with a sequence header and raw audio with a frame sync.
+	header := buf.Bytes()[0:4]
+	switch {
+	case bytes.Equal([]byte{0x00, 0x00, 0x01, 0xBA}, header):
+		buf.Rewind()
+		m.demux, err = NewDemux(buf, m.limits)
+	case bytes.Equal([]byte{0x00, 0x00, 0x01, startSequence}, header):
+		m.demux, err = NewElementaryDemux(buf, PacketVideo1, m.limits)
+	case header[0] == 0xFF && header[1]&0xFE == 0xFC:
+		m.demux, err = NewElementaryDemux(buf, PacketAudio1, m.limits)
+	case header[0] == 0xFF && header[1]&0xE0 == 0xE0:
+		// Frame sync of another layer or version of MPEG Audio, like MP3.
+		return nil, ErrUnsupportedCodec
+	default:
+		return nil, ErrInvalidMPEG
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -111,6 +196,10 @@ func New(r io.Reader) (*MPEG, error) {
 	m.audioEnabled = true
 	m.initDecoders()
 
+	if m.videoDecoder != nil && m.videoDecoder.exceeded {
+		return nil, ErrLimitExceeded
+	}
+
 	return m, nil
 }
 
@@ -220,6 +309,15 @@ func (m *MPEG) Framerate() float64 {
 	return 0
 }
 
+// FramerateRational returns the exact framerate of the video stream as a fraction, e.g. 30000/1001.
+func (m *MPEG) FramerateRational() (num, den int) {
+	if m.initDecoders() && m.videoDecoder != nil {
+		return m.videoDecoder.FramerateRational()
+	}
+
+	return 0, 1
+}
+
 // Audio returns video decoder.
 func (m *MPEG) Audio() *Audio {
 	return m.audioDecoder
@@ -314,9 +412,58 @@ func (m *MPEG) Time() time.Duration {
 	return time.Duration(m.time * float64(time.Second))
 }
 
-// Duration returns the video duration of the underlying source.
+// Duration returns the video duration of the underlying source, or the audio duration if there is no video.
+// The first call reads parts of the source, the duration of a source with splices is estimated, see Demux.Duration.
 func (m *MPEG) Duration() time.Duration {
-	return time.Duration(m.demux.Duration(PacketVideo1) * float64(time.Second))
+	return time.Duration(m.demux.Duration(m.durationType()) * float64(time.Second))
+}
+
+// DurationTicks returns the video duration of the underlying source in ticks of ClockRate.
+func (m *MPEG) DurationTicks() int64 {
+	return m.demux.DurationTicks(m.durationType())
+}
+
+// durationType returns the packet type the duration is taken from.
+func (m *MPEG) durationType() int {
+	if m.demux.NumVideoStreams() == 0 && m.demux.NumAudioStreams() > 0 {
+		return PacketAudio1 + m.audioStreamIndex
+	}
+
+	return PacketVideo1
+}
+
+// Discontinuities returns the timestamp discontinuities (clock wraps and splices) found so far.
+// Decode keeps video and audio in sync across them.
+func (m *MPEG) Discontinuities() []Discontinuity {
+	return m.demux.Discontinuities()
+}
+
+// FindDiscontinuities reads the whole source to find all of its discontinuities, see Demux.FindDiscontinuities.
+func (m *MPEG) FindDiscontinuities() []Discontinuity {
+	return m.demux.FindDiscontinuities()
+}
+
+// BuildIndex reads the whole source and builds an index of the intra frames of the video stream,
+// which SeekFrame and Seek use from then on. This can only be used when the underlying reader is seekable.
+// Returns nil if no index could be built.
+func (m *MPEG) BuildIndex() *Index {
+	return m.demux.BuildIndex(PacketVideo1)
+}
+
+// Index returns the index used for seeking, nil if there is none.
+func (m *MPEG) Index() *Index {
+	return m.demux.Index()
+}
+
+// SetIndex sets the index used for seeking, e.g. one read from a sidecar file with ReadIndex.
+func (m *MPEG) SetIndex(index *Index) error {
+	return m.demux.SetIndex(index)
+}
+
+// Info reads the whole source, without decoding it, and returns a description of it and its streams.
+// This can only be used when the underlying Buffer is seekable, returns nil otherwise.
+func (m *MPEG) Info() *Info {
+	return m.demux.Info()
 }
 
 // Rewind rewinds all buffers back to the beginning.
@@ -332,6 +479,8 @@ func (m *MPEG) Rewind() {
 	m.demux.Rewind()
 	m.time = 0
 	m.hasEnded = false
+	m.videoTimeline = timeline{}
+	m.audioTimeline = timeline{}
 }
 
 // Loop returns looping.
@@ -344,6 +493,103 @@ func (m *MPEG) SetLoop(loop bool) {
 	m.loop = loop
 }
 
+// PtsTimestamps checks whether the times of frames and samples are taken from the presentation time stamps.
+func (m *MPEG) PtsTimestamps() bool {
+	return m.ptsTimestamps
+}
+
+// SetPtsTimestamps sets whether the times of frames and samples are taken from the presentation
+// time stamps of the packets, instead of counting decoded frames and samples. This keeps video and audio
+// in sync for sources with dropped frames or gaps. Frames without a time stamp continue counting from
+// the previous one. The times are relative to the start time of the video stream, or of the audio
+// stream if there is no video. Default false.
+func (m *MPEG) SetPtsTimestamps(enabled bool) {
+	m.ptsTimestamps = enabled
+
+	// On a seekable source the start time is known in advance, otherwise it is the first time stamp read.
+	if enabled && !m.hasPtsBase && m.demux.buf.Seekable() {
+		typ := PacketVideo1
+		if m.demux.NumVideoStreams() == 0 {
+			typ = PacketAudio1 + m.audioStreamIndex
+		}
+
+		if startTicks := m.demux.StartTicks(typ); startTicks != PacketInvalidTS {
+			m.ptsBase = startTicks
+			m.hasPtsBase = true
+		}
+	}
+}
+
+// Err returns the error of the last Decode, DecodeVideo, DecodeAudio, Seek or SeekFrame.
+// If they returned nil or false, this is nil at the end of the source, or the reason no frame
+// could be decoded: the error of the reader (see ErrRead), ErrUnsupportedCodec, ErrLimitExceeded or ErrNeedMoreData.
+// If a frame was decoded, this reports damaged data: ErrCorruptSlice if a picture was damaged,
+// ErrCorruptPacket if a packet was skipped, nil otherwise. See Video.Err, Audio.Err and Demux.Err.
+// For DecodeContext, SeekContext and SeekFrameContext, this is ctx.Err() if the context was done.
+func (m *MPEG) Err() error {
+	return m.err
+}
+
+// decodeErr returns the error of a decode or seek with the decoder error err, and whether it decoded anything.
+// Failures of the reader come first, they are the cause of any other error.
+func (m *MPEG) decodeErr(err error, decoded bool) error {
+	corruptPacket := m.corruptPacket && decoded
+	m.corruptPacket = false
+
+	// Running out of steps only matters if nothing was decoded, a skipped packet always does.
+	exceeded := m.exceeded && !decoded || m.skippedPacket
+	m.exceeded = false
+	m.skippedPacket = false
+
+	switch {
+	case m.demux.buf.Err() != nil:
+		return m.demux.buf.Err()
+	case m.demux.unsupported:
+		return ErrUnsupportedCodec
+	case exceeded:
+		return ErrLimitExceeded
+	case err != nil:
+		return err
+	case corruptPacket:
+		return ErrCorruptPacket
+	}
+
+	return nil
+}
+
+// loadContext makes the decoder buffers read packets until ctx is done, the returned function
+// restores the previous callbacks, so that calls of the *Context methods can be nested.
+func (m *MPEG) loadContext(ctx context.Context) (restore func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+
+	var video, audio LoadFunc
+	if m.videoBuffer != nil {
+		video = m.videoBuffer.loadCallback
+		m.videoBuffer.SetLoadCallback(func(*Buffer) {
+			m.readPackets(ctx, m.videoPacketType)
+		})
+	}
+
+	if m.audioBuffer != nil {
+		audio = m.audioBuffer.loadCallback
+		m.audioBuffer.SetLoadCallback(func(*Buffer) {
+			m.readPackets(ctx, m.audioPacketType)
+		})
+	}
+
+	return func() {
+		if m.videoBuffer != nil {
+			m.videoBuffer.SetLoadCallback(video)
+		}
+
+		if m.audioBuffer != nil {
+			m.audioBuffer.SetLoadCallback(audio)
+		}
+	}
+}
+
 // HasEnded checks whether the file has ended.
 // If looping is enabled, this will always return false.
 func (m *MPEG) HasEnded() bool {
@@ -354,10 +600,17 @@ func (m *MPEG) HasEnded() bool {
 // This will call the video_decode_callback and audio_decode_callback any number of times.
 // A frame-skip is not implemented, i.e. everything up to current time will be decoded.
 func (m *MPEG) Decode(tick time.Duration) {
+	m.decode(context.Background(), tick)
+}
+
+// decode is Decode, stopping between packets and pictures once ctx is done.
+func (m *MPEG) decode(ctx context.Context, tick time.Duration) {
 	if !m.initDecoders() {
 		return
 	}
 
+	defer m.loadContext(ctx)()
+
 	decodeVideo := m.videoCallback != nil && m.videoPacketType != 0
 	decodeAudio := m.audioCallback != nil && m.audioPacketType != 0
 
@@ -370,30 +623,39 @@ func (m *MPEG) Decode(tick time.Duration) {
 	decodeVideoFailed := false
 	decodeAudioFailed := false
 
+	didDecodeAny := false
+	m.corruptPacket = false
+	m.steps = 0
+	var err error
+
 	videoTargetTime := m.time + tick.Seconds()
 	audioTargetTime := m.time + tick.Seconds() + m.audioLeadTime
 
-	for {
+	for ctx.Err() == nil {
 		didDecode = false
 
 		if decodeVideo && m.videoDecoder.Time() < videoTargetTime {
-			frame := m.videoDecoder.Decode()
+			frame := m.decodeVideo()
 			if frame != nil {
 				m.videoCallback(m, frame)
 				didDecode = true
+				didDecodeAny = true
 			} else {
 				decodeVideoFailed = true
 			}
+			err = cmp.Or(err, m.videoDecoder.Err())
 		}
 
 		if decodeAudio && m.audioDecoder.Time() < audioTargetTime {
-			samples := m.audioDecoder.Decode()
+			samples := m.decodeAudio()
 			if samples != nil {
 				m.audioCallback(m, samples)
 				didDecode = true
+				didDecodeAny = true
 			} else {
 				decodeAudioFailed = true
 			}
+			err = cmp.Or(err, m.audioDecoder.Err())
 		}
 
 		if !didDecode {
@@ -401,6 +663,15 @@ func (m *MPEG) Decode(tick time.Duration) {
 		}
 	}
 
+	m.err = m.decodeErr(err, didDecodeAny)
+
+	// The time is not reached, the next call continues decoding up to it.
+	if err := ctx.Err(); err != nil {
+		m.err = err
+
+		return
+	}
+
 	if (!decodeVideo || decodeVideoFailed) && (!decodeAudio || decodeAudioFailed) && m.demux.HasEnded() {
 		m.handleEnd()
 
@@ -410,10 +681,21 @@ func (m *MPEG) Decode(tick time.Duration) {
 	m.time += tick.Seconds()
 }
 
+// DecodeContext is like Decode, but stops between packets and pictures once ctx is done, without advancing
+// the internal timer. Returns the error of the call, see Err, which is ctx.Err() if ctx is done.
+func (m *MPEG) DecodeContext(ctx context.Context, tick time.Duration) error {
+	m.err = nil
+	m.decode(ctx, tick)
+
+	return m.err
+}
+
 // DecodeVideo decodes and returns one video frame. Returns nil if no frame could be decoded
-// (either because the source ended or data is corrupt). If you only want to decode video, you should
+// (either because the source ended or data is corrupt, see Err). If you only want to decode video, you should
 // disable audio via SetAudioEnabled(). The returned Frame is valid until the next call to DecodeVideo().
 func (m *MPEG) DecodeVideo() *Frame {
+	m.err = nil
+
 	if !m.initDecoders() {
 		return nil
 	}
@@ -422,7 +704,10 @@ func (m *MPEG) DecodeVideo() *Frame {
 		return nil
 	}
 
-	frame := m.videoDecoder.Decode()
+	m.corruptPacket = false
+	m.steps = 0
+	frame := m.decodeVideo()
+	m.err = m.decodeErr(m.videoDecoder.Err(), frame != nil)
 	if frame != nil {
 		m.time = frame.Time
 	} else if m.demux.HasEnded() {
@@ -433,9 +718,11 @@ func (m *MPEG) DecodeVideo() *Frame {
 }
 
 // DecodeAudio decodes and returns one audio frame. Returns nil if no frame could be decoded
-// (either because the source ended or data is corrupt). If you only want to decode audio, you should
+// (either because the source ended or data is corrupt, see Err). If you only want to decode audio, you should
 // disable video via SetVideoEnabled(). The returned Samples is valid until the next call to DecodeAudio().
 func (m *MPEG) DecodeAudio() *Samples {
+	m.err = nil
+
 	if !m.initDecoders() {
 		return nil
 	}
@@ -444,7 +731,10 @@ func (m *MPEG) DecodeAudio() *Samples {
 		return nil
 	}
 
-	samples := m.audioDecoder.Decode()
+	m.corruptPacket = false
+	m.steps = 0
+	samples := m.decodeAudio()
+	m.err = m.decodeErr(m.audioDecoder.Err(), samples != nil)
 	if samples != nil {
 		m.time = samples.Time
 	} else if m.demux.HasEnded() {
@@ -456,8 +746,29 @@ func (m *MPEG) DecodeAudio() *Samples {
 
 // SeekFrame seeks, similar to Seek(), but will not call the VideoFunc callback,
 // AudioFunc callback or make any attempts to sync audio.
-// Returns the found frame or nil if no frame could be found.
+// Returns the found frame or nil if no frame could be found, see Err.
 func (m *MPEG) SeekFrame(tm time.Duration, seekExact bool) *Frame {
+	return m.SeekFrameTicks(secondsToTicks(tm.Seconds()), seekExact)
+}
+
+// SeekFrameContext is like SeekFrame, but stops between packets and pictures once ctx is done
+// and returns nil. Returns the error of the call, see Err, which is ctx.Err() if ctx is done.
+func (m *MPEG) SeekFrameContext(ctx context.Context, tm time.Duration, seekExact bool) (*Frame, error) {
+	frame := m.seekFrame(ctx, secondsToTicks(tm.Seconds()), seekExact)
+
+	return frame, m.err
+}
+
+// SeekFrameTicks seeks, similar to SeekFrame(), to the specified time in ticks of ClockRate.
+// If seekExact is true, the found frame is the first one with Ticks at or after the specified time.
+func (m *MPEG) SeekFrameTicks(ticks int64, seekExact bool) *Frame {
+	return m.seekFrame(context.Background(), ticks, seekExact)
+}
+
+// seekFrame is SeekFrameTicks, stopping between packets and pictures once ctx is done and returning nil.
+func (m *MPEG) seekFrame(ctx context.Context, ticks int64, seekExact bool) *Frame {
+	m.err = nil
+
 	if !m.initDecoders() {
 		return nil
 	}
@@ -466,18 +777,24 @@ func (m *MPEG) SeekFrame(tm time.Duration, seekExact bool) *Frame {
 		return nil
 	}
 
+	defer m.loadContext(ctx)()
+
 	typ := m.videoPacketType
-	startTime := m.demux.StartTime(typ)
-	duration := m.demux.Duration(typ)
+	startTicks := m.demux.StartTicks(typ)
+	duration := m.demux.durationTicks(ctx, typ)
 
-	if tm.Seconds() < 0 {
-		tm = time.Duration(0)
-	} else if tm.Seconds() > duration {
-		tm = time.Duration(duration * float64(time.Second))
+	if ticks < 0 {
+		ticks = 0
+	} else if ticks > duration {
+		ticks = duration
 	}
 
-	packet := m.demux.Seek(tm.Seconds(), typ, true)
+	m.corruptPacket = false
+	m.steps = 0
+	packet := m.demux.seek(ctx, ticks, typ, true)
 	if packet == nil {
+		m.err = cmp.Or(ctx.Err(), m.decodeErr(nil, false))
+
 		return nil
 	}
 
@@ -486,15 +803,28 @@ func (m *MPEG) SeekFrame(tm time.Duration, seekExact bool) *Frame {
 	m.audioPacketType = 0
 
 	// Clear video buffer and decode the found packet
+	packetTicks := packet.PtsTicks - startTicks
 	m.videoDecoder.Rewind()
-	m.videoDecoder.SetTime(packet.Pts - startTime)
+	m.videoDecoder.SetTicks(packetTicks)
+	m.videoTimeline = timeline{}
+	m.videoTimeline.mark(packet, m.videoBuffer)
+
+	// The PTS of the packet is the time of the first frame decoded from it, which is set above. With PTS
+	// timestamps, writing it would set it on the intra frame, which follows leading B-frames in display order.
 	m.videoBuffer.Write(packet.Data)
 	frame := m.videoDecoder.Decode()
 
+	// The leading B-frames of an open GOP are predicted from the frames before the intra frame, which
+	// were not decoded. Skip them without counting their time, the intra frame has the time of the packet.
+	for frame != nil && m.videoDecoder.pictureType == pictureTypeB && ctx.Err() == nil {
+		m.videoDecoder.SetTicks(packetTicks)
+		frame = m.videoDecoder.Decode()
+	}
+
 	// If we want to seek to an exact frame, we have to decode all frames
 	// on top of the intra frame we just jumped to.
 	if seekExact {
-		for frame != nil && frame.Time < tm.Seconds() {
+		for frame != nil && frame.Ticks < ticks && ctx.Err() == nil {
 			frame = m.videoDecoder.Decode()
 		}
 	}
@@ -502,6 +832,12 @@ func (m *MPEG) SeekFrame(tm time.Duration, seekExact bool) *Frame {
 	// Enable writing to the audio buffer again
 	m.audioPacketType = prevAudioPacketType
 
+	// The frame decoded so far is not the one seeked to.
+	if ctx.Err() != nil {
+		frame = nil
+	}
+
+	m.err = cmp.Or(ctx.Err(), m.decodeErr(m.videoDecoder.Err(), frame != nil))
 	if frame != nil {
 		m.time = frame.Time
 	}
@@ -516,13 +852,31 @@ func (m *MPEG) SeekFrame(tm time.Duration, seekExact bool) *Frame {
 // If seekExact is true this will seek to the exact time, otherwise it will
 // seek to the last intra frame just before the desired time. Exact seeking can
 // be slow, because all frames up to the seeked one have to be decoded on top of
-// the previous intra frame.
+// the previous intra frame. Frames before the first intra frame can not be seeked to.
 // If seeking succeeds, this function will call the VideoFunc callback
 // exactly once with the target frame. If audio is enabled, it will also call
 // the AudioFunc callback any number of times, until the audioLeadTime is satisfied.
-// Returns true if seeking succeeded or false if no frame could be found.
+// Returns true if seeking succeeded or false if no frame could be found, see Err.
 func (m *MPEG) Seek(tm time.Duration, seekExact bool) bool {
-	frame := m.SeekFrame(tm, seekExact)
+	return m.SeekTicks(secondsToTicks(tm.Seconds()), seekExact)
+}
+
+// SeekContext is like Seek, but stops between packets and pictures once ctx is done and returns false.
+// Returns the error of the call, see Err, which is ctx.Err() if ctx is done.
+func (m *MPEG) SeekContext(ctx context.Context, tm time.Duration, seekExact bool) (bool, error) {
+	ok := m.seek(ctx, secondsToTicks(tm.Seconds()), seekExact)
+
+	return ok, m.err
+}
+
+// SeekTicks seeks, similar to Seek(), to the specified time in ticks of ClockRate.
+func (m *MPEG) SeekTicks(ticks int64, seekExact bool) bool {
+	return m.seek(context.Background(), ticks, seekExact)
+}
+
+// seek is SeekTicks, stopping between packets and pictures once ctx is done and returning false.
+func (m *MPEG) seek(ctx context.Context, ticks int64, seekExact bool) bool {
+	frame := m.seekFrame(ctx, ticks, seekExact)
 
 	if frame == nil {
 		return false
@@ -541,37 +895,45 @@ func (m *MPEG) Seek(tm time.Duration, seekExact bool) bool {
 	// with a PTS greater than the current time is found. Decode() is then
 	// called to decode enough audio data to satisfy the audioLeadTime.
 
-	startTime := m.demux.StartTime(m.videoPacketType)
+	startTicks := m.demux.StartTicks(m.videoPacketType)
 	m.audioDecoder.Rewind()
+	m.audioTimeline = timeline{}
 
-	for {
+	for ctx.Err() == nil {
 		packet := m.demux.Decode()
 		if packet == nil {
 			break
 		}
 
 		if packet.Type == m.videoPacketType {
-			m.videoBuffer.Write(packet.Data)
-		} else if packet.Type == m.audioPacketType && packet.Pts-startTime > m.time {
-			m.audioDecoder.SetTime(packet.Pts - startTime)
-			m.audioBuffer.Write(packet.Data)
+			m.writePacket(packet, m.videoBuffer, &m.videoTimeline)
+		} else if packet.Type == m.audioPacketType && packet.PtsTicks-startTicks > frame.Ticks {
+			m.audioDecoder.SetTicks(packet.PtsTicks - startTicks)
+			m.writePacket(packet, m.audioBuffer, &m.audioTimeline)
 
 			// Disable writing to the audio buffer while decoding video
 			prevAudioPacketType := m.audioPacketType
 			m.audioPacketType = 0
 
-			m.Decode(0)
+			m.decode(ctx, 0)
 
 			// Enable writing to the audio buffer again
 			m.audioPacketType = prevAudioPacketType
 
 			// Decode audio
-			m.Decode(0)
+			m.decode(ctx, 0)
 
 			break
 		}
 	}
 
+	// Audio is not synced up.
+	if err := ctx.Err(); err != nil {
+		m.err = err
+
+		return false
+	}
+
 	return true
 }
 
@@ -597,7 +959,7 @@ func (m *MPEG) initDecoders() bool {
 			}
 
 			m.videoBuffer.SetLoadCallback(m.readVideoPacket)
-			m.videoDecoder = NewVideo(m.videoBuffer)
+			m.videoDecoder = NewVideo(m.videoBuffer, m.limits)
 		}
 	}
 
@@ -613,6 +975,7 @@ func (m *MPEG) initDecoders() bool {
 			}
 
 			m.audioBuffer.SetLoadCallback(m.readAudioPacket)
+			m.audioBuffer.setLimits(m.limits)
 			m.audioDecoder = NewAudio(m.audioBuffer)
 		}
 	}
@@ -627,29 +990,99 @@ func (m *MPEG) handleEnd() {
 		m.Rewind()
 	} else {
 		m.hasEnded = true
-		m.done <- true
+
+		// Do not block when the end is reached again before done was received.
+		select {
+		case m.done <- true:
+		default:
+		}
 	}
 }
 
+// decodeVideo decodes one video frame, keeping the decoder time in sync across splices.
+// With time stamps written to the buffer, the decoder takes the time from them.
+func (m *MPEG) decodeVideo() *Frame {
+	if t, ok := m.videoTimeline.sync(m.videoBuffer.tell(), m.videoDecoder.Ticks()); ok && !m.ptsTimestamps {
+		m.videoDecoder.SetTicks(t)
+	}
+
+	return m.videoDecoder.Decode()
+}
+
+// decodeAudio decodes one audio frame, keeping the decoder time in sync across splices.
+// With time stamps written to the buffer, the decoder takes the time from them.
+func (m *MPEG) decodeAudio() *Samples {
+	if t, ok := m.audioTimeline.sync(m.audioBuffer.tell(), m.audioDecoder.Ticks()); ok && !m.ptsTimestamps {
+		m.audioDecoder.SetTicks(t)
+	}
+
+	return m.audioDecoder.Decode()
+}
+
+// writePacket writes the packet data to the decoder buffer, with its time stamp if enabled.
+func (m *MPEG) writePacket(packet *Packet, buf *Buffer, tl *timeline) {
+	tl.mark(packet, buf)
+
+	if !m.ptsTimestamps || packet.PtsTicks == PacketInvalidTS {
+		buf.Write(packet.Data)
+
+		return
+	}
+
+	if !m.hasPtsBase {
+		m.ptsBase = packet.PtsTicks
+		m.hasPtsBase = true
+	}
+
+	buf.WritePts(packet.Data, packet.PtsTicks-m.ptsBase)
+}
+
 func (m *MPEG) readVideoPacket(buffer *Buffer) {
-	m.readPackets(m.videoPacketType)
+	m.readPackets(context.Background(), m.videoPacketType)
 }
 
 func (m *MPEG) readAudioPacket(buffer *Buffer) {
-	m.readPackets(m.audioPacketType)
+	m.readPackets(context.Background(), m.audioPacketType)
 }
 
-func (m *MPEG) readPackets(requestedType int) {
+func (m *MPEG) readPackets(ctx context.Context, requestedType int) {
 	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		m.steps++
+		if !m.limits.steps(m.steps) {
+			m.exceeded = true
+
+			return
+		}
+
 		packet := m.demux.Decode()
 		if packet == nil {
+			// Skip the corrupt packet, the decoders resync on the data of the next one.
+			if m.demux.Err() == ErrCorruptPacket {
+				m.corruptPacket = true
+
+				continue
+			}
+
+			// Skip the packet over the limits, or continue after the start codes over the steps of the demuxer.
+			if m.demux.Err() == ErrLimitExceeded && m.demux.buf.Err() == nil {
+				if m.demux.currentPacket.length != 0 {
+					m.skippedPacket = true
+				}
+
+				continue
+			}
+
 			break
 		}
 
 		if packet.Type == m.videoPacketType {
-			m.videoBuffer.Write(packet.Data)
+			m.writePacket(packet, m.videoBuffer, &m.videoTimeline)
 		} else if packet.Type == m.audioPacketType {
-			m.audioBuffer.Write(packet.Data)
+			m.writePacket(packet, m.audioBuffer, &m.audioTimeline)
 		}
 
 		if packet.Type == requestedType {
@@ -667,3 +1100,66 @@ func (m *MPEG) readPackets(requestedType int) {
 		}
 	}
 }
+
+// timeline keeps the time of a decoder on the timeline of the demuxer across splices.
+// The decoders count frames and samples, so a stream that is shorter or longer than the
+// others before a splice would be out of sync after it. The PTS of the first packet written
+// to the decoder buffer sets the origin of the decoder time, the first packet after a splice
+// moves the decoder time to its PTS.
+// All times are in ticks of ClockRate.
+type timeline struct {
+	origin    int64
+	hasOrigin bool
+
+	// Pending packet, by position in the decoder buffer.
+	pos     int
+	pts     int64
+	splice  bool
+	pending bool
+
+	// Position and time of the decoder before the previous frame.
+	prevPos  int
+	prevTime int64
+}
+
+// mark records the packet that is about to be written to buf.
+func (tl *timeline) mark(packet *Packet, buf *Buffer) {
+	if packet.PtsTicks == PacketInvalidTS || (tl.hasOrigin || tl.pending) && !packet.Discontinuity {
+		return
+	}
+
+	tl.pos = buf.tell() + buf.Remaining()
+	tl.pts = packet.PtsTicks
+	tl.splice = packet.Discontinuity
+	tl.pending = true
+}
+
+// sync is called with the read position of the decoder buffer and the decoder time before
+// decoding a frame, and returns the corrected time and whether it changed.
+func (tl *timeline) sync(pos int, t int64) (int64, bool) {
+	if !tl.pending || pos < tl.pos {
+		tl.prevPos, tl.prevTime = pos, t
+
+		return t, false
+	}
+	tl.pending = false
+
+	// Frames and packets are not aligned, take the time of the frame that started closest to the packet.
+	at := t
+	if tl.pos-tl.prevPos < pos-tl.pos {
+		at = tl.prevTime
+	}
+
+	changed := false
+	if tl.splice && tl.hasOrigin {
+		t = tl.pts - tl.origin + t - at
+		changed = true
+	} else if !tl.hasOrigin {
+		tl.origin = tl.pts - at
+		tl.hasOrigin = true
+	}
+
+	tl.prevPos, tl.prevTime = pos, t
+
+	return t, changed
+}
@@ -0,0 +1,55 @@
+//go:build linux
+
+package mpeg_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gen2brain/mpeg"
+)
+
+func TestBufferMmap(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.mpg")
+	if err := os.WriteFile(name, testMpg, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, unmap, err := mpeg.NewBufferMmap(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := unmap(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	// The mapping outlives the file.
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := mpeg.NewDemux(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packets := 0
+	for d.Decode() != nil {
+		packets++
+	}
+	if packets != 180 || d.Err() != nil {
+		t.Errorf("Decode: got %d packets and error %v, want %d", packets, d.Err(), 180)
+	}
+
+	if int(d.Duration(mpeg.PacketVideo1)) != 9 {
+		t.Errorf("Duration: got %v, want %d", d.Duration(mpeg.PacketVideo1), 9)
+	}
+}
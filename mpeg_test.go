@@ -2,10 +2,14 @@ package mpeg_test
 
 import (
 	"bytes"
+	"context"
 	_ "embed"
 	"encoding/binary"
+	"errors"
 	"hash/fnv"
+	"io"
 	"math"
+	"slices"
 	"testing"
 	"time"
 
@@ -132,6 +136,293 @@ func TestDemuxStartTimeDuration(t *testing.T) {
 	}
 }
 
+func newDemux(t *testing.T, data []byte) *mpeg.Demux {
+	t.Helper()
+
+	buf, err := mpeg.NewBuffer(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.SetLoadCallback(buf.LoadReaderCallback)
+
+	d, err := mpeg.NewDemux(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return d
+}
+
+func TestPtsTimestamps(t *testing.T) {
+	decodeAll := func(data []byte, pts bool) (video, audio []int64) {
+		m, err := mpeg.New(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.SetPtsTimestamps(pts)
+		m.SetVideoCallback(func(_ *mpeg.MPEG, f *mpeg.Frame) { video = append(video, f.Ticks) })
+		m.SetAudioCallback(func(_ *mpeg.MPEG, s *mpeg.Samples) { audio = append(audio, s.Ticks) })
+		for !m.HasEnded() {
+			m.Decode(100 * time.Millisecond)
+		}
+
+		return video, audio
+	}
+
+	// Without gaps, the time stamps match the counted times, B-frames included.
+	video, audio := decodeAll(testMpg, false)
+	ptsVideo, ptsAudio := decodeAll(testMpg, true)
+	if !slices.Equal(video, ptsVideo) {
+		t.Errorf("video: got %v, want %v", ptsVideo, video)
+	}
+	if len(ptsAudio) != len(audio) {
+		t.Fatalf("audio: got %d samples, want %d", len(ptsAudio), len(audio))
+	}
+	lastAudio := ptsAudio[len(ptsAudio)-1]
+
+	// Drop about a second of packs from the middle.
+	const packSize = 2048
+	data := append(bytes.Clone(testMpg[:80*packSize]), testMpg[100*packSize:]...)
+
+	droppedVideo, _ := decodeAll(data, false)
+	if last := droppedVideo[len(droppedVideo)-1]; last > video[len(video)-1]-mpeg.ClockRate/2 {
+		t.Fatalf("counted video ends at %d, want well before %d", last, video[len(video)-1])
+	}
+
+	// The time stamps skip the gap, so both streams still end where they did.
+	ptsVideo, ptsAudio = decodeAll(data, true)
+	if got, want := ptsVideo[len(ptsVideo)-1], video[len(video)-1]; got != want {
+		t.Errorf("video ends at %d, want %d", got, want)
+	}
+	if got := ptsAudio[len(ptsAudio)-1]; got < lastAudio-2351 || got > lastAudio+2351 {
+		t.Errorf("audio ends at %d, want %d", got, lastAudio)
+	}
+
+	gaps := 0
+	for i := 1; i < len(ptsVideo); i++ {
+		if ptsVideo[i] < ptsVideo[i-1] {
+			t.Fatalf("frame %d: %d after %d", i, ptsVideo[i], ptsVideo[i-1])
+		}
+		if ptsVideo[i]-ptsVideo[i-1] > 3000 {
+			gaps++
+		}
+	}
+	if gaps == 0 {
+		t.Error("video: no gap in the time stamps")
+	}
+}
+
+// TestSeekOpenGOP checks that seeks without exact decoding return the intra frames, and not the
+// B-frames before them, which are predicted from frames that were not decoded.
+func TestSeekOpenGOP(t *testing.T) {
+	seq, err := mpeg.New(bytes.NewReader(testMpg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq.SetAudioEnabled(false)
+
+	hashes := make(map[int64]uint64)
+	for frame := seq.DecodeVideo(); frame != nil; frame = seq.DecodeVideo() {
+		h := fnv.New64a()
+		h.Write(frame.Y.Data)
+		hashes[frame.Ticks] = h.Sum64()
+	}
+
+	for _, indexed := range []bool{false, true} {
+		m, err := mpeg.New(bytes.NewReader(testMpg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if indexed {
+			m.BuildIndex()
+		}
+
+		for ms := 1000; ms < 9000; ms += 250 {
+			tm := time.Duration(ms) * time.Millisecond
+
+			frame := m.SeekFrame(tm, false)
+			if frame == nil {
+				t.Fatalf("indexed %v, SeekFrame(%v, false): frame is nil", indexed, tm)
+			}
+			h := fnv.New64a()
+			h.Write(frame.Y.Data)
+			if want, ok := hashes[frame.Ticks]; !ok || h.Sum64() != want {
+				t.Errorf("indexed %v, SeekFrame(%v, false): frame at %d ticks differs from sequential decoding", indexed, tm, frame.Ticks)
+			}
+		}
+	}
+}
+
+// errReader returns the data of r, then err instead of io.EOF.
+type errReader struct {
+	r   io.Reader
+	err error
+}
+
+func (e *errReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err == io.EOF {
+		return n, e.err
+	}
+
+	return n, err
+}
+
+// damage returns a copy of data, with fn called on the data from the n-th start code with the code.
+func damage(data []byte, code byte, n int, fn func(p []byte)) []byte {
+	data = bytes.Clone(data)
+	for i := 0; i < len(data)-4; i++ {
+		if data[i] == 0x00 && data[i+1] == 0x00 && data[i+2] == 0x01 && data[i+3] == code {
+			if n--; n == 0 {
+				fn(data[i:])
+
+				break
+			}
+		}
+	}
+
+	return data
+}
+
+func TestErr(t *testing.T) {
+	decodeVideo := func(t *testing.T, data []byte, r io.Reader) (frames, damaged int, err error) {
+		t.Helper()
+
+		if r == nil {
+			r = bytes.NewReader(data)
+		}
+		m, err := mpeg.New(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.SetAudioEnabled(false)
+
+		for frame := m.DecodeVideo(); frame != nil; frame = m.DecodeVideo() {
+			frames++
+			if m.Err() != nil {
+				damaged++
+			}
+		}
+
+		return frames, damaged, m.Err()
+	}
+
+	t.Run("end", func(t *testing.T) {
+		if frames, damaged, err := decodeVideo(t, testMpg, nil); frames != 278 || damaged != 0 || err != nil {
+			t.Errorf("DecodeVideo: got %d frames, %d damaged and error %v", frames, damaged, err)
+		}
+
+		d := newDemux(t, testMpg)
+		for d.Decode() != nil {
+		}
+		if err := d.Err(); err != nil {
+			t.Errorf("Demux.Err: got %v at the end", err)
+		}
+
+		m, err := mpeg.New(bytes.NewReader(testMp2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for m.DecodeAudio() != nil {
+		}
+		if err := m.Err(); err != nil {
+			t.Errorf("DecodeAudio: got error %v at the end", err)
+		}
+	})
+
+	t.Run("read", func(t *testing.T) {
+		errDisk := errors.New("disk failed")
+		r := &errReader{bytes.NewReader(testMpg), errDisk}
+
+		frames, _, err := decodeVideo(t, nil, r)
+		if frames != 278 || !errors.Is(err, mpeg.ErrRead) || !errors.Is(err, errDisk) {
+			t.Errorf("DecodeVideo: got %d frames and error %v, want %v", frames, err, errDisk)
+		}
+	})
+
+	t.Run("need more data", func(t *testing.T) {
+		buf, err := mpeg.NewBuffer(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(testMpeg1video[:len(testMpeg1video)/2])
+
+		video := mpeg.NewVideo(buf)
+		frames := 0
+		for video.Decode() != nil {
+			frames++
+		}
+		if !errors.Is(video.Err(), mpeg.ErrNeedMoreData) {
+			t.Errorf("Video.Err: got %v, want %v", video.Err(), mpeg.ErrNeedMoreData)
+		}
+
+		buf.Write(testMpeg1video[len(testMpeg1video)/2:])
+		buf.SignalEnd()
+		for video.Decode() != nil {
+			frames++
+		}
+		if frames != 260 || video.Err() != nil {
+			t.Errorf("Video.Decode: got %d frames and error %v at the end", frames, video.Err())
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		mp3 := append([]byte{0xFF, 0xFB, 0x90, 0x64}, make([]byte, 64)...)
+		if _, err := mpeg.New(bytes.NewReader(mp3)); !errors.Is(err, mpeg.ErrUnsupportedCodec) {
+			t.Errorf("New: got error %v for MP3, want %v", err, mpeg.ErrUnsupportedCodec)
+		}
+
+		// MPEG-2 pack headers start with 01.
+		ps2 := damage(testMpg, 0xBA, 1, func(p []byte) { p[4] = 0x44 })
+		if _, err := mpeg.New(bytes.NewReader(ps2)); !errors.Is(err, mpeg.ErrUnsupportedCodec) {
+			t.Errorf("New: got error %v for MPEG-2 PS, want %v", err, mpeg.ErrUnsupportedCodec)
+		}
+
+		// A sequence extension follows the sequence header of MPEG-2 Video.
+		end := bytes.Index(testMpeg1video[4:], []byte{0x00, 0x00, 0x01}) + 4
+		m2v := slices.Concat(testMpeg1video[:end], []byte{0x00, 0x00, 0x01, 0xB5, 0x14, 0x8A, 0x00, 0x01, 0x00, 0x00}, testMpeg1video[end:])
+		m, err := mpeg.New(bytes.NewReader(m2v))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame := m.DecodeVideo(); frame != nil || !errors.Is(m.Err(), mpeg.ErrUnsupportedCodec) {
+			t.Errorf("DecodeVideo: got error %v for MPEG-2 Video, want %v", m.Err(), mpeg.ErrUnsupportedCodec)
+		}
+	})
+
+	t.Run("corrupt slice", func(t *testing.T) {
+		data := damage(testMpg, mpeg.PacketVideo1, 20, func(p []byte) {
+			for i := 200; i < 232; i++ {
+				p[i] = 0xFF
+			}
+		})
+
+		frames, damaged, err := decodeVideo(t, data, nil)
+		if frames < 270 || damaged != 1 || err != nil {
+			t.Errorf("DecodeVideo: got %d frames, %d damaged and error %v", frames, damaged, err)
+		}
+	})
+
+	t.Run("corrupt packet", func(t *testing.T) {
+		// The PTS marker 0010 of the packet header becomes 0001.
+		data := damage(testMpg, mpeg.PacketVideo1, 20, func(p []byte) { p[13] = 0x11 })
+
+		frames, damaged, err := decodeVideo(t, data, nil)
+		if frames < 270 || damaged != 1 || err != nil {
+			t.Errorf("DecodeVideo: got %d frames, %d damaged and error %v", frames, damaged, err)
+		}
+
+		d := newDemux(t, data)
+		packets := 0
+		for d.Decode() != nil {
+			packets++
+		}
+		if !errors.Is(d.Err(), mpeg.ErrCorruptPacket) {
+			t.Errorf("Demux.Err: got %v after %d packets, want %v", d.Err(), packets, mpeg.ErrCorruptPacket)
+		}
+	})
+}
+
 func TestAudio(t *testing.T) {
 	buf, err := mpeg.NewBuffer(bytes.NewReader(testMp2))
 	if err != nil {
@@ -460,6 +751,323 @@ func TestSeekVideoCallbackOnce(t *testing.T) {
 	}
 }
 
+// countContext is done after its Err was checked n times.
+type countContext struct {
+	context.Context
+	n int
+}
+
+func (c *countContext) Err() error {
+	if c.n--; c.n < 0 {
+		return context.Canceled
+	}
+
+	return nil
+}
+
+// Done is never closed, but it is not nil, like the channel of a context that can be canceled.
+func (c *countContext) Done() <-chan struct{} {
+	return make(chan struct{})
+}
+
+func TestContext(t *testing.T) {
+	t.Run("decode", func(t *testing.T) {
+		m, err := mpeg.New(bytes.NewReader(testMpg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.SetAudioEnabled(false)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		frames := 0
+		m.SetVideoCallback(func(_ *mpeg.MPEG, _ *mpeg.Frame) {
+			if frames++; frames == 3 {
+				cancel()
+			}
+		})
+
+		if err := m.DecodeContext(ctx, 2*time.Second); !errors.Is(err, context.Canceled) || frames != 3 {
+			t.Errorf("DecodeContext: got %d frames and error %v, want %v", frames, err, context.Canceled)
+		}
+		if m.Time() != 0 {
+			t.Errorf("DecodeContext: time advanced to %v", m.Time())
+		}
+
+		if err := m.DecodeContext(context.Background(), 2*time.Second); err != nil || frames != 60 {
+			t.Errorf("DecodeContext: got %d frames and error %v", frames, err)
+		}
+	})
+
+	t.Run("nested", func(t *testing.T) {
+		m, err := mpeg.New(bytes.NewReader(testMpg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.SetAudioEnabled(false)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// The call in the callback has a context of its own, the one of the outer call stays canceled.
+		frames := 0
+		m.SetVideoCallback(func(m *mpeg.MPEG, _ *mpeg.Frame) {
+			if frames++; frames == 3 {
+				cancel()
+				_ = m.DecodeContext(context.Background(), 0)
+			}
+		})
+
+		if err := m.DecodeContext(ctx, 2*time.Second); !errors.Is(err, context.Canceled) || frames != 3 {
+			t.Errorf("DecodeContext: got %d frames and error %v, want %v", frames, err, context.Canceled)
+		}
+	})
+
+	t.Run("seek frame", func(t *testing.T) {
+		m, err := mpeg.New(bytes.NewReader(testMpg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.SetAudioEnabled(false)
+
+		want := m.SeekFrame(5*time.Second, true).Ticks
+
+		for _, n := range []int{0, 2, 20} {
+			frame, err := m.SeekFrameContext(&countContext{context.Background(), n}, 5*time.Second, true)
+			if frame != nil || !errors.Is(err, context.Canceled) || !errors.Is(m.Err(), context.Canceled) {
+				t.Errorf("SeekFrameContext: got error %v after %d checks, want %v", err, n, context.Canceled)
+			}
+		}
+
+		frame, err := m.SeekFrameContext(context.Background(), 5*time.Second, true)
+		if frame == nil || err != nil || frame.Ticks != want {
+			t.Errorf("SeekFrameContext: got error %v, want frame at %d ticks", err, want)
+		}
+	})
+
+	t.Run("seek splice", func(t *testing.T) {
+		// The first seek of a spliced source samples its timestamps, finds them going backwards and
+		// reads all of it to find the splices. Both can be canceled, after 5 and 40 checks.
+		data := append(bytes.Clone(testMpg), testMpg...)
+
+		want, err := mpeg.New(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want.SetAudioEnabled(false)
+		wantFrame := want.SeekFrame(12*time.Second, true)
+
+		for _, n := range []int{5, 40} {
+			m, err := mpeg.New(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			m.SetAudioEnabled(false)
+
+			frame, err := m.SeekFrameContext(&countContext{context.Background(), n}, 12*time.Second, true)
+			if frame != nil || !errors.Is(err, context.Canceled) {
+				t.Errorf("SeekFrameContext: got error %v after %d checks, want %v", err, n, context.Canceled)
+			}
+			if len(m.Discontinuities()) != 0 {
+				t.Errorf("Discontinuities: got %+v after %d checks, want the scan canceled before the splice", m.Discontinuities(), n)
+			}
+
+			frame, err = m.SeekFrameContext(context.Background(), 12*time.Second, true)
+			if frame == nil || err != nil || len(m.Discontinuities()) != 1 {
+				t.Fatalf("SeekFrameContext: got error %v and discontinuities %+v, want a frame after the splice", err, m.Discontinuities())
+			}
+			if frame.Ticks != wantFrame.Ticks {
+				t.Errorf("SeekFrameContext: got %d ticks after %d checks, want %d", frame.Ticks, n, wantFrame.Ticks)
+			}
+		}
+	})
+
+	t.Run("seek", func(t *testing.T) {
+		m, err := mpeg.New(bytes.NewReader(testMpg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.SetVideoCallback(func(_ *mpeg.MPEG, _ *mpeg.Frame) {})
+		m.SetAudioCallback(func(_ *mpeg.MPEG, _ *mpeg.Samples) {})
+
+		ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+		defer cancel()
+
+		if ok, err := m.SeekContext(ctx, 3*time.Second, false); ok || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("SeekContext: got %v and error %v, want %v", ok, err, context.DeadlineExceeded)
+		}
+
+		if ok, err := m.SeekContext(context.Background(), 3*time.Second, false); !ok || err != nil {
+			t.Errorf("SeekContext: got %v and error %v", ok, err)
+		}
+	})
+}
+
+func TestTicks(t *testing.T) {
+	// Rewrite the picture rate of the sequence header to 29.97 (30000/1001).
+	data := bytes.Clone(testMpeg1video)
+	i := bytes.Index(data, []byte{0x00, 0x00, 0x01, 0xB3})
+	data[i+7] = data[i+7]&0xF0 | 0x04
+
+	buf, err := mpeg.NewBuffer(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.SetLoadCallback(buf.LoadReaderCallback)
+
+	video := mpeg.NewVideo(buf)
+	if num, den := video.FramerateRational(); num != 30000 || den != 1001 {
+		t.Errorf("FramerateRational: got %d/%d, want 30000/1001", num, den)
+	}
+
+	// Far into the stream the time is still exact.
+	const hour = 107892 // frames
+	video.SetTicks(3003 * hour)
+	n := hour
+	for frame := video.Decode(); frame != nil; frame = video.Decode() {
+		if frame.Ticks != int64(n)*3003 {
+			t.Fatalf("frame %d: got %d ticks, want %d", n, frame.Ticks, int64(n)*3003)
+		}
+		n++
+	}
+	if n == hour {
+		t.Error("Decode: no frames")
+	}
+
+	m, err := mpeg.New(bytes.NewReader(testMpg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if num, den := m.FramerateRational(); num != 30 || den != 1 {
+		t.Errorf("FramerateRational: got %d/%d, want 30/1", num, den)
+	}
+
+	// Seek to a tick off the frame grid, the next frame is returned.
+	frame := m.SeekFrameTicks(7*mpeg.ClockRate+1, true)
+	if frame == nil {
+		t.Fatal("SeekFrameTicks: frame is nil")
+	}
+	if frame.Ticks != 7*mpeg.ClockRate+3000 {
+		t.Errorf("SeekFrameTicks: got %d ticks, want %d", frame.Ticks, 7*mpeg.ClockRate+3000)
+	}
+
+	samples := m.DecodeAudio()
+	if samples == nil {
+		t.Fatal("DecodeAudio: samples is nil")
+	}
+	if math.Abs(samples.Time-float64(samples.Ticks)/mpeg.ClockRate) > 1.0/mpeg.ClockRate {
+		t.Errorf("DecodeAudio: time %f does not match %d ticks", samples.Time, samples.Ticks)
+	}
+
+	d := newDemux(t, testMpg)
+	for {
+		packet := d.Decode()
+		if packet == nil {
+			break
+		}
+		if packet.Pts == mpeg.PacketInvalidTS != (packet.PtsTicks == mpeg.PacketInvalidTS) ||
+			packet.Pts != mpeg.PacketInvalidTS && packet.Pts != float64(packet.PtsTicks)/mpeg.ClockRate {
+			t.Fatalf("packet: pts %f does not match %d ticks", packet.Pts, packet.PtsTicks)
+		}
+	}
+}
+
+// addSeeds adds short prefixes of the data as seeds to the fuzz target, about a packet and a few packets,
+// which the fuzzer mutates much faster than whole files.
+func addSeeds(f *testing.F, data ...[]byte) {
+	for _, d := range data {
+		f.Add(d[:min(len(d), 256)])
+		f.Add(d[:min(len(d), 1024)])
+	}
+}
+
+func FuzzDemux(f *testing.F) {
+	addSeeds(f, testMpg)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		buf, err := mpeg.NewBuffer(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.SetLoadCallback(buf.LoadReaderCallback)
+
+		d, err := mpeg.NewDemux(buf)
+		if err != nil {
+			return
+		}
+
+		for packets := 0; packets <= len(data); packets++ {
+			if d.Decode() == nil && !errors.Is(d.Err(), mpeg.ErrCorruptPacket) {
+				break
+			}
+		}
+
+		d.Duration(mpeg.PacketVideo1)
+		d.Seek(d.Duration(mpeg.PacketVideo1)/2, mpeg.PacketVideo1, true)
+	})
+}
+
+func FuzzVideo(f *testing.F) {
+	addSeeds(f, testMpeg1video)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		buf, err := mpeg.NewBuffer(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(data)
+		buf.SignalEnd()
+
+		video := mpeg.NewVideo(buf)
+		for frames := 0; frames <= len(data); frames++ {
+			if video.Decode() == nil {
+				break
+			}
+		}
+	})
+}
+
+func FuzzAudio(f *testing.F) {
+	addSeeds(f, testMp2)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		buf, err := mpeg.NewBuffer(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(data)
+		buf.SignalEnd()
+
+		audio := mpeg.NewAudio(buf)
+		for frames := 0; frames <= len(data); frames++ {
+			if audio.Decode() == nil {
+				break
+			}
+		}
+	})
+}
+
+func FuzzMPEG(f *testing.F) {
+	addSeeds(f, testMpg, testMpeg1video, testMp2)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		m, err := mpeg.New(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		for frames := 0; frames <= len(data); frames++ {
+			frame, samples := m.DecodeVideo(), m.DecodeAudio()
+			if frame == nil && samples == nil {
+				break
+			}
+		}
+
+		m.SeekFrame(m.Duration()/2, true)
+	})
+}
+
 func BenchmarkDecodeVideo(b *testing.B) {
 	mpg, err := mpeg.New(bytes.NewReader(testMpg))
 	if err != nil {
@@ -0,0 +1,84 @@
+// Package poster registers MPEG-1 video with the image package, so that image.Decode returns a
+// poster frame of program streams (.mpg) and raw video elementary streams (.m1v).
+//
+// It is typically imported for its side effects only:
+//
+//	import _ "github.com/gen2brain/mpeg/poster"
+//
+// The poster frame is the first intra frame, DecodeTime decodes the one at another time.
+package poster
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"time"
+
+	"github.com/gen2brain/mpeg"
+)
+
+// ErrNoFrame is the error returned when the source has no video frame to decode.
+var ErrNoFrame = errors.New("no video frame")
+
+func init() {
+	image.RegisterFormat("mpeg", "\x00\x00\x01\xba", Decode, DecodeConfig)
+	image.RegisterFormat("mpeg", "\x00\x00\x01\xb3", Decode, DecodeConfig)
+}
+
+// Decode decodes the first intra frame from r, reading it only as far as that frame.
+func Decode(r io.Reader) (image.Image, error) {
+	return DecodeTime(r, 0)
+}
+
+// DecodeTime decodes the intra frame at or just before tm from r. The first intra frame is decoded as r is read,
+// later ones need seeking: r is then read into memory as a whole first if it is not an io.ReadSeeker.
+func DecodeTime(r io.Reader, tm time.Duration) (image.Image, error) {
+	if _, ok := r.(io.ReadSeeker); !ok && tm > 0 {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+
+	m, err := mpeg.New(r)
+	if err != nil {
+		return nil, err
+	}
+	m.SetAudioEnabled(false)
+
+	var frame *mpeg.Frame
+	if tm > 0 {
+		frame = m.SeekFrame(tm, false)
+	} else {
+		// The leading B-frames of an open GOP are predicted from frames before the stream, skip them.
+		frame = m.DecodeVideo()
+		for frame != nil && !frame.Intra() {
+			frame = m.DecodeVideo()
+		}
+	}
+
+	if frame == nil {
+		return nil, errors.Join(ErrNoFrame, m.Err())
+	}
+
+	return frame.YCbCr(), nil
+}
+
+// DecodeConfig returns the color model and the dimensions of the video from its sequence header,
+// without decoding any frame.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	m, err := mpeg.New(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	m.SetAudioEnabled(false)
+
+	if m.Width() == 0 || m.Height() == 0 {
+		return image.Config{}, ErrNoFrame
+	}
+
+	return image.Config{ColorModel: color.YCbCrModel, Width: m.Width(), Height: m.Height()}, nil
+}
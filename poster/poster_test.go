@@ -0,0 +1,80 @@
+package poster_test
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gen2brain/mpeg"
+	"github.com/gen2brain/mpeg/poster"
+)
+
+func TestDecode(t *testing.T) {
+	data, err := os.ReadFile("../testdata/test.mpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "mpeg" || config.Width != 160 || config.Height != 120 {
+		t.Errorf("DecodeConfig: got %q, %dx%d", format, config.Width, config.Height)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "mpeg" || img.Bounds() != image.Rect(0, 0, 160, 120) {
+		t.Errorf("Decode: got %q, %v", format, img.Bounds())
+	}
+
+	// The poster frame at a time is the intra frame before it, the first one is decoded without seeking.
+	m, err := mpeg.New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tm := range []time.Duration{0, 5 * time.Second} {
+		want := m.SeekFrame(tm, false).YCbCr()
+
+		r := &countReader{r: bytes.NewReader(data)}
+		img, err := poster.DecodeTime(r, tm)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tm == 0 && r.n >= len(data) {
+			t.Errorf("DecodeTime %v: read %d bytes, want less than %d", tm, r.n, len(data))
+		}
+
+		got := img.(*image.YCbCr)
+		for y := 0; y < 120; y++ {
+			if !bytes.Equal(got.Y[got.YOffset(0, y):][:160], want.Y[want.YOffset(0, y):][:160]) {
+				t.Fatalf("DecodeTime %v: row %d differs", tm, y)
+			}
+		}
+	}
+
+	if _, _, err := image.Decode(bytes.NewReader([]byte("\x00\x00\x01\xba"))); err == nil {
+		t.Error("Decode: got no error for a truncated stream")
+	}
+}
+
+// countReader counts the bytes read from r, it is not an io.Seeker.
+type countReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+
+	return n, err
+}
@@ -0,0 +1,135 @@
+package mpeg
+
+import (
+	"container/list"
+	"errors"
+	"io"
+)
+
+var (
+	// ReaderAtBlockSize is the size of the blocks read by buffers created with NewBufferReaderAt.
+	ReaderAtBlockSize = 64 * 1024
+
+	// ReaderAtCacheBlocks is the number of blocks cached by each buffer created with NewBufferReaderAt.
+	ReaderAtCacheBlocks = 64
+)
+
+var (
+	errReaderAtSize        = errors.New("invalid ReaderAt size")
+	errReaderAtInvalidSeek = errors.New("invalid ReaderAt seek position")
+)
+
+// readerAt reads an io.ReaderAt as an io.ReadSeeker by blocks, which are kept in an LRU cache,
+// so seeking back to data that was read before does not read it again.
+type readerAt struct {
+	r    io.ReaderAt
+	size int64
+	off  int64
+
+	blockSize int64
+	maxBlocks int
+
+	// Cached blocks by index, and their order of use, the most recent first.
+	blocks map[int64]*list.Element
+	lru    *list.List
+}
+
+// block is the data of a block, shorter than the block size at the end.
+type block struct {
+	index int64
+	data  []byte
+}
+
+func newReaderAt(r io.ReaderAt, size int64) *readerAt {
+	return &readerAt{
+		r:         r,
+		size:      size,
+		blockSize: int64(max(ReaderAtBlockSize, 1)),
+		maxBlocks: max(ReaderAtCacheBlocks, 1),
+		blocks:    make(map[int64]*list.Element),
+		lru:       list.New(),
+	}
+}
+
+// Read reads from the cached blocks, and reads missing blocks from the io.ReaderAt.
+func (r *readerAt) Read(p []byte) (int, error) {
+	if r.off >= r.size {
+		return 0, io.EOF
+	}
+
+	n := 0
+	for n < len(p) && r.off < r.size {
+		data, err := r.block(r.off / r.blockSize)
+
+		// Data read before an error is used too.
+		if offset := r.off % r.blockSize; offset < int64(len(data)) {
+			c := copy(p[n:], data[offset:])
+			n += c
+			r.off += int64(c)
+		}
+
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// Seek sets the offset of the next Read.
+func (r *readerAt) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errReaderAtInvalidSeek
+	}
+
+	if offset < 0 {
+		return 0, errReaderAtInvalidSeek
+	}
+
+	r.off = offset
+
+	return offset, nil
+}
+
+// block returns the data of the block with index, from the cache if possible.
+func (r *readerAt) block(index int64) ([]byte, error) {
+	if e, ok := r.blocks[index]; ok {
+		r.lru.MoveToFront(e)
+
+		return e.Value.(*block).data, nil
+	}
+
+	// Reuse the least recently used block once the cache is full.
+	var b *block
+	if r.lru.Len() >= r.maxBlocks {
+		e := r.lru.Back()
+		b = r.lru.Remove(e).(*block)
+		delete(r.blocks, b.index)
+	} else {
+		b = &block{data: make([]byte, r.blockSize)}
+	}
+
+	off := index * r.blockSize
+	data := b.data[:min(r.blockSize, r.size-off)]
+
+	n, err := r.r.ReadAt(data, off)
+	if n < len(data) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return data[:n], err
+	}
+
+	b.index = index
+	b.data = data
+	r.blocks[index] = r.lru.PushFront(b)
+
+	return data, nil
+}
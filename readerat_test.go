@@ -0,0 +1,144 @@
+package mpeg_test
+
+import (
+	"bytes"
+	"hash/fnv"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gen2brain/mpeg"
+)
+
+// countingReaderAt stands in for a backend fetching byte ranges, it counts the bytes read.
+type countingReaderAt struct {
+	r     io.ReaderAt
+	bytes atomic.Int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.bytes.Add(int64(n))
+
+	return n, err
+}
+
+func TestBufferReaderAt(t *testing.T) {
+	// packets returns the packets of the demuxer, hashed.
+	packets := func(t *testing.T, d *mpeg.Demux) []uint64 {
+		t.Helper()
+
+		var sums []uint64
+		for packet := d.Decode(); packet != nil; packet = d.Decode() {
+			h := fnv.New64a()
+			h.Write(packet.Data)
+			sums = append(sums, h.Sum64())
+		}
+		if d.Err() != nil {
+			t.Error(d.Err())
+		}
+
+		return sums
+	}
+
+	newDemuxReaderAt := func(t *testing.T, r io.ReaderAt) *mpeg.Demux {
+		t.Helper()
+
+		buf, err := mpeg.NewBufferReaderAt(r, int64(len(testMpg)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d, err := mpeg.NewDemux(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return d
+	}
+
+	want := packets(t, newDemux(t, testMpg))
+
+	t.Run("cache", func(t *testing.T) {
+		r := &countingReaderAt{r: bytes.NewReader(testMpg)}
+		d := newDemuxReaderAt(t, r)
+
+		if got := packets(t, d); !slices.Equal(got, want) {
+			t.Errorf("Decode: got %d packets, want %d", len(got), len(want))
+		}
+
+		if int(d.Duration(mpeg.PacketVideo1)) != 9 {
+			t.Errorf("Duration: got %v", d.Duration(mpeg.PacketVideo1))
+		}
+		for _, tm := range []float64{8, 2, 5, 0.5, 7} {
+			if d.Seek(tm, mpeg.PacketVideo1, true) == nil {
+				t.Errorf("Seek: no packet at %v", tm)
+			}
+		}
+
+		// Each block is read once.
+		if n := r.bytes.Load(); n != int64(len(testMpg)) {
+			t.Errorf("ReadAt: read %d bytes, want %d", n, len(testMpg))
+		}
+	})
+
+	t.Run("eviction", func(t *testing.T) {
+		defer func(size, blocks int) {
+			mpeg.ReaderAtBlockSize, mpeg.ReaderAtCacheBlocks = size, blocks
+		}(mpeg.ReaderAtBlockSize, mpeg.ReaderAtCacheBlocks)
+		mpeg.ReaderAtBlockSize, mpeg.ReaderAtCacheBlocks = 1000, 3
+
+		r := &countingReaderAt{r: bytes.NewReader(testMpg)}
+		d := newDemuxReaderAt(t, r)
+
+		if got := packets(t, d); !slices.Equal(got, want) {
+			t.Errorf("Decode: got %d packets, want %d", len(got), len(want))
+		}
+
+		d.Rewind()
+		if got := packets(t, d); !slices.Equal(got, want) {
+			t.Errorf("Decode after Rewind: got %d packets, want %d", len(got), len(want))
+		}
+		if n := r.bytes.Load(); n != 2*int64(len(testMpg)) {
+			t.Errorf("ReadAt: read %d bytes, want %d", n, 2*len(testMpg))
+		}
+	})
+
+	t.Run("short", func(t *testing.T) {
+		buf, err := mpeg.NewBufferReaderAt(bytes.NewReader(testMpg[:len(testMpg)/2]), int64(len(testMpg)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d, err := mpeg.NewDemux(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for d.Decode() != nil {
+		}
+		if !d.HasEnded() {
+			t.Error("HasEnded: got false at the end of the data")
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		r := &countingReaderAt{r: bytes.NewReader(testMpg)}
+
+		var wg sync.WaitGroup
+		for range 4 {
+			d := newDemuxReaderAt(t, r)
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				if got := packets(t, d); !slices.Equal(got, want) {
+					t.Errorf("Decode: got %d packets, want %d", len(got), len(want))
+				}
+			}()
+		}
+		wg.Wait()
+	})
+}
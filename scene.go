@@ -0,0 +1,118 @@
+package mpeg
+
+// defaultSceneThreshold is the confidence from which a change is a shot boundary, if no threshold is set.
+const defaultSceneThreshold = 0.4
+
+// sceneBins is the number of bins of the luma histograms compared between frames.
+const sceneBins = 64
+
+// SceneChange is a shot boundary, at the first frame of the new shot.
+// Confidence is between 0 and 1, the larger of the luma histogram difference to the previous frame
+// and the ratio of intra-coded macroblocks of predicted pictures, which are coded like new content.
+type SceneChange struct {
+	Time       float64
+	Ticks      int64
+	Confidence float64
+}
+
+// SceneDetector detects shot boundaries in decoded frames, given one after the other in display order.
+type SceneDetector struct {
+	threshold float64
+
+	histogram [sceneBins]float64
+	hasPrev   bool
+}
+
+// NewSceneDetector creates a detector of shot boundaries with a confidence of at least threshold,
+// or a default threshold of 0.4 if it is 0.
+func NewSceneDetector(threshold float64) *SceneDetector {
+	if threshold <= 0 {
+		threshold = defaultSceneThreshold
+	}
+
+	return &SceneDetector{threshold: threshold}
+}
+
+// Reset forgets the previous frame, e.g. after seeking.
+func (s *SceneDetector) Reset() {
+	s.hasPrev = false
+}
+
+// Write compares the frame to the previous one and returns the shot boundary if the frame starts a new shot.
+func (s *SceneDetector) Write(frame *Frame) (SceneChange, bool) {
+	var histogram [sceneBins]float64
+	if frame.Width > 0 && frame.Height > 0 {
+		for y := 0; y < frame.Height; y++ {
+			for _, v := range frame.Y.Data[y*frame.Y.Width:][:frame.Width] {
+				histogram[v/(256/sceneBins)]++
+			}
+		}
+
+		n := float64(frame.Width * frame.Height)
+		for i := range histogram {
+			histogram[i] /= n
+		}
+	}
+
+	prev, hasPrev := s.histogram, s.hasPrev
+	s.histogram, s.hasPrev = histogram, true
+
+	if !hasPrev {
+		return SceneChange{}, false
+	}
+
+	// Half the sum of the differences of normalized histograms is between 0 and 1.
+	confidence := 0.0
+	for i := range histogram {
+		d := histogram[i] - prev[i]
+		if d < 0 {
+			d = -d
+		}
+		confidence += d
+	}
+	confidence /= 2
+
+	// Predicted pictures code what can not be predicted from the reference frames as intra macroblocks.
+	if frame.pictureType == pictureTypePredictive || frame.pictureType == pictureTypeB {
+		if macroblocks := (frame.Y.Width >> 4) * (frame.Y.Height >> 4); macroblocks > 0 {
+			confidence = max(confidence, float64(frame.intraMacroblocks)/float64(macroblocks))
+		}
+	}
+
+	if confidence < s.threshold {
+		return SceneChange{}, false
+	}
+
+	return SceneChange{Time: frame.Time, Ticks: frame.Ticks, Confidence: min(confidence, 1)}, true
+}
+
+// Scan decodes the remaining frames of the video and returns the shot boundaries found.
+func (s *SceneDetector) Scan(v *Video) []SceneChange {
+	var changes []SceneChange
+	for frame := v.Decode(); frame != nil; frame = v.Decode() {
+		if change, ok := s.Write(frame); ok {
+			changes = append(changes, change)
+		}
+	}
+
+	return changes
+}
+
+// SceneChanges decodes the whole video stream and returns the shot boundaries with a confidence of at least threshold,
+// see NewSceneDetector. The position is rewound before and after.
+func (m *MPEG) SceneChanges(threshold float64) []SceneChange {
+	if !m.initDecoders() || m.videoPacketType == 0 {
+		return nil
+	}
+
+	detector := NewSceneDetector(threshold)
+
+	var changes []SceneChange
+	m.scanVideo(func(frame *Frame) {
+		if change, ok := detector.Write(frame); ok {
+			changes = append(changes, change)
+		}
+	})
+
+	return changes
+}
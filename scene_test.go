@@ -0,0 +1,51 @@
+package mpeg_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gen2brain/mpeg"
+)
+
+func TestSceneChanges(t *testing.T) {
+	m, err := mpeg.New(bytes.NewReader(testMpg))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The clip is a single shot.
+	if changes := m.SceneChanges(0); len(changes) != 0 {
+		t.Errorf("SceneChanges: got %+v, want none", changes)
+	}
+	if changes := m.SceneChanges(0.01); len(changes) == 0 {
+		t.Error("SceneChanges: got none with a low threshold")
+	}
+	if frame := m.DecodeVideo(); frame == nil || frame.Ticks != 0 {
+		t.Errorf("DecodeVideo: got %+v, want the first frame", frame)
+	}
+
+	// A cut to white and back is two shot boundaries.
+	white := &mpeg.Frame{Time: 10, Ticks: 10 * mpeg.ClockRate, Width: 160, Height: 120,
+		Y: mpeg.Plane{Width: 160, Height: 128, Data: bytes.Repeat([]byte{235}, 160*128)}}
+
+	buf, err := mpeg.NewBuffer(bytes.NewReader(testMpeg1video))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.SetLoadCallback(buf.LoadReaderCallback)
+	video := mpeg.NewVideo(buf)
+
+	detector := mpeg.NewSceneDetector(0)
+	for i := 0; i < 10; i++ {
+		if change, ok := detector.Write(video.Decode()); ok {
+			t.Errorf("Write: got %+v, want none", change)
+		}
+	}
+
+	if change, ok := detector.Write(white); !ok || change.Ticks != white.Ticks || change.Confidence < 0.9 {
+		t.Errorf("Write: got %+v, %v, want a cut to white", change, ok)
+	}
+	if changes := detector.Scan(video); len(changes) != 1 || changes[0].Ticks != 10*3000 {
+		t.Errorf("Scan: got %+v, want a cut back at %d", changes, 10*3000)
+	}
+}
@@ -0,0 +1,225 @@
+package mpeg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Thumbnail is a downscaled copy of a decoded frame, with the time of the frame in seconds and ticks of ClockRate.
+type Thumbnail struct {
+	Image image.Image
+	Time  float64
+	Ticks int64
+}
+
+// Thumbnails returns n thumbnails, evenly spaced over the duration of the video, at the middle of n equal parts.
+// The images are independent of the decoder, scaled down to maxWidth pixels wide if the video is wider
+// and maxWidth is not 0. Each thumbnail is the intra frame just before its time, found with fast keyframe seeking,
+// which uses the index if there is one. If the intra frame is before the part, the thumbnail is the first frame
+// of the part. Near-black frames, like fades, are skipped for the next frame that is not black, up to the time
+// of the next thumbnail.
+// This can only be used when the underlying Buffer is seekable, returns nil otherwise.
+// The position is restored afterwards, without calling the callbacks.
+func (m *MPEG) Thumbnails(n, maxWidth int) []Thumbnail {
+	if n <= 0 || !m.demux.buf.Seekable() || !m.initDecoders() || m.videoDecoder == nil {
+		return nil
+	}
+	defer m.restore(m.time)
+
+	width, height := m.Width(), m.Height()
+	if maxWidth > 0 && maxWidth < width {
+		width, height = maxWidth, max(height*maxWidth/width, 1)
+	}
+
+	duration := m.DurationTicks()
+	step := duration / int64(n)
+
+	thumbnails := make([]Thumbnail, 0, n)
+	for i := 0; i < n; i++ {
+		ticks := step*int64(i) + step/2
+
+		// Without an index, seeking may find an intra frame well before the part, the frames up to it are decoded.
+		frame := m.SeekFrameTicks(ticks, false)
+		for frame != nil && frame.Ticks < step*int64(i) {
+			frame = m.videoDecoder.Decode()
+		}
+
+		frame = skipBlack(frame, m.videoDecoder.Decode, ticks+step)
+		if frame == nil {
+			continue
+		}
+
+		thumbnails = append(thumbnails, Thumbnail{
+			Image: scaleRGBA(frame.RGBA(), width, height),
+			Time:  frame.Time,
+			Ticks: frame.Ticks,
+		})
+	}
+
+	return thumbnails
+}
+
+// restore seeks back to the time in seconds after decoding for another purpose, or rewinds if it is 0.
+// The callbacks are not called, decoding continues after the frame at the time.
+func (m *MPEG) restore(tm float64) {
+	if tm == 0 {
+		m.Rewind()
+
+		return
+	}
+
+	videoCallback, audioCallback := m.videoCallback, m.audioCallback
+	m.videoCallback, m.audioCallback = nil, nil
+	defer func() {
+		m.videoCallback, m.audioCallback = videoCallback, audioCallback
+	}()
+
+	m.SeekTicks(secondsToTicks(tm), true)
+}
+
+// skipBlack returns frame, or if it is black the first frame after it that is not, reading them with next.
+// Frames are black as for a BlackDetector with the default threshold. Frames from endTicks are not used,
+// the last black frame is returned if all are black.
+func skipBlack(frame *Frame, next func() *Frame, endTicks int64) *Frame {
+	for frame != nil && isBlack(frame, blackLuma) {
+		n := next()
+		if n == nil || n.Ticks >= endTicks {
+			break
+		}
+		frame = n
+	}
+
+	return frame
+}
+
+// scaleRGBA returns a copy of src scaled to width and height, averaging the pixels of src each new pixel covers.
+func scaleRGBA(src *image.RGBA, width, height int) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := b.Min.Y + y*b.Dy()/height
+		y1 := max(b.Min.Y+(y+1)*b.Dy()/height, y0+1)
+
+		for x := 0; x < width; x++ {
+			x0 := b.Min.X + x*b.Dx()/width
+			x1 := max(b.Min.X+(x+1)*b.Dx()/width, x0+1)
+
+			var r, g, bl, a, count int
+			for sy := y0; sy < y1; sy++ {
+				p := src.Pix[src.PixOffset(x0, sy):src.PixOffset(x1, sy)]
+				for i := 0; i < len(p); i += 4 {
+					r += int(p[i])
+					g += int(p[i+1])
+					bl += int(p[i+2])
+					a += int(p[i+3])
+					count++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / count)
+			dst.Pix[i+1] = uint8(g / count)
+			dst.Pix[i+2] = uint8(bl / count)
+			dst.Pix[i+3] = uint8(a / count)
+		}
+	}
+
+	return dst
+}
+
+// contactSheetSpacing is the space around and between the thumbnails of a contact sheet, in pixels.
+const contactSheetSpacing = 4
+
+// ContactSheet tiles the thumbnails left to right and top to bottom into a single image, with the number of columns.
+// If labels is true, the time of every thumbnail is printed in its lower left corner.
+// Thumbnails are placed in cells the size of the largest one, on a black background.
+func ContactSheet(thumbnails []Thumbnail, columns int, labels bool) *image.RGBA {
+	if len(thumbnails) == 0 || columns <= 0 {
+		return image.NewRGBA(image.Rect(0, 0, 0, 0))
+	}
+
+	columns = min(columns, len(thumbnails))
+	rows := (len(thumbnails) + columns - 1) / columns
+
+	var cell image.Point
+	for _, t := range thumbnails {
+		cell.X = max(cell.X, t.Image.Bounds().Dx())
+		cell.Y = max(cell.Y, t.Image.Bounds().Dy())
+	}
+
+	sheet := image.NewRGBA(image.Rect(0, 0,
+		columns*(cell.X+contactSheetSpacing)+contactSheetSpacing,
+		rows*(cell.Y+contactSheetSpacing)+contactSheetSpacing))
+	draw.Draw(sheet, sheet.Bounds(), image.Black, image.Point{}, draw.Src)
+
+	for i, t := range thumbnails {
+		b := t.Image.Bounds()
+		pos := image.Pt(
+			contactSheetSpacing+(i%columns)*(cell.X+contactSheetSpacing),
+			contactSheetSpacing+(i/columns)*(cell.Y+contactSheetSpacing))
+		r := image.Rectangle{Min: pos, Max: pos.Add(b.Size())}
+
+		draw.Draw(sheet, r, t.Image, b.Min, draw.Src)
+
+		if labels {
+			drawLabel(sheet, r, formatTimestamp(t.Ticks))
+		}
+	}
+
+	return sheet
+}
+
+// formatTimestamp formats the ticks as m:ss, or h:mm:ss from an hour.
+func formatTimestamp(ticks int64) string {
+	s := max(ticks, 0) / ClockRate
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+// labelFont is a 3x5 pixel font of the digits and the colon, a row per byte with the left pixel in bit 2.
+var labelFont = map[rune][5]byte{
+	'0': {7, 5, 5, 5, 7},
+	'1': {2, 6, 2, 2, 7},
+	'2': {7, 1, 7, 4, 7},
+	'3': {7, 1, 7, 1, 7},
+	'4': {5, 5, 7, 1, 1},
+	'5': {7, 4, 7, 1, 7},
+	'6': {7, 4, 7, 5, 7},
+	'7': {7, 1, 2, 2, 2},
+	'8': {7, 5, 7, 5, 7},
+	'9': {7, 5, 7, 1, 7},
+	':': {0, 2, 0, 2, 0},
+}
+
+// drawLabel prints the text in white on a black box in the lower left corner of r, scaled with the size of r.
+func drawLabel(dst *image.RGBA, r image.Rectangle, text string) {
+	scale := max(r.Dx()/80, 1)
+	width := (len(text)*4 + 1) * scale
+	height := 7 * scale
+
+	box := image.Rect(r.Min.X, r.Max.Y-height, r.Min.X+width, r.Max.Y).Intersect(r)
+	draw.Draw(dst, box, image.Black, image.Point{}, draw.Src)
+
+	white := color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	for i, c := range text {
+		glyph := labelFont[c]
+		x0, y0 := box.Min.X+(1+i*4)*scale, box.Min.Y+scale
+
+		for row, bits := range glyph {
+			for col := 0; col < 3; col++ {
+				if bits>>(2-col)&1 == 0 {
+					continue
+				}
+
+				px := image.Rect(x0+col*scale, y0+row*scale, x0+(col+1)*scale, y0+(row+1)*scale).Intersect(box)
+				draw.Draw(dst, px, image.NewUniform(white), image.Point{}, draw.Src)
+			}
+		}
+	}
+}
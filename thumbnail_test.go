@@ -0,0 +1,132 @@
+package mpeg
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestSkipBlack(t *testing.T) {
+	frame := func(i int, luma byte) *Frame {
+		return &Frame{Ticks: int64(i) * 3000, Width: 16, Height: 16, Y: Plane{Width: 16, Height: 16, Data: bytes.Repeat([]byte{luma}, 16*16)}}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		lumas    []byte
+		endTicks int64
+		want     int64
+	}{
+		{"not black", []byte{100, 16, 16}, 9000, 0},
+		{"fade in", []byte{16, 16, 100, 100}, 12000, 6000},
+		{"black until the end", []byte{16, 16, 16, 100}, 9000, 6000},
+		{"black until the end of the stream", []byte{16, 16}, 12000, 3000},
+	} {
+		frames := make([]*Frame, len(tc.lumas))
+		for i, luma := range tc.lumas {
+			frames[i] = frame(i, luma)
+		}
+
+		i := 0
+		next := func() *Frame {
+			if i++; i < len(frames) {
+				return frames[i]
+			}
+
+			return nil
+		}
+
+		if got := skipBlack(frames[0], next, tc.endTicks); got == nil || got.Ticks != tc.want {
+			t.Errorf("%s: got %+v, want the frame at %d ticks", tc.name, got, tc.want)
+		}
+	}
+
+	if skipBlack(nil, nil, 0) != nil {
+		t.Error("nil frame: got a frame")
+	}
+}
+
+func TestThumbnails(t *testing.T) {
+	mpg, err := os.ReadFile("testdata/test.mpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New(bytes.NewReader(mpg))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	thumbnails := m.Thumbnails(6, 80)
+	if len(thumbnails) != 6 {
+		t.Fatalf("Thumbnails: got %d thumbnails, want %d", len(thumbnails), 6)
+	}
+
+	// Each thumbnail is an intra frame in its part of the duration.
+	step := m.DurationTicks() / 6
+	for i, thumbnail := range thumbnails {
+		if thumbnail.Image.Bounds() != image.Rect(0, 0, 80, 60) {
+			t.Errorf("thumbnail %d: got %v, want 80x60", i, thumbnail.Image.Bounds())
+		}
+		if thumbnail.Ticks < step*int64(i)-m.DurationTicks()/10 || thumbnail.Ticks > step*int64(i)+step/2 {
+			t.Errorf("thumbnail %d: got %d ticks, want a frame before %d", i, thumbnail.Ticks, step*int64(i)+step/2)
+		}
+	}
+
+	// The images do not change with decoding, which starts over.
+	pix := slices.Clone(thumbnails[0].Image.(*image.RGBA).Pix)
+	if frame := m.DecodeVideo(); frame == nil || frame.Ticks != 0 {
+		t.Fatalf("DecodeVideo: got %+v, want the first frame", frame)
+	}
+	for m.DecodeVideo() != nil {
+	}
+	if !bytes.Equal(thumbnails[0].Image.(*image.RGBA).Pix, pix) {
+		t.Error("Thumbnails: image changed with decoding")
+	}
+
+	if m.Thumbnails(2, 0)[0].Image.Bounds() != image.Rect(0, 0, 160, 120) {
+		t.Error("Thumbnails: got a scaled image without maxWidth")
+	}
+	if m.Index() != nil {
+		t.Error("Thumbnails: built an index")
+	}
+
+	// Decoding continues where it was, without calling the callbacks for the thumbnails.
+	m.Rewind()
+	var frame *Frame
+	for frame = m.DecodeVideo(); frame.Ticks < 100*3000; frame = m.DecodeVideo() {
+	}
+	want := m.DecodeVideo()
+	wantTicks, wantPix := want.Ticks, bytes.Clone(want.Y.Data)
+
+	m.Rewind()
+	for frame = m.DecodeVideo(); frame.Ticks < 100*3000; frame = m.DecodeVideo() {
+	}
+	m.SetVideoCallback(func(_ *MPEG, _ *Frame) {
+		t.Error("Thumbnails: called the video callback")
+	})
+	if len(m.Thumbnails(4, 80)) != 4 {
+		t.Fatal("Thumbnails: got no thumbnails")
+	}
+	m.SetVideoCallback(nil)
+
+	if frame = m.DecodeVideo(); frame == nil || frame.Ticks != wantTicks || !bytes.Equal(frame.Y.Data, wantPix) {
+		t.Errorf("DecodeVideo: got a different frame, want the frame at %d ticks", wantTicks)
+	}
+
+	sheet := ContactSheet(thumbnails, 3, false)
+	if sheet.Bounds() != image.Rect(0, 0, 3*84+4, 2*64+4) {
+		t.Fatalf("ContactSheet: got %v", sheet.Bounds())
+	}
+	if sheet.RGBAAt(4, 4) != thumbnails[0].Image.(*image.RGBA).RGBAAt(0, 0) || sheet.RGBAAt(88, 68) != thumbnails[4].Image.(*image.RGBA).RGBAAt(0, 0) {
+		t.Error("ContactSheet: thumbnails are not tiled in order")
+	}
+
+	// The label of the fifth thumbnail reads 0:06, in the lower left corner.
+	labeled := ContactSheet(thumbnails, 3, true)
+	if labeled.RGBAAt(88, 68) != sheet.RGBAAt(88, 68) || labeled.RGBAAt(88, 127) == sheet.RGBAAt(88, 127) && labeled.RGBAAt(89, 122) == sheet.RGBAAt(89, 122) {
+		t.Error("ContactSheet: no label")
+	}
+}
@@ -1,15 +1,23 @@
 package mpeg
 
 import (
+	"errors"
 	"image"
 	"image/color"
 	"image/draw"
+	"math/bits"
 	"unsafe"
 )
 
+// ErrCorruptSlice is the error reported when a picture of the video stream is damaged.
+// The damaged part of the picture is left as predicted, or as it was in the frame buffer.
+var ErrCorruptSlice = errors.New("corrupt slice")
+
 // Frame represents decoded video frame.
+// Time is the presentation time in seconds, Ticks the same time in ticks of ClockRate.
 type Frame struct {
-	Time float64
+	Time  float64
+	Ticks int64
 
 	Width  int
 	Height int
@@ -20,6 +28,14 @@ type Frame struct {
 
 	imYCbCr image.YCbCr
 	imRGBA  image.RGBA
+
+	// Presentation time stamp of the picture, if it was written with one.
+	pts    int64
+	hasPts bool
+
+	// Coding type of the picture and the number of its intra-coded macroblocks.
+	pictureType      int
+	intraMacroblocks int
 }
 
 // YCbCr returns frame as image.YCbCr.
@@ -27,8 +43,13 @@ func (f *Frame) YCbCr() *image.YCbCr {
 	return &f.imYCbCr
 }
 
-// RGBA returns frame as image.RGBA.
+// RGBA returns frame as image.RGBA. The image is allocated on the first call.
+// A Converter is faster and interpolates the chroma planes.
 func (f *Frame) RGBA() *image.RGBA {
+	if f.imRGBA.Pix == nil {
+		f.imRGBA.Pix = make([]byte, f.imRGBA.Stride*f.imRGBA.Rect.Dy())
+	}
+
 	b := f.imYCbCr.Bounds()
 	draw.Draw(&f.imRGBA, b.Bounds(), &f.imYCbCr, b.Min, draw.Src)
 
@@ -42,6 +63,11 @@ func (f *Frame) Pixels() []color.RGBA {
 	return unsafe.Slice((*color.RGBA)(unsafe.Pointer(&img.Pix[0])), len(img.Pix)/4)
 }
 
+// Intra returns true if the frame is an intra-coded picture, which is decoded without other frames.
+func (f *Frame) Intra() bool {
+	return f.pictureType == pictureTypeIntra
+}
+
 // Plane represents decoded video plane.
 // The byte length of the data is width * height. Note that different planes have different sizes:
 // the Luma plane (Y) is double the size of each of the two Chroma planes (Cr, Cb) - i.e. 4 times the byte length.
@@ -57,7 +83,11 @@ type Plane struct {
 type Video struct {
 	aspectRatio   float64
 	frameRate     float64
+	frameRateNum  int
+	frameRateDen  int
 	time          float64
+	ticks         int64
+	baseTicks     int64
 	bitRate       int
 	framesDecoded int
 	width         int
@@ -104,12 +134,22 @@ type Video struct {
 
 	hasReferenceFrame bool
 	assumeNoBFrames   bool
+
+	// Error of the last Decode, and whether the stream is MPEG-2 Video or exceeds the limits.
+	err         error
+	unsupported bool
+	exceeded    bool
+
+	limits Limits
 }
 
-// NewVideo creates a video decoder with buffer as a source.
-func NewVideo(buf *Buffer) *Video {
+// NewVideo creates a video decoder with buffer as a source. Optional limits bound the
+// dimensions of the video, the size of the buffer and the pictures examined by Decode.
+func NewVideo(buf *Buffer, limits ...Limits) *Video {
 	video := &Video{}
 	video.buf = buf
+	video.limits = limitsOf(limits)
+	video.buf.setLimits(video.limits)
 
 	// Attempt to decode the sequence header
 	video.startCode = video.buf.findStartCode(startSequence)
@@ -132,6 +172,10 @@ func (v *Video) HasHeader() bool {
 		return true
 	}
 
+	if v.unsupported || v.exceeded {
+		return false
+	}
+
 	if v.startCode != startSequence {
 		v.startCode = v.buf.findStartCode(startSequence)
 	}
@@ -155,6 +199,15 @@ func (v *Video) Framerate() float64 {
 	return 0
 }
 
+// FramerateRational returns the exact framerate as a fraction, e.g. 30000/1001 for 29.97 frames per second.
+func (v *Video) FramerateRational() (num, den int) {
+	if v.HasHeader() {
+		return v.frameRateNum, v.frameRateDen
+	}
+
+	return 0, 1
+}
+
 // Width returns the display width.
 func (v *Video) Width() int {
 	if v.HasHeader() {
@@ -187,14 +240,28 @@ func (v *Video) Time() float64 {
 // SetTime sets the current internal time in seconds. This is only useful when you
 // manipulate the underlying video buffer and want to enforce a correct timestamps.
 func (v *Video) SetTime(time float64) {
-	v.framesDecoded = int(v.frameRate * time)
-	v.time = time
+	v.SetTicks(secondsToTicks(time))
+}
+
+// Ticks returns the current internal time in ticks of ClockRate.
+func (v *Video) Ticks() int64 {
+	return v.ticks
+}
+
+// SetTicks sets the current internal time in ticks of ClockRate, see SetTime.
+func (v *Video) SetTicks(ticks int64) {
+	v.baseTicks = ticks
+	v.framesDecoded = 0
+	v.ticks = ticks
+	v.time = float64(ticks) / ClockRate
 }
 
 // Rewind rewinds the internal buffer.
 func (v *Video) Rewind() {
 	v.buf.Rewind()
 	v.time = 0
+	v.ticks = 0
+	v.baseTicks = 0
 	v.framesDecoded = 0
 	v.hasReferenceFrame = false
 	v.startCode = -1
@@ -205,15 +272,36 @@ func (v *Video) HasEnded() bool {
 	return v.buf.HasEnded()
 }
 
+// Err returns the error of the last Decode. If Decode returned nil, this is nil at the end of the data,
+// ErrNeedMoreData if the buffer has no complete picture yet, ErrUnsupportedCodec for MPEG-2 Video,
+// ErrLimitExceeded if the video exceeds the limits passed to NewVideo, or the error of the buffer,
+// see Buffer.Err. If Decode returned a frame, this is ErrCorruptSlice if a picture decoded in the call
+// was damaged, nil otherwise.
+func (v *Video) Err() error {
+	return v.err
+}
+
 // Decode decodes and returns one frame of video and advance the internal time by 1/framerate seconds.
+// If the picture was written to the buffer with a presentation time stamp (see Buffer.WritePts),
+// the internal time is set to it first. If no frame could be decoded it returns nil, see Err for the reason.
 func (v *Video) Decode() *Frame {
+	v.err = nil
+
 	if !v.HasHeader() {
+		v.err = v.endErr()
+
 		return nil
 	}
 
 	var frame *Frame
 
-	for {
+	for steps := 1; ; steps++ {
+		if !v.limits.steps(steps) {
+			v.err = ErrLimitExceeded
+
+			return nil
+		}
+
 		if v.startCode != startPicture {
 			v.startCode = v.buf.findStartCode(startPicture)
 
@@ -228,6 +316,8 @@ func (v *Video) Decode() *Frame {
 					break
 				}
 
+				v.err = v.endErr()
+
 				return nil
 			}
 		}
@@ -238,11 +328,18 @@ func (v *Video) Decode() *Frame {
 		// next picture, but the source has ended, we assume that this last
 		// picture is in the buffer.
 		if v.buf.hasStartCode(startPicture) == -1 && !v.buf.HasEnded() {
+			v.err = v.endErr()
+
 			return nil
 		}
 		v.buf.discardReadBytes()
 
-		v.decodePicture()
+		// Skip invalid pictures, and look for the next one.
+		if !v.decodePicture() {
+			v.startCode = -1
+
+			continue
+		}
 
 		switch {
 		case v.assumeNoBFrames:
@@ -260,13 +357,46 @@ func (v *Video) Decode() *Frame {
 		}
 	}
 
+	if frame.hasPts {
+		v.SetTicks(frame.pts)
+	}
+
 	frame.Time = v.time
+	frame.Ticks = v.ticks
 	v.framesDecoded++
-	v.time = float64(v.framesDecoded) / v.frameRate
+
+	// Count in exact fractions of a second from the last time set, so the time does not drift on long streams.
+	if v.frameRateNum != 0 {
+		v.ticks = v.baseTicks + int64(v.framesDecoded)*ClockRate*int64(v.frameRateDen)/int64(v.frameRateNum)
+		v.time = float64(v.baseTicks)/ClockRate + float64(v.framesDecoded)*float64(v.frameRateDen)/float64(v.frameRateNum)
+	}
 
 	return frame
 }
 
+// endErr returns the reason no frame could be decoded from the data in the buffer.
+func (v *Video) endErr() error {
+	switch {
+	case v.unsupported:
+		return ErrUnsupportedCodec
+	case v.exceeded:
+		return ErrLimitExceeded
+	case v.buf.Err() != nil:
+		return v.buf.Err()
+	case !v.buf.HasEnded():
+		return ErrNeedMoreData
+	}
+
+	return nil
+}
+
+// corrupt records that the picture being decoded is damaged.
+func (v *Video) corrupt() {
+	if v.err == nil {
+		v.err = ErrCorruptSlice
+	}
+}
+
 func (v *Video) decodeSequenceHeader() bool {
 	maxHeaderSize := 64 + 2*64*8 // 64 bit header + 2x 64 byte matrix
 	if !v.buf.has(maxHeaderSize) {
@@ -280,8 +410,17 @@ func (v *Video) decodeSequenceHeader() bool {
 		return false
 	}
 
+	if !v.limits.dimensions(v.width, v.height) {
+		v.exceeded = true
+
+		return false
+	}
+
 	v.aspectRatio = videoAspectRatio[v.buf.read(4)]
-	v.frameRate = videoPictureRate[v.buf.read(4)]
+	pictureRate := v.buf.read(4)
+	v.frameRate = videoPictureRate[pictureRate]
+	v.frameRateNum = videoPictureRateNum[pictureRate]
+	v.frameRateDen = videoPictureRateDen[pictureRate]
 	v.bitRate = v.buf.read(18)
 
 	// Skip marker, buffer_size and constrained bit
@@ -311,6 +450,13 @@ func (v *Video) decodeSequenceHeader() bool {
 		}
 	}
 
+	// A sequence extension right after the sequence header makes it MPEG-2 Video.
+	if v.buf.peekStartCode() == startExtension {
+		v.unsupported = true
+
+		return false
+	}
+
 	v.mbWidth = (v.width + 15) >> 4
 	v.mbHeight = (v.height + 15) >> 4
 	v.mbSize = v.mbWidth * v.mbHeight
@@ -364,30 +510,42 @@ func (v *Video) initFrame(frame *Frame) {
 		Rect:           image.Rect(0, 0, v.width, v.height),
 	}
 
+	// Allocated by RGBA, most callers do not need it.
 	frame.imRGBA = image.RGBA{
-		Pix:    make([]byte, v.width*v.height*4),
 		Stride: 4 * v.width,
 		Rect:   image.Rect(0, 0, v.width, v.height),
 	}
 }
 
-func (v *Video) decodePicture() {
+// decodePicture decodes the picture after the picture start code. Returns false if the picture header is invalid.
+func (v *Video) decodePicture() bool {
+	// The picture starts with the start code just read. A time stamp belongs to the
+	// picture decoded into the current frame, which is output in display order.
+	v.frameCurrent.pts, v.frameCurrent.hasPts = v.buf.pts(4)
+
 	v.buf.skip(10) // skip temporalReference
 	v.pictureType = v.buf.read(3)
 	v.buf.skip(16) // skip vbv_delay
 
 	// D frames or unknown coding type
 	if v.pictureType <= 0 || v.pictureType > pictureTypeB {
-		return
+		v.corrupt()
+
+		return false
 	}
 
+	v.frameCurrent.pictureType = v.pictureType
+	v.frameCurrent.intraMacroblocks = 0
+
 	// Forward fullPx, fCode
 	if v.pictureType == pictureTypePredictive || v.pictureType == pictureTypeB {
 		v.motionForward.FullPx = v.buf.read1()
 		fCode := v.buf.read(3)
 		if fCode == 0 {
 			// Ignore picture with zero fCode
-			return
+			v.corrupt()
+
+			return false
 		}
 		v.motionForward.RSize = fCode - 1
 	}
@@ -398,7 +556,9 @@ func (v *Video) decodePicture() {
 		fCode := v.buf.read(3)
 		if fCode == 0 {
 			// Ignore picture with zero fCode
-			return
+			v.corrupt()
+
+			return false
 		}
 		v.motionBackward.RSize = fCode - 1
 	}
@@ -431,6 +591,8 @@ func (v *Video) decodePicture() {
 		v.frameBackward = v.frameCurrent
 		v.frameCurrent = frameTemp
 	}
+
+	return true
 }
 
 func (v *Video) decodeSlice(slice int) {
@@ -462,16 +624,16 @@ func (v *Video) decodeSlice(slice int) {
 func (v *Video) decodeMacroblock() {
 	// Decode increment
 	increment := 0
-	t := v.buf.readVlc(videoMacroblockAddressIncrement)
+	t := v.buf.readVlc(videoMacroblockAddressIncrementLookup)
 
 	for t == 34 {
 		// macroblock_stuffing
-		t = v.buf.readVlc(videoMacroblockAddressIncrement)
+		t = v.buf.readVlc(videoMacroblockAddressIncrementLookup)
 	}
 	for t == 35 {
 		// macroblock_escape
 		increment += 33
-		t = v.buf.readVlc(videoMacroblockAddressIncrement)
+		t = v.buf.readVlc(videoMacroblockAddressIncrementLookup)
 	}
 	increment += t
 
@@ -514,14 +676,19 @@ func (v *Video) decodeMacroblock() {
 	v.mbRow = v.macroblockAddress / v.mbWidth
 	v.mbCol = v.macroblockAddress % v.mbWidth
 
-	if v.mbCol >= v.mbWidth || v.mbRow >= v.mbHeight {
+	if v.macroblockAddress < 0 || v.mbRow >= v.mbHeight {
+		v.corrupt()
+
 		return // corrupt stream
 	}
 
 	// Process the current macroblock
-	v.macroblockType = v.buf.readVlc(videoMacroBlockType[v.pictureType])
+	v.macroblockType = v.buf.readVlc(videoMacroBlockTypeLookup[v.pictureType])
 
 	v.macroblockIntra = v.macroblockType&0x01 != 0
+	if v.macroblockIntra {
+		v.frameCurrent.intraMacroblocks++
+	}
 	v.motionForward.IsSet = v.macroblockType&0x08 != 0
 	v.motionBackward.IsSet = v.macroblockType&0x04 != 0
 
@@ -547,7 +714,7 @@ func (v *Video) decodeMacroblock() {
 	// Decode blocks
 	cbp := 0
 	if (v.macroblockType & 0x02) != 0 {
-		cbp = v.buf.readVlc(videoCodeBlockPattern)
+		cbp = v.buf.readVlc(videoCodeBlockPatternLookup)
 	} else if v.macroblockIntra {
 		cbp = 0x3f
 	}
@@ -582,7 +749,7 @@ func (v *Video) decodeMotionVectors() {
 
 func (v *Video) decodeMotionVector(rSize, motion int) int {
 	fscale := 1 << rSize
-	mCode := v.buf.readVlc(videoMotion)
+	mCode := v.buf.readVlc(videoMotionLookup)
 	var r, d int
 
 	if mCode != 0 && fscale != 1 {
@@ -624,18 +791,41 @@ func (v *Video) predictMacroblock() {
 		}
 
 		if v.motionForward.IsSet {
-			copyMacroblock(fwH, fwV, v.mbRow, v.mbCol, v.lumaWidth, v.chromaWidth, &v.frameForward, &v.frameCurrent)
+			v.copyMacroblock(fwH, fwV, &v.frameForward)
 			if v.motionBackward.IsSet {
-				copyMacroblock(bwH, bwV, v.mbRow, v.mbCol, v.lumaWidth, v.chromaWidth, &v.frameBackward, &v.frameCurrent)
+				v.copyMacroblock(bwH, bwV, &v.frameBackward)
 			}
 		} else {
-			copyMacroblock(bwH, bwV, v.mbRow, v.mbCol, v.lumaWidth, v.chromaWidth, &v.frameBackward, &v.frameCurrent)
+			v.copyMacroblock(bwH, bwV, &v.frameBackward)
 		}
 	} else {
-		copyMacroblock(fwH, fwV, v.mbRow, v.mbCol, v.lumaWidth, v.chromaWidth, &v.frameForward, &v.frameCurrent)
+		v.copyMacroblock(fwH, fwV, &v.frameForward)
 	}
 }
 
+// copyMacroblock predicts the current macroblock from the reference frame s with the motion vector.
+// The optimized copyMacroblock does not check bounds, vectors that reach out of the frame buffers are corrupt.
+func (v *Video) copyMacroblock(motionH, motionV int, s *Frame) {
+	// The same offsets as copyMacroblock, and the extent of the reads of a block with half-pel interpolation.
+	extent := func(motionH, motionV, row, col, stride, size int) (int, int) {
+		si := (row*size+motionV>>1)*stride + col*size + motionH>>1
+
+		return si, si + (size-1)*stride + size + motionH&1 + (motionV&1)*stride
+	}
+
+	lumaStart, lumaEnd := extent(motionH, motionV, v.mbRow, v.mbCol, v.lumaWidth, 16)
+	chromaStart, chromaEnd := extent(motionH/2, motionV/2, v.mbRow, v.mbCol, v.chromaWidth, 8)
+
+	// The planes share one buffer, Cr is the last plane, see initFrame.
+	if lumaStart < 0 || lumaEnd > cap(s.Y.Data) || chromaStart < 0 || chromaEnd > cap(s.Cr.Data) {
+		v.corrupt()
+
+		return
+	}
+
+	copyMacroblock(motionH, motionV, v.mbRow, v.mbCol, v.lumaWidth, v.chromaWidth, s, &v.frameCurrent)
+}
+
 func (v *Video) decodeBlock(block int) {
 	var n int
 	var quantMatrix *[64]byte
@@ -651,7 +841,7 @@ func (v *Video) decodeBlock(block int) {
 			planeIndex = block - 3
 		}
 		predictor = v.dcPredictor[planeIndex]
-		dctSize = v.buf.readVlc(videoDctSize[planeIndex])
+		dctSize = v.buf.readVlc(videoDctSizeLookup[planeIndex])
 
 		// Read DC coeff
 		if dctSize > 0 {
@@ -677,11 +867,12 @@ func (v *Video) decodeBlock(block int) {
 		quantMatrix = &v.nonIntraQuantMatrix
 	}
 
-	// Decode AC coefficients (+DC for non-intra)
+	// Decode AC coefficients (+DC for non-intra), and the positions of the coded ones
 	level := 0
+	var coded uint64
 	for {
 		run := 0
-		coeff := int(v.buf.readVlcUint(videoDctCoeff))
+		coeff := int(v.buf.readVlcUint(videoDctCoeffLookup))
 
 		if (coeff == 0x0001) && (n > 0) && (v.buf.read1() == 0) {
 			// end_of_block
@@ -710,40 +901,22 @@ func (v *Video) decodeBlock(block int) {
 
 		n += run
 		if n < 0 || n >= 64 {
+			v.corrupt()
+			dequantize(&v.blockData, coded, quantMatrix, v.quantizerScale, v.macroblockIntra)
+
 			return // invalid
 		}
 
 		deZigZagged := int(videoZigZag[n]) & 63
 		n++
 
-		// Dequantize, oddify, clip
-		level <<= 1
-		if !v.macroblockIntra {
-			if level < 0 {
-				level += -1
-			} else {
-				level += 1
-			}
-		}
-
-		level = (level * v.quantizerScale * int(quantMatrix[deZigZagged])) >> 4
-		if (level & 1) == 0 {
-			if level > 0 {
-				level -= 1
-			} else {
-				level -= -1
-			}
-		}
-		if level > 2047 {
-			level = 2047
-		} else if level < -2048 {
-			level = -2048
-		}
-
-		// Save premultiplied coefficient
-		v.blockData[deZigZagged] = level * int(videoPremultiplierMatrix[deZigZagged])
+		// Dequantized after the loop, see dequantize
+		v.blockData[deZigZagged] = level
+		coded |= 1 << deZigZagged
 	}
 
+	dequantize(&v.blockData, coded, quantMatrix, v.quantizerScale, v.macroblockIntra)
+
 	// Move block to its place
 	var d []byte
 	var di int
@@ -798,7 +971,45 @@ func (v *Video) decodeBlock(block int) {
 	}
 }
 
-func idct(block *[64]int, maxIndex int) {
+// dequantizeGeneric dequantizes, oddifies, clips and premultiplies the coefficients of block at the positions
+// set in coded, which hold the levels decoded from the stream, in [-256, 256].
+func dequantizeGeneric(block *[64]int, coded uint64, quantMatrix *[64]byte, quantizerScale int, intra bool) {
+	for ; coded != 0; coded &= coded - 1 {
+		i := bits.TrailingZeros64(coded)
+
+		level := block[i] << 1
+		if !intra {
+			if level < 0 {
+				level += -1
+			} else {
+				level += 1
+			}
+		}
+
+		level = (level * quantizerScale * int(quantMatrix[i])) >> 4
+		if (level & 1) == 0 {
+			if level > 0 {
+				level -= 1
+			} else {
+				level -= -1
+			}
+		}
+		if level > 2047 {
+			level = 2047
+		} else if level < -2048 {
+			level = -2048
+		}
+
+		block[i] = level * int(videoPremultiplierMatrix[i])
+	}
+}
+
+// idctMaxDC bounds the DC coefficient for the assembly versions of idct, which transform in 32 bits.
+// With the other coefficients dequantized, the transform then fits in 32 bits, the DC coefficient of
+// a corrupt stream can exceed it.
+const idctMaxDC = 1 << 27
+
+func idctGeneric(block *[64]int, maxIndex int) {
 	// See http://vsr.informatik.tu-chemnitz.de/~jan/MPEG/HTML/IDCT.html for more info.
 
 	var b1, b3, b4, b6, b7, tmp1, tmp2, m0,
@@ -937,6 +1148,7 @@ const (
 	startSliceLast  = 0xAF
 	startUserData   = 0xB2
 	startSequence   = 0xB3
+	startGOP        = 0xB8
 	startExtension  = 0xB5
 )
 
@@ -1036,6 +1248,16 @@ var videoPictureRate = []float64{
 	60.000, 0.000, 0.000, 0.000, 0.000, 0.000, 0.000, 0.000,
 }
 
+var videoPictureRateNum = []int{
+	0, 24000, 24, 25, 30000, 30, 50, 60000,
+	60, 0, 0, 0, 0, 0, 0, 0,
+}
+
+var videoPictureRateDen = []int{
+	1, 1001, 1, 1, 1001, 1, 1, 1001,
+	1, 1, 1, 1, 1, 1, 1, 1,
+}
+
 var videoAspectRatio = []float64{
 	0.0000, 1.0000, 0.6735, 0.7031, 0.7615, 0.8055, 0.8437, 0.8935,
 	0.9375, 0.9815, 1.0255, 1.0695, 1.1250, 1.1575, 1.2015, 0.0000,
@@ -1417,3 +1639,26 @@ var videoDctCoeff = []vlcUint{
 	{0, 0x1e01}, {0, 0x1d01}, // 110: 0000 0000 0001 110x
 	{0, 0x1c01}, {0, 0x1b01}, // 111: 0000 0000 0001 111x
 }
+
+// Lookup tables of the codes above, see Buffer.readVlc.
+var (
+	videoMacroblockAddressIncrementLookup = newVlcLookup(videoMacroblockAddressIncrement)
+
+	videoMacroBlockTypeLookup = []vlcLookup{
+		nil,
+		newVlcLookup(videoMacroblockTypeIntra),
+		newVlcLookup(videoMacroblockTypePredictive),
+		newVlcLookup(videoMacroblockTypeB),
+	}
+
+	videoCodeBlockPatternLookup = newVlcLookup(videoCodeBlockPattern)
+	videoMotionLookup           = newVlcLookup(videoMotion)
+
+	videoDctSizeLookup = []vlcLookup{
+		newVlcLookup(videoDctSizeLuminance),
+		newVlcLookup(videoDctSizeChrominance),
+		newVlcLookup(videoDctSizeChrominance),
+	}
+
+	videoDctCoeffLookup = newVlcUintLookup(videoDctCoeff)
+)
@@ -15,3 +15,37 @@ func copyMacroblock(motionH, motionV, mbRow, mbCol, lumaWidth, chromaWidth int,
 		copyMacroblockSSE2(motionH, motionV, mbRow, mbCol, lumaWidth, chromaWidth, s, d)
 	}
 }
+
+//go:noescape
+func dequantizeSSE2(block *[64]int, coded uint64, quantMatrix *[64]byte, quantizerScale int, intra bool)
+
+//go:noescape
+func dequantizeAVX2(block *[64]int, coded uint64, quantMatrix *[64]byte, quantizerScale int, intra bool)
+
+func dequantize(block *[64]int, coded uint64, quantMatrix *[64]byte, quantizerScale int, intra bool) {
+	if isAVX2 {
+		dequantizeAVX2(block, coded, quantMatrix, quantizerScale, intra)
+	} else {
+		dequantizeSSE2(block, coded, quantMatrix, quantizerScale, intra)
+	}
+}
+
+//go:noescape
+func idctSSE2(block *[64]int, maxIndex int)
+
+//go:noescape
+func idctAVX2(block *[64]int, maxIndex int)
+
+func idct(block *[64]int, maxIndex int) {
+	if block[0] >= idctMaxDC || block[0] <= -idctMaxDC {
+		idctGeneric(block, maxIndex)
+
+		return
+	}
+
+	if isAVX2 {
+		idctAVX2(block, maxIndex)
+	} else {
+		idctSSE2(block, maxIndex)
+	}
+}
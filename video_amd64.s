@@ -52,7 +52,7 @@ TEXT ·copyMacroblockSSE2(SB), NOSPLIT, $0-64
 	MOVQ  DI, AX
 	IMULQ R8, AX
 	ADDQ  BX, AX
-	MOVQ  40(R10), SI
+	MOVQ  48(R10), SI
 	ADDQ  AX, SI
 
 	// Dest pointer: DI = d.Y.Data + (mbRow<<4)*stride + (mbCol<<4)
@@ -62,7 +62,7 @@ TEXT ·copyMacroblockSSE2(SB), NOSPLIT, $0-64
 	MOVQ  DX, BX
 	SHLQ  $4, BX
 	ADDQ  BX, AX
-	MOVQ  40(R11), DI
+	MOVQ  48(R11), DI
 	ADDQ  AX, DI
 
 	CMPQ R14, $0
@@ -208,9 +208,9 @@ chroma_v_ok:
 	MOVQ  SI, AX
 	IMULQ R9, AX
 	ADDQ  BX, AX
-	MOVQ  80(R10), SI
+	MOVQ  88(R10), SI
 	ADDQ  AX, SI
-	MOVQ  120(R10), R10
+	MOVQ  128(R10), R10
 	ADDQ  AX, R10
 
 	// Dest offset, then resolve Cb (DI) and Cr (R11) pointers.
@@ -220,9 +220,9 @@ chroma_v_ok:
 	MOVQ  mbCol+24(FP), BX
 	SHLQ  $3, BX
 	ADDQ  BX, AX
-	MOVQ  80(R11), DI
+	MOVQ  88(R11), DI
 	ADDQ  AX, DI
-	MOVQ  120(R11), R11
+	MOVQ  128(R11), R11
 	ADDQ  AX, R11
 
 	MOVQ $0, R13 // plane flag: 0 = Cb (first), 1 = Cr (second)
@@ -356,7 +356,7 @@ TEXT ·copyMacroblockAVX2(SB), NOSPLIT, $0-64
 	MOVQ  DI, AX
 	IMULQ R8, AX
 	ADDQ  BX, AX
-	MOVQ  40(R10), SI
+	MOVQ  48(R10), SI
 	ADDQ  AX, SI
 
 	MOVQ  CX, AX
@@ -365,7 +365,7 @@ TEXT ·copyMacroblockAVX2(SB), NOSPLIT, $0-64
 	MOVQ  DX, BX
 	SHLQ  $4, BX
 	ADDQ  BX, AX
-	MOVQ  40(R11), DI
+	MOVQ  48(R11), DI
 	ADDQ  AX, DI
 
 	CMPQ R14, $0
@@ -487,9 +487,9 @@ chroma_avx2_v_ok:
 	MOVQ  SI, AX
 	IMULQ R9, AX
 	ADDQ  BX, AX
-	MOVQ  80(R10), SI
+	MOVQ  88(R10), SI
 	ADDQ  AX, SI
-	MOVQ  120(R10), R10
+	MOVQ  128(R10), R10
 	ADDQ  AX, R10
 
 	MOVQ  mbRow+16(FP), AX
@@ -498,9 +498,9 @@ chroma_avx2_v_ok:
 	MOVQ  mbCol+24(FP), BX
 	SHLQ  $3, BX
 	ADDQ  BX, AX
-	MOVQ  80(R11), DI
+	MOVQ  88(R11), DI
 	ADDQ  AX, DI
-	MOVQ  120(R11), R11
+	MOVQ  128(R11), R11
 	ADDQ  AX, R11
 
 	MOVQ $0, R13 // plane flag: 0 = Cb, 1 = Cr
@@ -593,3 +593,668 @@ chroma_avx2_next:
 chroma_avx2_done:
 	VZEROUPPER
 	RET
+
+// Lane bits of a byte of the coded mask, and the IDCT constants, per dword.
+DATA dequantBits<>+0(SB)/8, $0x0000000200000001
+DATA dequantBits<>+8(SB)/8, $0x0000000800000004
+DATA dequantBits<>+16(SB)/8, $0x0000002000000010
+DATA dequantBits<>+24(SB)/8, $0x0000008000000040
+GLOBL dequantBits<>(SB), RODATA|NOPTR, $32
+
+DATA idct473<>+0(SB)/8, $0x000001d9000001d9
+DATA idct473<>+8(SB)/8, $0x000001d9000001d9
+DATA idct473<>+16(SB)/8, $0x000001d9000001d9
+DATA idct473<>+24(SB)/8, $0x000001d9000001d9
+GLOBL idct473<>(SB), RODATA|NOPTR, $32
+
+DATA idct196<>+0(SB)/8, $0x000000c4000000c4
+DATA idct196<>+8(SB)/8, $0x000000c4000000c4
+DATA idct196<>+16(SB)/8, $0x000000c4000000c4
+DATA idct196<>+24(SB)/8, $0x000000c4000000c4
+GLOBL idct196<>(SB), RODATA|NOPTR, $32
+
+DATA idct362<>+0(SB)/8, $0x0000016a0000016a
+DATA idct362<>+8(SB)/8, $0x0000016a0000016a
+DATA idct362<>+16(SB)/8, $0x0000016a0000016a
+DATA idct362<>+24(SB)/8, $0x0000016a0000016a
+GLOBL idct362<>(SB), RODATA|NOPTR, $32
+
+DATA idctSparse<>+0(SB)/8, $0xffffffffffffffff
+DATA idctSparse<>+8(SB)/8, $0xffffffffffffffff
+DATA idctSparse<>+16(SB)/8, $0
+DATA idctSparse<>+24(SB)/8, $0
+GLOBL idctSparse<>(SB), RODATA|NOPTR, $32
+
+DATA idct128<>+0(SB)/8, $0x0000008000000080
+DATA idct128<>+8(SB)/8, $0x0000008000000080
+DATA idct128<>+16(SB)/8, $0x0000008000000080
+DATA idct128<>+24(SB)/8, $0x0000008000000080
+GLOBL idct128<>(SB), RODATA|NOPTR, $32
+
+// dequantizeSSE2 dequantizes, oddifies, clips and premultiplies the coded
+// coefficients of a block, a row of 8 per iteration, skipping rows without
+// coded coefficients. The levels are narrowed to dwords; the products fit in
+// PMADDWD, the clip saturates to words.
+//
+// func dequantizeSSE2(block *[64]int, coded uint64, quantMatrix *[64]byte, quantizerScale int, intra bool)
+//
+// Persistent registers:
+//   DI = block row, SI = quantMatrix row, R8 = premultiplier row, AX = coded
+//   X10/X11 = lane bits of lanes 4-7/0-3
+//   X12 = 1 per dword, X13 = all ones for non-intra blocks
+//   X14 = quantizerScale per dword, X15 = zero
+
+// LEVEL2: x = x<<1 + sign(x) for non-intra blocks, with sign(0) = 1.
+#define LEVEL2(x, t) \
+	MOVO  x, t       \
+	PSRAL $31, t     \
+	POR   X12, t     \
+	PAND  X13, t     \
+	PSLLL $1, x      \
+	PADDL t, x
+
+// ODDIFY: x -= sign(x) for even x, with sign(0) = -1.
+#define ODDIFY(x, t, u) \
+	MOVO    x, t        \
+	PCMPGTL X15, t      \
+	PSLLL   $1, t       \
+	POR     X12, t      \
+	MOVO    x, u        \
+	PAND    X12, u      \
+	PSUBL   X12, u      \
+	PAND    u, t        \
+	PADDL   t, x
+
+// BLEND: stores the qwords of x to off(DI) in the lanes of mask m.
+#define BLEND(x, m, off) \
+	MOVOU off(DI), X9    \
+	PAND  m, x           \
+	PANDN X9, m          \
+	POR   m, x           \
+	MOVOU x, off(DI)
+
+// WIDEN: sign-extends the dwords of x and mask m to qwords, and blends them to off(DI).
+#define WIDEN(x, m, off)  \
+	MOVO      x, X7       \
+	PSRAL     $31, X7     \
+	MOVO      x, X8       \
+	PUNPCKLLQ X7, X8      \
+	PUNPCKHLQ X7, x       \
+	MOVO      m, X7       \
+	PUNPCKLLQ m, X7       \
+	PUNPCKHLQ m, m        \
+	BLEND(X8, X7, off)    \
+	BLEND(x, m, off+16)
+
+TEXT ·dequantizeSSE2(SB), NOSPLIT, $0-33
+	MOVQ    block+0(FP), DI
+	MOVQ    coded+8(FP), AX
+	MOVQ    quantMatrix+16(FP), SI
+	MOVQ    quantizerScale+24(FP), BX
+	MOVBQZX intra+32(FP), CX
+	LEAQ    ·videoPremultiplierMatrix(SB), R8
+
+	PXOR    X15, X15
+	MOVQ    BX, X14
+	PSHUFL  $0, X14, X14
+	PCMPEQL X12, X12
+	PSRLL   $31, X12
+	DECQ    CX
+	MOVQ    CX, X13
+	PSHUFL  $0, X13, X13
+	MOVOU   dequantBits<>(SB), X11
+	MOVOU   dequantBits<>+16(SB), X10
+
+dequant_sse2_loop:
+	TESTQ AX, AX
+	JZ    dequant_sse2_done
+	MOVQ  AX, BX
+	ANDQ  $0xff, BX
+	JZ    dequant_sse2_next
+
+	// Lane masks of the coded coefficients.
+	MOVQ    BX, X0
+	PSHUFL  $0, X0, X0
+	MOVO    X0, X1
+	PAND    X11, X0
+	PCMPEQL X11, X0
+	PAND    X10, X1
+	PCMPEQL X10, X1
+
+	// Levels, narrowed to dwords.
+	MOVOU  (DI), X2
+	MOVOU  16(DI), X3
+	SHUFPS $0x88, X3, X2
+	MOVOU  32(DI), X3
+	MOVOU  48(DI), X4
+	SHUFPS $0x88, X4, X3
+
+	LEVEL2(X2, X4)
+	LEVEL2(X3, X4)
+
+	// level = (level * quantizerScale * quantMatrix[i]) >> 4
+	MOVL      (SI), X4
+	PUNPCKLBW X15, X4
+	PUNPCKLWL X15, X4
+	PMADDWL   X14, X4
+	PMADDWL   X4, X2
+	PSRAL     $4, X2
+	MOVL      4(SI), X4
+	PUNPCKLBW X15, X4
+	PUNPCKLWL X15, X4
+	PMADDWL   X14, X4
+	PMADDWL   X4, X3
+	PSRAL     $4, X3
+
+	ODDIFY(X2, X4, X5)
+	ODDIFY(X3, X4, X5)
+
+	// Clip to [-2048, 2047]: shifted left by 4, the range saturates to words.
+	PSLLL    $4, X2
+	PSLLL    $4, X3
+	PACKSSLW X3, X2
+	PSRAW    $4, X2
+
+	// Premultiply, to dwords.
+	MOVQ      (R8), X4
+	PUNPCKLBW X15, X4
+	MOVO      X2, X5
+	PMULLW    X4, X2
+	PMULHW    X4, X5
+	MOVO      X2, X6
+	PUNPCKLWL X5, X2
+	PUNPCKHWL X5, X6
+
+	WIDEN(X2, X0, 0)
+	WIDEN(X6, X1, 32)
+
+dequant_sse2_next:
+	ADDQ $64, DI
+	ADDQ $8, SI
+	ADDQ $8, R8
+	SHRQ $8, AX
+	JMP  dequant_sse2_loop
+
+dequant_sse2_done:
+	RET
+
+// dequantizeAVX2 is the AVX2 counterpart of dequantizeSSE2, a row of 8 dwords
+// per register, with VPMULLD for the products and VPMINSD/VPMAXSD for the clip.
+//
+// func dequantizeAVX2(block *[64]int, coded uint64, quantMatrix *[64]byte, quantizerScale int, intra bool)
+//
+// Persistent registers mirror the SSE2 version; Y11 holds the lane bits,
+// Y9/Y10 the clip bounds.
+TEXT ·dequantizeAVX2(SB), NOSPLIT, $0-33
+	MOVQ    block+0(FP), DI
+	MOVQ    coded+8(FP), AX
+	MOVQ    quantMatrix+16(FP), SI
+	MOVQ    quantizerScale+24(FP), BX
+	MOVBQZX intra+32(FP), CX
+	LEAQ    ·videoPremultiplierMatrix(SB), R8
+
+	VPXOR        Y15, Y15, Y15
+	VMOVQ        BX, X14
+	VPBROADCASTD X14, Y14
+	VPCMPEQD     Y12, Y12, Y12
+	VPSRLD       $31, Y12, Y12
+	DECQ         CX
+	VMOVQ        CX, X13
+	VPBROADCASTD X13, Y13
+	VMOVDQU      dequantBits<>(SB), Y11
+	MOVQ         $2047, BX
+	VMOVQ        BX, X10
+	VPBROADCASTD X10, Y10
+	MOVQ         $-2048, BX
+	VMOVQ        BX, X9
+	VPBROADCASTD X9, Y9
+
+dequant_avx2_loop:
+	TESTQ AX, AX
+	JZ    dequant_avx2_done
+	MOVQ  AX, BX
+	ANDQ  $0xff, BX
+	JZ    dequant_avx2_next
+
+	// Lane masks of the coded coefficients.
+	VMOVQ        BX, X0
+	VPBROADCASTD X0, Y0
+	VPAND        Y11, Y0, Y0
+	VPCMPEQD     Y11, Y0, Y0
+
+	// Levels, narrowed to dwords.
+	VMOVDQU (DI), Y1
+	VMOVDQU 32(DI), Y2
+	VSHUFPS $0x88, Y2, Y1, Y3
+	VPERMQ  $0xd8, Y3, Y3
+
+	// level = level<<1 + sign(level) for non-intra blocks
+	VPSRAD $31, Y3, Y4
+	VPOR   Y12, Y4, Y4
+	VPAND  Y13, Y4, Y4
+	VPSLLD $1, Y3, Y3
+	VPADDD Y4, Y3, Y3
+
+	// level = (level * quantizerScale * quantMatrix[i]) >> 4
+	VPMOVZXBD (SI), Y4
+	VPMULLD   Y14, Y4, Y4
+	VPMULLD   Y4, Y3, Y3
+	VPSRAD    $4, Y3, Y3
+
+	// Oddify
+	VPCMPGTD Y15, Y3, Y4
+	VPSLLD   $1, Y4, Y4
+	VPOR     Y12, Y4, Y4
+	VPAND    Y12, Y3, Y5
+	VPSUBD   Y12, Y5, Y5
+	VPAND    Y5, Y4, Y4
+	VPADDD   Y4, Y3, Y3
+
+	// Clip and premultiply
+	VPMINSD   Y10, Y3, Y3
+	VPMAXSD   Y9, Y3, Y3
+	VPMOVZXBD (R8), Y4
+	VPMULLD   Y4, Y3, Y3
+
+	// Sign-extend to qwords and store the coded lanes.
+	VPMOVSXDQ   X3, Y4
+	VEXTRACTI128 $1, Y3, X5
+	VPMOVSXDQ   X5, Y5
+	VPMOVSXDQ   X0, Y6
+	VEXTRACTI128 $1, Y0, X7
+	VPMOVSXDQ   X7, Y7
+	VPBLENDVB   Y6, Y4, Y1, Y1
+	VPBLENDVB   Y7, Y5, Y2, Y2
+	VMOVDQU     Y1, (DI)
+	VMOVDQU     Y2, 32(DI)
+
+dequant_avx2_next:
+	ADDQ $64, DI
+	ADDQ $8, SI
+	ADDQ $8, R8
+	SHRQ $8, AX
+	JMP  dequant_avx2_loop
+
+dequant_avx2_done:
+	VZEROUPPER
+	RET
+
+// idctSSE2 implements the IDCT of idctGeneric with SSE2, in dwords, which is
+// exact for the coefficients the decoder produces (see idctMaxDC). The block is
+// narrowed to a local 8x8 block of dwords, and each pass transforms 4 lanes at
+// a time: the columns in place, then the rows after a transpose to the second
+// local block. Below a maxIndex of 10 only the top-left 4x4 coefficients are
+// used, as in idctGeneric, the others are cleared and their columns skipped. The rows are rounded by adding 128 to their DC terms, which
+// appear in every output with a factor of 1. SSE2 has no PMULLD, the products
+// by the constants are built from two PMULUDQ.
+//
+// func idctSSE2(block *[64]int, maxIndex int)
+//
+// Locals: 0(SP) = the block in dwords, 256(SP) = the transposed block.
+
+// MULC: dst = src * c, per dword.
+#define MULC(src, c, dst, t) \
+	PSHUFL    $0xf5, src, t  \
+	MOVO      src, dst       \
+	PMULULQ   c, dst         \
+	PMULULQ   c, t           \
+	PSHUFL    $0x08, dst, dst \
+	PSHUFL    $0x08, t, t    \
+	PUNPCKLLQ t, dst
+
+// IDCTPASS: the 1-D transform of the 4 lanes of 8 rows at (BX), 32 bytes apart, in place.
+#define IDCTPASS \
+	MOVOU (BX), X0        \
+	MOVOU 32(BX), X1      \
+	MOVOU 64(BX), X2      \
+	MOVOU 96(BX), X3      \
+	MOVOU 128(BX), X4     \
+	MOVOU 160(BX), X5     \
+	MOVOU 192(BX), X6     \
+	MOVOU 224(BX), X7     \
+	MOVO  X1, X8          \
+	PADDL X7, X8          \
+	PSUBL X7, X1          \
+	MOVO  X3, X9          \
+	PADDL X5, X9          \
+	PSUBL X3, X5          \
+	MOVO  X2, X10         \
+	PADDL X6, X10         \
+	PSUBL X6, X2          \
+	MOVO  X8, X11         \
+	PADDL X9, X11         \
+	PSUBL X9, X8          \
+	MOVO  X0, X6          \
+	PADDL X4, X6          \
+	PSUBL X4, X0          \
+	MULC(X1, idct473<>(SB), X3, X7) \
+	MULC(X5, idct196<>(SB), X4, X7) \
+	PSUBL X4, X3          \
+	PADDL idct128<>(SB), X3 \
+	PSRAL $8, X3          \
+	PSUBL X11, X3         \
+	MULC(X5, idct473<>(SB), X12, X7) \
+	MULC(X1, idct196<>(SB), X4, X7) \
+	PADDL X4, X12         \
+	PADDL idct128<>(SB), X12 \
+	PSRAL $8, X12         \
+	MULC(X8, idct362<>(SB), X9, X7) \
+	PADDL idct128<>(SB), X9 \
+	PSRAL $8, X9          \
+	MOVO  X3, X8          \
+	PSUBL X9, X8          \
+	MULC(X2, idct362<>(SB), X9, X7) \
+	PADDL idct128<>(SB), X9 \
+	PSRAL $8, X9          \
+	PSUBL X10, X9         \
+	MOVO  X0, X1          \
+	PADDL X9, X1          \
+	PSUBL X9, X0          \
+	MOVO  X6, X4          \
+	PADDL X10, X4         \
+	PSUBL X10, X6         \
+	PXOR  X7, X7          \
+	PSUBL X8, X7          \
+	PSUBL X12, X7         \
+	MOVO  X11, X13        \
+	PADDL X4, X13         \
+	MOVOU X13, (BX)       \
+	PSUBL X11, X4         \
+	MOVOU X4, 224(BX)     \
+	MOVO  X3, X13         \
+	PADDL X1, X13         \
+	MOVOU X13, 32(BX)     \
+	PSUBL X3, X1          \
+	MOVOU X1, 192(BX)     \
+	MOVO  X0, X13         \
+	PSUBL X8, X13         \
+	MOVOU X13, 64(BX)     \
+	PADDL X0, X8          \
+	MOVOU X8, 160(BX)     \
+	MOVO  X6, X13         \
+	PSUBL X7, X13         \
+	MOVOU X13, 96(BX)     \
+	PADDL X7, X6          \
+	MOVOU X6, 128(BX)
+
+// TRANSPOSE4: transposes the 4x4 dwords at (SI) to (BX), rows 32 bytes apart.
+#define TRANSPOSE4 \
+	MOVOU      (SI), X0   \
+	MOVOU      32(SI), X1 \
+	MOVOU      64(SI), X2 \
+	MOVOU      96(SI), X3 \
+	MOVO       X0, X4     \
+	PUNPCKLLQ  X1, X4     \
+	PUNPCKHLQ  X1, X0     \
+	MOVO       X2, X5     \
+	PUNPCKLLQ  X3, X5     \
+	PUNPCKHLQ  X3, X2     \
+	MOVO       X4, X1     \
+	PUNPCKLQDQ X5, X1     \
+	PUNPCKHQDQ X5, X4     \
+	MOVO       X0, X3     \
+	PUNPCKLQDQ X2, X3     \
+	PUNPCKHQDQ X2, X0     \
+	MOVOU      X1, (BX)   \
+	MOVOU      X4, 32(BX) \
+	MOVOU      X3, 64(BX) \
+	MOVOU      X0, 96(BX)
+
+// TRANSPOSE8: transposes the 8x8 dwords at src(SP) to dst(SP).
+#define TRANSPOSE8(src, dst) \
+	LEAQ src+0(SP), SI    \
+	LEAQ dst+0(SP), BX    \
+	TRANSPOSE4            \
+	LEAQ src+16(SP), SI   \
+	LEAQ dst+128(SP), BX  \
+	TRANSPOSE4            \
+	LEAQ src+128(SP), SI  \
+	LEAQ dst+16(SP), BX   \
+	TRANSPOSE4            \
+	LEAQ src+144(SP), SI  \
+	LEAQ dst+144(SP), BX  \
+	TRANSPOSE4
+
+TEXT ·idctSSE2(SB), NOSPLIT, $512-16
+	MOVQ block+0(FP), DI
+
+	// Narrow the block to dwords.
+	MOVQ DI, SI
+	LEAQ 0(SP), BX
+	MOVQ $16, CX
+
+idct_sse2_narrow:
+	MOVOU  (SI), X0
+	MOVOU  16(SI), X1
+	SHUFPS $0x88, X1, X0
+	MOVOU  X0, (BX)
+	ADDQ   $32, SI
+	ADDQ   $16, BX
+	DECQ   CX
+	JNZ    idct_sse2_narrow
+
+	MOVQ maxIndex+8(FP), AX
+	CMPQ AX, $10
+	JGE  idct_sse2_columns
+
+	// Sparse: only the top-left 4x4 coefficients.
+	PXOR  X0, X0
+	MOVOU X0, 16(SP)
+	MOVOU X0, 48(SP)
+	MOVOU X0, 80(SP)
+	MOVOU X0, 112(SP)
+	MOVOU X0, 128(SP)
+	MOVOU X0, 144(SP)
+	MOVOU X0, 160(SP)
+	MOVOU X0, 176(SP)
+	MOVOU X0, 192(SP)
+	MOVOU X0, 208(SP)
+	MOVOU X0, 224(SP)
+	MOVOU X0, 240(SP)
+	LEAQ  0(SP), BX
+	IDCTPASS
+	JMP   idct_sse2_rows
+
+idct_sse2_columns:
+	LEAQ 0(SP), BX
+	IDCTPASS
+	LEAQ 16(SP), BX
+	IDCTPASS
+
+idct_sse2_rows:
+	// Rows, rounded by the bias of the DC terms.
+	TRANSPOSE8(0, 256)
+	MOVOU 256(SP), X0
+	PADDL idct128<>(SB), X0
+	MOVOU X0, 256(SP)
+	MOVOU 272(SP), X0
+	PADDL idct128<>(SB), X0
+	MOVOU X0, 272(SP)
+	LEAQ  256(SP), BX
+	IDCTPASS
+	LEAQ  272(SP), BX
+	IDCTPASS
+	TRANSPOSE8(256, 0)
+
+	// Shift, sign-extend to qwords and store.
+	LEAQ 0(SP), SI
+	MOVQ $16, CX
+
+idct_sse2_widen:
+	MOVOU     (SI), X0
+	PSRAL     $8, X0
+	MOVO      X0, X1
+	PSRAL     $31, X1
+	MOVO      X0, X2
+	PUNPCKLLQ X1, X2
+	PUNPCKHLQ X1, X0
+	MOVOU     X2, (DI)
+	MOVOU     X0, 16(DI)
+	ADDQ      $16, SI
+	ADDQ      $32, DI
+	DECQ      CX
+	JNZ       idct_sse2_widen
+	RET
+
+// idctAVX2 is the AVX2 counterpart of idctSSE2, with the whole block in
+// Y0-Y7 as rows of 8 dwords, transposed in registers.
+//
+// func idctAVX2(block *[64]int, maxIndex int)
+
+// NARROW: row r of the block, narrowed to dwords in y.
+#define NARROW(off, y) \
+	VMOVDQU off(DI), Y8      \
+	VMOVDQU off+32(DI), Y9   \
+	VSHUFPS $0x88, Y9, Y8, y \
+	VPERMQ  $0xd8, y, y
+
+// WIDEN8: row y sign-extended to qwords, stored to off(DI).
+#define WIDEN8(y, x, off) \
+	VPMOVSXDQ    x, Y8      \
+	VEXTRACTI128 $1, y, X9  \
+	VPMOVSXDQ    X9, Y9     \
+	VMOVDQU      Y8, off(DI) \
+	VMOVDQU      Y9, off+32(DI)
+
+// VIDCTPASS: the 1-D transform of the rows Y0-Y7, in place.
+#define VIDCTPASS \
+	VPADDD  Y7, Y1, Y8              \
+	VPSUBD  Y7, Y1, Y1              \
+	VPADDD  Y5, Y3, Y9              \
+	VPSUBD  Y3, Y5, Y5              \
+	VPADDD  Y6, Y2, Y10             \
+	VPSUBD  Y6, Y2, Y2              \
+	VPADDD  Y9, Y8, Y11             \
+	VPSUBD  Y9, Y8, Y8              \
+	VPADDD  Y4, Y0, Y6              \
+	VPSUBD  Y4, Y0, Y0              \
+	VPMULLD idct473<>(SB), Y1, Y3   \
+	VPMULLD idct196<>(SB), Y5, Y4   \
+	VPSUBD  Y4, Y3, Y3              \
+	VPADDD  idct128<>(SB), Y3, Y3   \
+	VPSRAD  $8, Y3, Y3              \
+	VPSUBD  Y11, Y3, Y3             \
+	VPMULLD idct473<>(SB), Y5, Y12  \
+	VPMULLD idct196<>(SB), Y1, Y4   \
+	VPADDD  Y4, Y12, Y12            \
+	VPADDD  idct128<>(SB), Y12, Y12 \
+	VPSRAD  $8, Y12, Y12            \
+	VPMULLD idct362<>(SB), Y8, Y9   \
+	VPADDD  idct128<>(SB), Y9, Y9   \
+	VPSRAD  $8, Y9, Y9              \
+	VPSUBD  Y9, Y3, Y8              \
+	VPMULLD idct362<>(SB), Y2, Y9   \
+	VPADDD  idct128<>(SB), Y9, Y9   \
+	VPSRAD  $8, Y9, Y9              \
+	VPSUBD  Y10, Y9, Y9             \
+	VPADDD  Y9, Y0, Y1              \
+	VPSUBD  Y9, Y0, Y0              \
+	VPADDD  Y10, Y6, Y4             \
+	VPSUBD  Y10, Y6, Y6             \
+	VPXOR   Y7, Y7, Y7              \
+	VPSUBD  Y8, Y7, Y7              \
+	VPSUBD  Y12, Y7, Y7             \
+	VPADDD  Y4, Y11, Y13            \
+	VPSUBD  Y11, Y4, Y15            \
+	VPADDD  Y1, Y3, Y14             \
+	VPSUBD  Y3, Y1, Y9              \
+	VPSUBD  Y8, Y0, Y2              \
+	VPADDD  Y0, Y8, Y5              \
+	VPSUBD  Y7, Y6, Y3              \
+	VPADDD  Y7, Y6, Y4              \
+	VMOVDQA Y13, Y0                 \
+	VMOVDQA Y14, Y1                 \
+	VMOVDQA Y9, Y6                  \
+	VMOVDQA Y15, Y7
+
+// VTRANSPOSE: transposes the rows Y0-Y7.
+#define VTRANSPOSE \
+	VPUNPCKLDQ  Y1, Y0, Y8         \
+	VPUNPCKHDQ  Y1, Y0, Y9         \
+	VPUNPCKLDQ  Y3, Y2, Y10        \
+	VPUNPCKHDQ  Y3, Y2, Y11        \
+	VPUNPCKLDQ  Y5, Y4, Y12        \
+	VPUNPCKHDQ  Y5, Y4, Y13        \
+	VPUNPCKLDQ  Y7, Y6, Y14        \
+	VPUNPCKHDQ  Y7, Y6, Y15        \
+	VPUNPCKLQDQ Y10, Y8, Y0        \
+	VPUNPCKHQDQ Y10, Y8, Y1        \
+	VPUNPCKLQDQ Y11, Y9, Y2        \
+	VPUNPCKHQDQ Y11, Y9, Y3        \
+	VPUNPCKLQDQ Y14, Y12, Y4       \
+	VPUNPCKHQDQ Y14, Y12, Y5       \
+	VPUNPCKLQDQ Y15, Y13, Y6       \
+	VPUNPCKHQDQ Y15, Y13, Y7       \
+	VPERM2I128  $0x20, Y4, Y0, Y8  \
+	VPERM2I128  $0x20, Y5, Y1, Y9  \
+	VPERM2I128  $0x20, Y6, Y2, Y10 \
+	VPERM2I128  $0x20, Y7, Y3, Y11 \
+	VPERM2I128  $0x31, Y4, Y0, Y12 \
+	VPERM2I128  $0x31, Y5, Y1, Y13 \
+	VPERM2I128  $0x31, Y6, Y2, Y14 \
+	VPERM2I128  $0x31, Y7, Y3, Y15 \
+	VMOVDQA     Y8, Y0             \
+	VMOVDQA     Y9, Y1             \
+	VMOVDQA     Y10, Y2            \
+	VMOVDQA     Y11, Y3            \
+	VMOVDQA     Y12, Y4            \
+	VMOVDQA     Y13, Y5            \
+	VMOVDQA     Y14, Y6            \
+	VMOVDQA     Y15, Y7
+
+TEXT ·idctAVX2(SB), NOSPLIT, $0-16
+	MOVQ block+0(FP), DI
+
+	NARROW(0, Y0)
+	NARROW(64, Y1)
+	NARROW(128, Y2)
+	NARROW(192, Y3)
+	NARROW(256, Y4)
+	NARROW(320, Y5)
+	NARROW(384, Y6)
+	NARROW(448, Y7)
+
+	MOVQ maxIndex+8(FP), AX
+	CMPQ AX, $10
+	JGE  idct_avx2_columns
+
+	// Sparse: only the top-left 4x4 coefficients.
+	VMOVDQU idctSparse<>(SB), Y8
+	VPAND   Y8, Y0, Y0
+	VPAND   Y8, Y1, Y1
+	VPAND   Y8, Y2, Y2
+	VPAND   Y8, Y3, Y3
+	VPXOR   Y4, Y4, Y4
+	VPXOR   Y5, Y5, Y5
+	VPXOR   Y6, Y6, Y6
+	VPXOR   Y7, Y7, Y7
+
+idct_avx2_columns:
+	// Columns
+	VIDCTPASS
+
+	// Rows, rounded by the bias of the DC terms.
+	VTRANSPOSE
+	VPADDD idct128<>(SB), Y0, Y0
+	VIDCTPASS
+	VPSRAD $8, Y0, Y0
+	VPSRAD $8, Y1, Y1
+	VPSRAD $8, Y2, Y2
+	VPSRAD $8, Y3, Y3
+	VPSRAD $8, Y4, Y4
+	VPSRAD $8, Y5, Y5
+	VPSRAD $8, Y6, Y6
+	VPSRAD $8, Y7, Y7
+	VTRANSPOSE
+
+	WIDEN8(Y0, X0, 0)
+	WIDEN8(Y1, X1, 64)
+	WIDEN8(Y2, X2, 128)
+	WIDEN8(Y3, X3, 192)
+	WIDEN8(Y4, X4, 256)
+	WIDEN8(Y5, X5, 320)
+	WIDEN8(Y6, X6, 384)
+	WIDEN8(Y7, X7, 448)
+
+	VZEROUPPER
+	RET
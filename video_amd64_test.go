@@ -18,3 +18,25 @@ func TestCopyMacroblockParityAVX2(t *testing.T) {
 	}
 	runParitySweep(t, copyMacroblockAVX2)
 }
+
+func TestIdctParitySSE2(t *testing.T) {
+	runIdctParity(t, idctSSE2)
+}
+
+func TestIdctParityAVX2(t *testing.T) {
+	if !isAVX2 {
+		t.Skip("CPU does not support AVX2")
+	}
+	runIdctParity(t, idctAVX2)
+}
+
+func TestDequantizeParitySSE2(t *testing.T) {
+	runDequantizeParity(t, dequantizeSSE2)
+}
+
+func TestDequantizeParityAVX2(t *testing.T) {
+	if !isAVX2 {
+		t.Skip("CPU does not support AVX2")
+	}
+	runDequantizeParity(t, dequantizeAVX2)
+}
@@ -8,3 +8,11 @@ func copyMacroblockNEON(motionH, motionV, mbRow, mbCol, lumaWidth, chromaWidth i
 func copyMacroblock(motionH, motionV, mbRow, mbCol, lumaWidth, chromaWidth int, s, d *Frame) {
 	copyMacroblockNEON(motionH, motionV, mbRow, mbCol, lumaWidth, chromaWidth, s, d)
 }
+
+func dequantize(block *[64]int, coded uint64, quantMatrix *[64]byte, quantizerScale int, intra bool) {
+	dequantizeGeneric(block, coded, quantMatrix, quantizerScale, intra)
+}
+
+func idct(block *[64]int, maxIndex int) {
+	idctGeneric(block, maxIndex)
+}
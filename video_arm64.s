@@ -45,8 +45,8 @@ TEXT ·copyMacroblockNEON(SB), NOSPLIT, $0-64
 	AND $1, R1, R11
 
 	// Source pointer = Y.Data + ((mbRow<<4)+vInt)*stride + (mbCol<<4)+hInt
-	MOVD 40(R6), R12
-	MOVD 40(R7), R13
+	MOVD 48(R6), R12
+	MOVD 48(R7), R13
 	LSL  $4, R2, R14
 	ADD  R9, R14, R14
 	MUL  R4, R14, R14
@@ -204,13 +204,13 @@ chroma_begin:
 	ADD R22, R14, R14
 
 	// Cb pointers (current) and Cr pointers (held for the second pass).
-	MOVD 80(R6), R12
+	MOVD 88(R6), R12
 	ADD  R15, R12, R12
-	MOVD 80(R7), R13
+	MOVD 88(R7), R13
 	ADD  R14, R13, R13
-	MOVD 120(R6), R23
+	MOVD 128(R6), R23
 	ADD  R15, R23, R23
-	MOVD 120(R7), R24
+	MOVD 128(R7), R24
 	ADD  R14, R24, R24
 
 	MOVD $0, R21 // plane flag: 0 = Cb, 1 = Cr
@@ -78,3 +78,11 @@ func copyBlock(src, dst []byte, stride, si, di, size int, oddH, oddV bool) {
 		di += stride
 	}
 }
+
+func dequantize(block *[64]int, coded uint64, quantMatrix *[64]byte, quantizerScale int, intra bool) {
+	dequantizeGeneric(block, coded, quantMatrix, quantizerScale, intra)
+}
+
+func idct(block *[64]int, maxIndex int) {
+	idctGeneric(block, maxIndex)
+}
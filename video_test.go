@@ -1,7 +1,9 @@
 package mpeg
 
 import (
+	"math/rand/v2"
 	"testing"
+	"unsafe"
 )
 
 // copyMacroblockRef is a scalar reference implementation of the MPEG-1 block
@@ -64,6 +66,24 @@ func TestCopyMacroblockParity(t *testing.T) {
 	runParitySweep(t, copyMacroblock)
 }
 
+// TestFrameLayout checks the offsets of the plane data in Frame, which are hardcoded in the assembly.
+func TestFrameLayout(t *testing.T) {
+	var f Frame
+	for _, tc := range []struct {
+		name   string
+		offset uintptr
+		want   uintptr
+	}{
+		{"Y.Data", unsafe.Offsetof(f.Y) + unsafe.Offsetof(f.Y.Data), 48},
+		{"Cb.Data", unsafe.Offsetof(f.Cb) + unsafe.Offsetof(f.Cb.Data), 88},
+		{"Cr.Data", unsafe.Offsetof(f.Cr) + unsafe.Offsetof(f.Cr.Data), 128},
+	} {
+		if tc.offset != tc.want {
+			t.Errorf("%s: got offset %d, want %d", tc.name, tc.offset, tc.want)
+		}
+	}
+}
+
 // runParitySweep checks fn against the scalar oracle across both half-pel
 // fractions on each axis. Positions start at macroblock 1 so the negative
 // motion vectors (which exercise the toward-zero chroma rounding) stay in
@@ -102,6 +122,129 @@ func runParitySweep(t *testing.T, fn copyMacroblockFunc) {
 	}
 }
 
+type idctFunc func(block *[64]int, maxIndex int)
+
+type dequantizeFunc func(block *[64]int, coded uint64, quantMatrix *[64]byte, quantizerScale int, intra bool)
+
+func TestIdctParity(t *testing.T) {
+	runIdctParity(t, idct)
+}
+
+func TestDequantizeParity(t *testing.T) {
+	runDequantizeParity(t, dequantize)
+}
+
+// testCoefficients returns the coefficients of a block as the decoder produces them: dequantized and
+// premultiplied, with the DC coefficient below idctMaxDC. sign picks the sign of each coefficient, count
+// the number of coded coefficients in zigzag order.
+func testCoefficients(r *rand.Rand, count int, sign func(i int) int) *[64]int {
+	var block [64]int
+	for n := range count {
+		i := int(videoZigZag[n])
+		block[i] = sign(i) * r.IntN(2049) * int(videoPremultiplierMatrix[i])
+	}
+	block[0] = sign(0) * r.IntN(idctMaxDC)
+
+	return &block
+}
+
+// runIdctParity checks fn against idctGeneric for random blocks, the blocks with the largest
+// coefficients for several sign patterns, and sparse blocks.
+func runIdctParity(t *testing.T, fn idctFunc) {
+	t.Helper()
+
+	r := rand.New(rand.NewPCG(5, 6))
+	random := func(int) int { return 1 - 2*r.IntN(2) }
+
+	var blocks []*[64]int
+	for range 2000 {
+		blocks = append(blocks, testCoefficients(r, 1+r.IntN(64), random))
+	}
+	for _, sign := range []func(i int) int{
+		func(int) int { return 1 },
+		func(int) int { return -1 },
+		func(i int) int { return 1 - 2*((i>>3^i)&1) },
+		func(i int) int { return 1 - 2*(i>>5&1) },
+		random,
+	} {
+		block := testCoefficients(r, 64, sign)
+		for i := range block {
+			block[i] = sign(i) * 2048 * int(videoPremultiplierMatrix[i])
+		}
+		block[0] = sign(0) * (idctMaxDC - 1)
+		blocks = append(blocks, block)
+	}
+
+	for _, block := range blocks {
+		got, want := *block, *block
+		fn(&got, 64)
+		idctGeneric(&want, 64)
+
+		if got != want {
+			t.Fatalf("block %v: got %v, want %v", *block, got, want)
+		}
+	}
+
+	// Below a maxIndex of 10 only the top-left 4x4 coefficients are used, the others can be
+	// left from a previous block after a corrupt one.
+	for range 200 {
+		block := testCoefficients(r, 64, random)
+		maxIndex := 1 + r.IntN(9)
+
+		got, want := *block, *block
+		fn(&got, maxIndex)
+		idctGeneric(&want, maxIndex)
+
+		if got != want {
+			t.Fatalf("sparse block %v, maxIndex %d: got %v, want %v", *block, maxIndex, got, want)
+		}
+	}
+}
+
+// runDequantizeParity checks fn against dequantizeGeneric for random levels, quantizer matrices and scales,
+// and that the coefficients that are not coded are left as they are.
+func runDequantizeParity(t *testing.T, fn dequantizeFunc) {
+	t.Helper()
+
+	r := rand.New(rand.NewPCG(7, 8))
+
+	for i := range 5000 {
+		var block [64]int
+		for j := range block {
+			block[j] = int(r.Int64())
+		}
+
+		coded := r.Uint64() & r.Uint64()
+		switch i % 4 {
+		case 1:
+			coded = 1 << r.IntN(64)
+		case 2:
+			coded = ^uint64(0)
+		}
+		for j := range block {
+			if coded&(1<<j) != 0 {
+				block[j] = r.IntN(513) - 256
+			}
+		}
+
+		var quantMatrix [64]byte
+		for j := range quantMatrix {
+			quantMatrix[j] = byte(r.Uint32())
+		}
+		quantizerScale := r.IntN(32)
+		intra := i%2 == 0
+
+		got, want := block, block
+		fn(&got, coded, &quantMatrix, quantizerScale, intra)
+		dequantizeGeneric(&want, coded, &quantMatrix, quantizerScale, intra)
+
+		if got != want {
+			t.Fatalf("levels %v, coded %#x, scale %d, intra %v: got %v, want %v",
+				block, coded, quantizerScale, intra, got, want)
+		}
+	}
+}
+
 func benchmarkCopyMacroblock(b *testing.B, motionH, motionV int) {
 	const lumaWidth, chromaWidth = 64, 32
 	src := newTestFrame(lumaWidth, chromaWidth, 1)
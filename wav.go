@@ -0,0 +1,461 @@
+package mpeg
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// ErrInvalidWAV is the error returned when a WAV stream can not be read or written.
+var ErrInvalidWAV = errors.New("invalid WAV")
+
+// WAV format tags.
+const (
+	wavFormatPCM        = 0x0001
+	wavFormatFloat      = 0x0003
+	wavFormatExtensible = 0xFFFE
+)
+
+// WAVWriter writes Samples as a WAV stream. AudioS16 is written as 16-bit PCM, the float formats
+// as normalized 32-bit IEEE float. Samples of any format can be written, they are converted.
+//
+// The sizes in the header are fixed up on Close if the writer is an io.WriteSeeker, otherwise they are
+// set to the maximum, which most readers take as a stream that lasts until the end of the data.
+type WAVWriter struct {
+	bw     *bufio.Writer
+	seeker io.WriteSeeker
+	start  int64
+
+	samplerate int
+	channels   int
+	format     AudioFormat
+
+	buf         []byte
+	frames      int64
+	wroteHeader bool
+}
+
+// NewWAVWriter creates a writer of a WAV stream with the samplerate, 1 or 2 channels and the format.
+// Mono streams take the left channel of the samples.
+func NewWAVWriter(w io.Writer, samplerate, channels int, format AudioFormat) (*WAVWriter, error) {
+	if samplerate <= 0 || channels < 1 || channels > 2 || format < AudioF32N || format > AudioS16 {
+		return nil, ErrInvalidWAV
+	}
+
+	wav := &WAVWriter{bw: bufio.NewWriter(w), samplerate: samplerate, channels: channels, format: format}
+
+	if seeker, ok := w.(io.WriteSeeker); ok {
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			wav.seeker = seeker
+			wav.start = start
+		}
+	}
+
+	return wav, nil
+}
+
+// WriteSamples writes the samples.
+func (w *WAVWriter) WriteSamples(samples *Samples) error {
+	if !w.wroteHeader {
+		if _, err := w.bw.Write(w.header(-1)); err != nil {
+			return err
+		}
+		w.wroteHeader = true
+	}
+
+	frames := samples.frames()
+
+	w.buf = w.buf[:0]
+	for i := 0; i < frames; i++ {
+		for ch := 0; ch < w.channels; ch++ {
+			if w.format == AudioS16 {
+				w.buf = binary.LittleEndian.AppendUint16(w.buf, uint16(samples.s16(i, ch)))
+			} else {
+				w.buf = binary.LittleEndian.AppendUint32(w.buf, math.Float32bits(samples.f32(i, ch)))
+			}
+		}
+	}
+
+	if _, err := w.bw.Write(w.buf); err != nil {
+		return err
+	}
+	w.frames += int64(frames)
+
+	return nil
+}
+
+// Close writes the header if no samples were written, flushes the buffered data and fixes up the sizes
+// in the header if the writer is seekable. It does not close the underlying writer.
+func (w *WAVWriter) Close() error {
+	if !w.wroteHeader {
+		if _, err := w.bw.Write(w.header(0)); err != nil {
+			return err
+		}
+		w.wroteHeader = true
+	}
+
+	if err := w.bw.Flush(); err != nil {
+		return err
+	}
+
+	if w.seeker == nil {
+		return nil
+	}
+
+	size := w.frames * int64(w.blockAlign())
+	if size > math.MaxUint32-w.headerSize() {
+		return nil
+	}
+
+	end, err := w.seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := w.seeker.Seek(w.start, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.seeker.Write(w.header(size)); err != nil {
+		return err
+	}
+	_, err = w.seeker.Seek(end, io.SeekStart)
+
+	return err
+}
+
+func (w *WAVWriter) blockAlign() int {
+	if w.format == AudioS16 {
+		return w.channels * 2
+	}
+
+	return w.channels * 4
+}
+
+// headerSize returns the size of the header counted in the RIFF size, without the RIFF chunk header and the data.
+func (w *WAVWriter) headerSize() int64 {
+	if w.format == AudioS16 {
+		return 36
+	}
+
+	return 50
+}
+
+// header returns the RIFF header for the data size, or for the largest size if it is negative.
+// Float streams have the extended fmt chunk and the fact chunk with the number of sample frames,
+// as non-PCM streams require.
+func (w *WAVWriter) header(size int64) []byte {
+	blockAlign := w.blockAlign()
+	float := w.format != AudioS16
+
+	if size < 0 {
+		size = math.MaxUint32 - w.headerSize()
+	}
+	dataSize := uint32(size)
+
+	h := make([]byte, 0, w.headerSize()+8)
+	h = append(h, "RIFF"...)
+	h = binary.LittleEndian.AppendUint32(h, dataSize+uint32(w.headerSize()))
+	h = append(h, "WAVEfmt "...)
+
+	if float {
+		h = binary.LittleEndian.AppendUint32(h, 18)
+		h = binary.LittleEndian.AppendUint16(h, wavFormatFloat)
+	} else {
+		h = binary.LittleEndian.AppendUint32(h, 16)
+		h = binary.LittleEndian.AppendUint16(h, wavFormatPCM)
+	}
+
+	h = binary.LittleEndian.AppendUint16(h, uint16(w.channels))
+	h = binary.LittleEndian.AppendUint32(h, uint32(w.samplerate))
+	h = binary.LittleEndian.AppendUint32(h, uint32(w.samplerate*blockAlign))
+	h = binary.LittleEndian.AppendUint16(h, uint16(blockAlign))
+	h = binary.LittleEndian.AppendUint16(h, uint16(blockAlign/w.channels*8))
+
+	if float {
+		h = binary.LittleEndian.AppendUint16(h, 0)
+		h = append(h, "fact"...)
+		h = binary.LittleEndian.AppendUint32(h, 4)
+		h = binary.LittleEndian.AppendUint32(h, dataSize/uint32(blockAlign))
+	}
+
+	h = append(h, "data"...)
+	h = binary.LittleEndian.AppendUint32(h, dataSize)
+
+	return h
+}
+
+// WAVReader reads 16-bit PCM and 32-bit IEEE float WAV streams with 1 or 2 channels as Samples.
+type WAVReader struct {
+	r *bufio.Reader
+
+	samplerate int
+	channels   int
+	float      bool
+	format     AudioFormat
+
+	remaining int64 // bytes left in the data chunk, -1 if it lasts until the end
+	frames    int64
+	buf       []byte
+}
+
+// NewWAVReader reads the header from r, up to the start of the data chunk.
+func NewWAVReader(r io.Reader) (*WAVReader, error) {
+	wav := &WAVReader{r: bufio.NewReader(r)}
+
+	var header [12]byte
+	if _, err := io.ReadFull(wav.r, header[:]); err != nil {
+		return nil, errors.Join(ErrInvalidWAV, err)
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return nil, ErrInvalidWAV
+	}
+
+	hasFormat := false
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(wav.r, chunk[:]); err != nil {
+			return nil, errors.Join(ErrInvalidWAV, err)
+		}
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		switch string(chunk[0:4]) {
+		case "fmt ":
+			if size < 16 || size > 1024 {
+				return nil, ErrInvalidWAV
+			}
+
+			data := make([]byte, size+size&1)
+			if _, err := io.ReadFull(wav.r, data); err != nil {
+				return nil, errors.Join(ErrInvalidWAV, err)
+			}
+
+			if err := wav.parseFormat(data[:size]); err != nil {
+				return nil, err
+			}
+			hasFormat = true
+		case "data":
+			if !hasFormat {
+				return nil, ErrInvalidWAV
+			}
+
+			// Streams have the size 0 or the largest one, either way they last until the end.
+			wav.remaining = size
+			if size == 0 {
+				wav.remaining = -1
+			}
+
+			return wav, nil
+		default:
+			size += size & 1
+			if _, err := io.CopyN(io.Discard, wav.r, size); err != nil {
+				return nil, errors.Join(ErrInvalidWAV, err)
+			}
+		}
+	}
+}
+
+// parseFormat parses the fmt chunk.
+func (w *WAVReader) parseFormat(data []byte) error {
+	tag := binary.LittleEndian.Uint16(data[0:])
+	w.channels = int(binary.LittleEndian.Uint16(data[2:]))
+	w.samplerate = int(binary.LittleEndian.Uint32(data[4:]))
+	bits := binary.LittleEndian.Uint16(data[14:])
+
+	// The extensible format keeps the tag in the first bytes of the sub-format GUID.
+	if tag == wavFormatExtensible {
+		if len(data) < 40 {
+			return ErrInvalidWAV
+		}
+		tag = binary.LittleEndian.Uint16(data[24:])
+	}
+
+	switch {
+	case tag == wavFormatPCM && bits == 16:
+		w.format = AudioS16
+	case tag == wavFormatFloat && bits == 32:
+		w.float = true
+		w.format = AudioF32N
+	default:
+		return ErrInvalidWAV
+	}
+
+	if w.channels < 1 || w.channels > 2 || w.samplerate <= 0 {
+		return ErrInvalidWAV
+	}
+
+	return nil
+}
+
+// Samplerate returns the samplerate in samples per second.
+func (w *WAVReader) Samplerate() int {
+	return w.samplerate
+}
+
+// Channels returns the number of channels, 1 or 2.
+func (w *WAVReader) Channels() int {
+	return w.channels
+}
+
+// AudioFormat returns the format of the samples returned by Read.
+// It is AudioS16 for 16-bit PCM and AudioF32N for float streams, unless set with SetAudioFormat.
+func (w *WAVReader) AudioFormat() AudioFormat {
+	return w.format
+}
+
+// SetAudioFormat sets the format of the samples returned by Read, the samples are converted.
+func (w *WAVReader) SetAudioFormat(format AudioFormat) {
+	w.format = format
+}
+
+// Read reads the next SamplesPerFrame samples, the last chunk may be shorter.
+// Like decoded samples, they are interleaved stereo, mono streams have the same samples in both channels.
+// Returns io.EOF at the end of the stream.
+func (w *WAVReader) Read() (*Samples, error) {
+	sampleSize := 2
+	if w.float {
+		sampleSize = 4
+	}
+	blockAlign := sampleSize * w.channels
+
+	size := int64(SamplesPerFrame * blockAlign)
+	if w.remaining >= 0 {
+		size = min(size, w.remaining-w.remaining%int64(blockAlign))
+	}
+	if size == 0 {
+		return nil, io.EOF
+	}
+
+	if cap(w.buf) < int(size) {
+		w.buf = make([]byte, size)
+	}
+	w.buf = w.buf[:size]
+
+	n, err := io.ReadFull(w.r, w.buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if w.remaining >= 0 {
+		w.remaining -= int64(n)
+	}
+
+	frames := n / blockAlign
+	if frames == 0 {
+		return nil, io.EOF
+	}
+
+	ticks := w.frames * ClockRate / int64(w.samplerate)
+	samples := &Samples{Time: float64(ticks) / ClockRate, Ticks: ticks, format: w.format}
+	w.frames += int64(frames)
+
+	switch w.format {
+	case AudioF32N:
+		samples.Interleaved = make([]float32, frames*2)
+	case AudioF32NLR:
+		samples.Left = make([]float32, frames)
+		samples.Right = make([]float32, frames)
+	case AudioF32:
+		samples.F32 = make([]float32, frames*2)
+	case AudioS16:
+		samples.S16 = make([]int16, frames*2)
+	}
+
+	for i := 0; i < frames; i++ {
+		for ch := 0; ch < 2; ch++ {
+			p := w.buf[i*blockAlign+min(ch, w.channels-1)*sampleSize:]
+
+			if w.float {
+				samples.setF32(i, ch, math.Float32frombits(binary.LittleEndian.Uint32(p)))
+			} else {
+				samples.setS16(i, ch, int16(binary.LittleEndian.Uint16(p)))
+			}
+		}
+	}
+
+	return samples, nil
+}
+
+// frames returns the number of samples per channel.
+func (s *Samples) frames() int {
+	switch s.format {
+	case AudioF32N:
+		return len(s.Interleaved) / 2
+	case AudioF32NLR:
+		return len(s.Left)
+	case AudioF32:
+		return len(s.F32) / 2
+	case AudioS16:
+		return len(s.S16) / 2
+	}
+
+	return 0
+}
+
+// f32 returns the normalized sample i of the channel.
+func (s *Samples) f32(i, ch int) float32 {
+	switch s.format {
+	case AudioF32N:
+		return s.Interleaved[i<<1+ch]
+	case AudioF32NLR:
+		if ch != 0 {
+			return s.Right[i]
+		}
+		return s.Left[i]
+	case AudioF32:
+		return s.F32[i<<1+ch] / 0x80000000
+	case AudioS16:
+		return float32(s.S16[i<<1+ch]) / 0x8000
+	}
+
+	return 0
+}
+
+// s16 returns the sample i of the channel as signed 16-bit, scaled like the decoder does.
+func (s *Samples) s16(i, ch int) int16 {
+	if s.format == AudioS16 {
+		return s.S16[i<<1+ch]
+	}
+
+	f := min(max(s.f32(i, ch), -1), 1)
+	if f < 0 {
+		return int16(f * 0x8000)
+	}
+
+	return int16(f * 0x7FFF)
+}
+
+// setF32 sets the sample i of the channel from a normalized float.
+func (s *Samples) setF32(i, ch int, f float32) {
+	switch s.format {
+	case AudioF32N:
+		s.Interleaved[i<<1+ch] = f
+	case AudioF32NLR:
+		if ch != 0 {
+			s.Right[i] = f
+		} else {
+			s.Left[i] = f
+		}
+	case AudioF32:
+		if f < 0 {
+			s.F32[i<<1+ch] = f * 0x80000000
+		} else {
+			s.F32[i<<1+ch] = f * 0x7FFFFFFF
+		}
+	case AudioS16:
+		f = min(max(f, -1), 1)
+		if f < 0 {
+			s.S16[i<<1+ch] = int16(f * 0x8000)
+		} else {
+			s.S16[i<<1+ch] = int16(f * 0x7FFF)
+		}
+	}
+}
+
+// setS16 sets the sample i of the channel from signed 16-bit.
+func (s *Samples) setS16(i, ch int, v int16) {
+	if s.format == AudioS16 {
+		s.S16[i<<1+ch] = v
+	} else {
+		s.setF32(i, ch, float32(v)/0x8000)
+	}
+}
@@ -0,0 +1,138 @@
+package mpeg_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gen2brain/mpeg"
+)
+
+func TestWAV(t *testing.T) {
+	decode := func(format mpeg.AudioFormat) []*mpeg.Samples {
+		m, err := mpeg.New(bytes.NewReader(testMp2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.SetAudioFormat(format)
+
+		var chunks []*mpeg.Samples
+		for samples := m.DecodeAudio(); samples != nil; samples = m.DecodeAudio() {
+			chunks = append(chunks, &mpeg.Samples{S16: slices.Clone(samples.S16), Interleaved: slices.Clone(samples.Interleaved)})
+		}
+
+		return chunks
+	}
+
+	write := func(w io.Writer, format mpeg.AudioFormat) {
+		m, err := mpeg.New(bytes.NewReader(testMp2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.SetAudioFormat(format)
+
+		wav, err := mpeg.NewWAVWriter(w, m.Samplerate(), m.Channels(), format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for samples := m.DecodeAudio(); samples != nil; samples = m.DecodeAudio() {
+			if err := wav.WriteSamples(samples); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := wav.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 16-bit PCM to a seekable writer has the sizes fixed up.
+	f, err := os.CreateTemp(t.TempDir(), "*.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	write(f, mpeg.AudioS16)
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := decode(mpeg.AudioS16)
+	if size := len(want) * mpeg.SamplesPerFrame * 2; len(data) != 44+size || binary.LittleEndian.Uint32(data[4:]) != uint32(36+size) ||
+		binary.LittleEndian.Uint32(data[40:]) != uint32(size) || binary.LittleEndian.Uint16(data[20:]) != 1 || binary.LittleEndian.Uint16(data[22:]) != 1 {
+		t.Fatalf("WriteSamples: got %d bytes, header %x", len(data), data[:44])
+	}
+
+	r, err := mpeg.NewWAVReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Samplerate() != 44100 || r.Channels() != 1 || r.AudioFormat() != mpeg.AudioS16 {
+		t.Errorf("NewWAVReader: got %d Hz, %d channels, format %d", r.Samplerate(), r.Channels(), r.AudioFormat())
+	}
+
+	for i, chunk := range want {
+		samples, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(samples.S16, chunk.S16) || samples.Ticks != int64(i)*mpeg.SamplesPerFrame*mpeg.ClockRate/44100 {
+			t.Fatalf("Read: chunk %d differs", i)
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("Read: got error %v, want %v", err, io.EOF)
+	}
+
+	// Float to a pipe keeps the streaming sizes, the reader reads to the end.
+	var b bytes.Buffer
+	write(&b, mpeg.AudioF32N)
+
+	data = b.Bytes()
+	if string(data[38:42]) != "fact" || binary.LittleEndian.Uint16(data[20:]) != 3 || binary.LittleEndian.Uint32(data[4:]) != 0xFFFFFFFF {
+		t.Fatalf("WriteSamples: got header %x", data[:58])
+	}
+
+	want = decode(mpeg.AudioF32N)
+	r, err = mpeg.NewWAVReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	for samples, err := r.Read(); err != io.EOF; samples, err = r.Read() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(samples.Interleaved, want[n].Interleaved) {
+			t.Fatalf("Read: chunk %d differs", n)
+		}
+		n++
+	}
+	if n != len(want) {
+		t.Errorf("Read: got %d chunks, want %d", n, len(want))
+	}
+
+	// Converted to 16-bit, the float samples match the decoder.
+	r, err = mpeg.NewWAVReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetAudioFormat(mpeg.AudioS16)
+
+	want = decode(mpeg.AudioS16)
+	if samples, err := r.Read(); err != nil || !slices.Equal(samples.S16, want[0].S16) {
+		t.Errorf("Read: got %v, converted samples differ", err)
+	}
+
+	if _, err := mpeg.NewWAVReader(strings.NewReader("RIFF\x00\x00\x00\x00WAVEdata\x00\x00\x00\x00")); !errors.Is(err, mpeg.ErrInvalidWAV) {
+		t.Errorf("NewWAVReader: got error %v, want %v", err, mpeg.ErrInvalidWAV)
+	}
+}
@@ -0,0 +1,161 @@
+package mpeg
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// ErrInvalidWaveform is the error returned when a waveform can not be read or written.
+var ErrInvalidWaveform = errors.New("invalid waveform")
+
+// waveformMagic and waveformVersion identify the serialized waveform.
+const (
+	waveformMagic   = "MPGW"
+	waveformVersion = 1
+)
+
+// Waveform holds the minimum and maximum normalized sample of every SamplesPerPeak samples, for drawing the audio
+// on a timeline. The channels are not kept apart, each peak is taken over the samples of both channels.
+// Min and Max have the same length. It can be serialized to JSON, or in binary with WriteTo.
+type Waveform struct {
+	Samplerate     int       `json:"samplerate"`
+	SamplesPerPeak int       `json:"samples_per_peak"`
+	Min            []float32 `json:"min"`
+	Max            []float32 `json:"max"`
+}
+
+// Duration returns the duration of the peaks in seconds.
+func (w *Waveform) Duration() float64 {
+	if w.Samplerate == 0 {
+		return 0
+	}
+
+	return float64(len(w.Min)*w.SamplesPerPeak) / float64(w.Samplerate)
+}
+
+// WriteTo writes the waveform to w in a compact binary format, e.g. to cache it in a file.
+// Returns ErrInvalidWaveform if Min and Max differ in length.
+func (w *Waveform) WriteTo(wr io.Writer) (int64, error) {
+	if len(w.Min) != len(w.Max) {
+		return 0, ErrInvalidWaveform
+	}
+
+	buf := append([]byte(waveformMagic), waveformVersion)
+	buf = binary.AppendUvarint(buf, uint64(w.Samplerate))
+	buf = binary.AppendUvarint(buf, uint64(w.SamplesPerPeak))
+
+	buf = binary.AppendUvarint(buf, uint64(len(w.Min)))
+	for i := range w.Min {
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(w.Min[i]))
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(w.Max[i]))
+	}
+
+	n, err := wr.Write(buf)
+
+	return int64(n), err
+}
+
+// ReadWaveform reads a waveform written by Waveform.WriteTo from r.
+func ReadWaveform(r io.Reader) (*Waveform, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(waveformMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, errors.Join(ErrInvalidWaveform, err)
+	}
+	if string(header[:len(waveformMagic)]) != waveformMagic || header[len(waveformMagic)] != waveformVersion {
+		return nil, ErrInvalidWaveform
+	}
+
+	var values [3]uint64
+	for i := range values {
+		v, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, errors.Join(ErrInvalidWaveform, err)
+		}
+		values[i] = v
+	}
+
+	// Do not trust the count for the allocation, the peaks are read as they come.
+	w := &Waveform{Samplerate: int(values[0]), SamplesPerPeak: int(values[1])}
+	var peak [8]byte
+	for i := uint64(0); i < values[2]; i++ {
+		if _, err := io.ReadFull(br, peak[:]); err != nil {
+			return nil, errors.Join(ErrInvalidWaveform, err)
+		}
+
+		w.Min = append(w.Min, math.Float32frombits(binary.LittleEndian.Uint32(peak[0:])))
+		w.Max = append(w.Max, math.Float32frombits(binary.LittleEndian.Uint32(peak[4:])))
+	}
+
+	return w, nil
+}
+
+// WaveformAnalyzer collects the peaks of a waveform from decoded samples, given one after the other.
+type WaveformAnalyzer struct {
+	waveform Waveform
+
+	min, max float32
+	count    int
+}
+
+// NewWaveformAnalyzer creates an analyzer of samples with the samplerate, with a peak of both channels
+// for every samplesPerPeak samples.
+func NewWaveformAnalyzer(samplerate, samplesPerPeak int) *WaveformAnalyzer {
+	return &WaveformAnalyzer{
+		waveform: Waveform{Samplerate: samplerate, SamplesPerPeak: max(samplesPerPeak, 1)},
+		min:      float32(math.Inf(1)),
+		max:      float32(math.Inf(-1)),
+	}
+}
+
+// Write adds the samples.
+func (a *WaveformAnalyzer) Write(samples *Samples) {
+	w := &a.waveform
+
+	for i, frames := 0, samples.frames(); i < frames; i++ {
+		l, r := samples.f32(i, 0), samples.f32(i, 1)
+		a.min = min(a.min, l, r)
+		a.max = max(a.max, l, r)
+
+		a.count++
+		if a.count == w.SamplesPerPeak {
+			w.Min = append(w.Min, a.min)
+			w.Max = append(w.Max, a.max)
+
+			a.min, a.max = float32(math.Inf(1)), float32(math.Inf(-1))
+			a.count = 0
+		}
+	}
+}
+
+// Waveform returns the peaks so far, including the one of the samples that do not fill a peak yet.
+// The returned waveform is a copy.
+func (a *WaveformAnalyzer) Waveform() *Waveform {
+	w := a.waveform
+	w.Min = append([]float32(nil), w.Min...)
+	w.Max = append([]float32(nil), w.Max...)
+
+	if a.count > 0 {
+		w.Min = append(w.Min, a.min)
+		w.Max = append(w.Max, a.max)
+	}
+
+	return &w
+}
+
+// Waveform decodes the whole audio stream and returns its waveform, see NewWaveformAnalyzer.
+// The position is rewound before and after.
+func (m *MPEG) Waveform(samplesPerPeak int) *Waveform {
+	if !m.initDecoders() || m.audioPacketType == 0 {
+		return nil
+	}
+
+	analyzer := NewWaveformAnalyzer(m.Samplerate(), samplesPerPeak)
+	m.scanAudio(analyzer.Write)
+
+	return analyzer.Waveform()
+}
@@ -0,0 +1,76 @@
+package mpeg_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/gen2brain/mpeg"
+)
+
+func TestWaveform(t *testing.T) {
+	m, err := mpeg.New(bytes.NewReader(testMp2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waveform := m.Waveform(1000)
+	if waveform == nil || waveform.Samplerate != 44100 || len(waveform.Min) != len(waveform.Max) {
+		t.Fatalf("Waveform: got %+v", waveform)
+	}
+
+	// All samples, the last peak is not full.
+	m, err = mpeg.New(bytes.NewReader(testMp2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetAudioFormat(mpeg.AudioF32NLR)
+
+	var samples []float32
+	for s := m.DecodeAudio(); s != nil; s = m.DecodeAudio() {
+		samples = append(samples, s.Left...)
+	}
+	if want := (len(samples) + 999) / 1000; len(waveform.Min) != want {
+		t.Fatalf("Waveform: got %d peaks, want %d", len(waveform.Min), want)
+	}
+	for i := range waveform.Min {
+		peak := samples[i*1000 : min(i*1000+1000, len(samples))]
+		if waveform.Min[i] != slices.Min(peak) || waveform.Max[i] != slices.Max(peak) {
+			t.Fatalf("peak %d: got %v, %v, want %v, %v", i, waveform.Min[i], waveform.Max[i], slices.Min(peak), slices.Max(peak))
+		}
+	}
+
+	var b bytes.Buffer
+	if _, err := waveform.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	read, err := mpeg.ReadWaveform(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, waveform) {
+		t.Errorf("ReadWaveform: got %+v, want %+v", read, waveform)
+	}
+	if _, err := mpeg.ReadWaveform(bytes.NewReader(b.Bytes()[:b.Len()-1])); !errors.Is(err, mpeg.ErrInvalidWaveform) {
+		t.Errorf("ReadWaveform: got error %v, want %v", err, mpeg.ErrInvalidWaveform)
+	}
+
+	invalid := *waveform
+	invalid.Max = invalid.Max[:len(invalid.Max)-1]
+	if _, err := invalid.WriteTo(io.Discard); !errors.Is(err, mpeg.ErrInvalidWaveform) {
+		t.Errorf("WriteTo: got error %v, want %v", err, mpeg.ErrInvalidWaveform)
+	}
+
+	data, err := json.Marshal(waveform)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded mpeg.Waveform
+	if err := json.Unmarshal(data, &decoded); err != nil || !reflect.DeepEqual(&decoded, waveform) {
+		t.Errorf("json: got %v, %+v", err, decoded)
+	}
+}
@@ -0,0 +1,250 @@
+package mpeg
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidY4M is the error returned when a YUV4MPEG2 stream can not be read or written.
+var ErrInvalidY4M = errors.New("invalid YUV4MPEG2")
+
+// Chroma siting of 4:2:0 YUV4MPEG2 streams. MPEG-1 sites chroma between the luma samples, like JPEG.
+const (
+	Y4MChroma420jpeg  = "420jpeg"
+	Y4MChroma420mpeg2 = "420mpeg2"
+	Y4MChroma420paldv = "420paldv"
+)
+
+// Y4MHeader is the stream header of a YUV4MPEG2 stream. The frame rate and the pixel aspect ratio
+// (width to height of a pixel) are rationals, 0:0 if not known. Chroma is one of the 4:2:0 sitings.
+type Y4MHeader struct {
+	Width        int
+	Height       int
+	FrameRateNum int
+	FrameRateDen int
+	AspectNum    int
+	AspectDen    int
+	Chroma       string
+}
+
+// NewY4MHeader returns the header for the decoded video of m.
+func NewY4MHeader(m *MPEG) Y4MHeader {
+	h := Y4MHeader{Width: m.Width(), Height: m.Height(), Chroma: Y4MChroma420jpeg}
+	h.FrameRateNum, h.FrameRateDen = m.FramerateRational()
+
+	// The pel aspect ratio of MPEG-1 is the height to width of a pixel, approximated like FFmpeg does.
+	if m.videoDecoder != nil && m.videoDecoder.aspectRatio != 0 {
+		h.AspectNum, h.AspectDen = rational(1/m.videoDecoder.aspectRatio, 255)
+	}
+
+	return h
+}
+
+// Y4MWriter writes decoded frames as a YUV4MPEG2 stream, cropped to the picture size.
+type Y4MWriter struct {
+	w      *bufio.Writer
+	header Y4MHeader
+
+	wroteHeader bool
+}
+
+// NewY4MWriter creates a writer of a YUV4MPEG2 stream with the header, see NewY4MHeader.
+// The stream header is written with the first frame.
+func NewY4MWriter(w io.Writer, header Y4MHeader) *Y4MWriter {
+	if header.Chroma == "" {
+		header.Chroma = Y4MChroma420jpeg
+	}
+
+	return &Y4MWriter{w: bufio.NewWriter(w), header: header}
+}
+
+// WriteFrame writes the frame.
+func (y *Y4MWriter) WriteFrame(frame *Frame) error {
+	return y.WriteImage(frame.YCbCr())
+}
+
+// WriteImage writes a 4:2:0 image with the size of the header.
+func (y *Y4MWriter) WriteImage(img *image.YCbCr) error {
+	h := y.header
+	b := img.Rect
+	if img.SubsampleRatio != image.YCbCrSubsampleRatio420 || b.Dx() != h.Width || b.Dy() != h.Height {
+		return ErrInvalidY4M
+	}
+
+	if !y.wroteHeader {
+		fmt.Fprintf(y.w, "YUV4MPEG2 W%d H%d F%d:%d Ip A%d:%d C%s\n",
+			h.Width, h.Height, h.FrameRateNum, h.FrameRateDen, h.AspectNum, h.AspectDen, h.Chroma)
+		y.wroteHeader = true
+	}
+
+	if _, err := y.w.WriteString("FRAME\n"); err != nil {
+		return err
+	}
+
+	for row := b.Min.Y; row < b.Max.Y; row++ {
+		i := img.YOffset(b.Min.X, row)
+		if _, err := y.w.Write(img.Y[i : i+b.Dx()]); err != nil {
+			return err
+		}
+	}
+
+	cw, ch := (h.Width+1)/2, (h.Height+1)/2
+	for _, plane := range [][]byte{img.Cb, img.Cr} {
+		for row := 0; row < ch; row++ {
+			i := img.COffset(b.Min.X, b.Min.Y+row*2)
+			if _, err := y.w.Write(plane[i : i+cw]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (y *Y4MWriter) Flush() error {
+	return y.w.Flush()
+}
+
+// y4mMaxSize is the largest width and height read, the 12 bits of the MPEG-1 sequence header.
+// It bounds the memory allocated for the frames of an untrusted stream.
+const y4mMaxSize = 4095
+
+// Y4MReader reads a 4:2:0 YUV4MPEG2 stream.
+type Y4MReader struct {
+	r      *bufio.Reader
+	header Y4MHeader
+}
+
+// NewY4MReader reads the stream header from r.
+// Returns ErrInvalidY4M if the frames are larger than MPEG-1 video can be, 4095x4095.
+func NewY4MReader(r io.Reader) (*Y4MReader, error) {
+	y := &Y4MReader{r: bufio.NewReader(r)}
+
+	line, err := y.r.ReadString('\n')
+	if err != nil {
+		return nil, errors.Join(ErrInvalidY4M, err)
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != "YUV4MPEG2" {
+		return nil, ErrInvalidY4M
+	}
+
+	h := Y4MHeader{Chroma: Y4MChroma420jpeg}
+	for _, field := range fields[1:] {
+		value := field[1:]
+
+		switch field[0] {
+		case 'W':
+			h.Width, err = strconv.Atoi(value)
+		case 'H':
+			h.Height, err = strconv.Atoi(value)
+		case 'F':
+			h.FrameRateNum, h.FrameRateDen, err = parseRatio(value)
+		case 'A':
+			h.AspectNum, h.AspectDen, err = parseRatio(value)
+		case 'C':
+			h.Chroma = value
+		case 'I':
+			if value != "p" && value != "?" {
+				err = ErrInvalidY4M
+			}
+		}
+
+		if err != nil {
+			return nil, errors.Join(ErrInvalidY4M, err)
+		}
+	}
+
+	switch h.Chroma {
+	case Y4MChroma420jpeg, Y4MChroma420mpeg2, Y4MChroma420paldv, "420":
+	default:
+		return nil, ErrInvalidY4M
+	}
+
+	if h.Width <= 0 || h.Height <= 0 || h.Width > y4mMaxSize || h.Height > y4mMaxSize {
+		return nil, ErrInvalidY4M
+	}
+
+	y.header = h
+
+	return y, nil
+}
+
+// Header returns the stream header.
+func (y *Y4MReader) Header() Y4MHeader {
+	return y.header
+}
+
+// Read reads the next frame. Returns io.EOF at the end of the stream.
+func (y *Y4MReader) Read() (*image.YCbCr, error) {
+	line, err := y.r.ReadString('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) && line == "" {
+			return nil, io.EOF
+		}
+
+		return nil, errors.Join(ErrInvalidY4M, io.ErrUnexpectedEOF)
+	}
+
+	if !strings.HasPrefix(line, "FRAME") {
+		return nil, ErrInvalidY4M
+	}
+
+	img := image.NewYCbCr(image.Rect(0, 0, y.header.Width, y.header.Height), image.YCbCrSubsampleRatio420)
+	for _, plane := range [][]byte{img.Y, img.Cb, img.Cr} {
+		if _, err := io.ReadFull(y.r, plane); err != nil {
+			return nil, errors.Join(ErrInvalidY4M, io.ErrUnexpectedEOF)
+		}
+	}
+
+	return img, nil
+}
+
+func parseRatio(s string) (num, den int, err error) {
+	n, d, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, ErrInvalidY4M
+	}
+
+	if num, err = strconv.Atoi(n); err != nil {
+		return 0, 0, err
+	}
+	if den, err = strconv.Atoi(d); err != nil {
+		return 0, 0, err
+	}
+
+	return num, den, nil
+}
+
+// rational returns the closest fraction to f with a denominator up to maxDen, by continued fractions.
+func rational(f float64, maxDen int) (num, den int) {
+	h0, h1 := 0, 1
+	k0, k1 := 1, 0
+
+	x := f
+	for {
+		a := int(math.Floor(x))
+		if k1 > 0 && a*k1+k0 > maxDen {
+			break
+		}
+
+		h0, h1 = h1, a*h1+h0
+		k0, k1 = k1, a*k1+k0
+
+		frac := x - float64(a)
+		if frac < 1e-9 {
+			break
+		}
+		x = 1 / frac
+	}
+
+	return h1, k1
+}
@@ -0,0 +1,125 @@
+package mpeg_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gen2brain/mpeg"
+)
+
+func TestY4M(t *testing.T) {
+	m, err := mpeg.New(bytes.NewReader(testMpg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetAudioEnabled(false)
+
+	header := mpeg.NewY4MHeader(m)
+	want := mpeg.Y4MHeader{Width: 160, Height: 120, FrameRateNum: 30, FrameRateDen: 1, AspectNum: 1, AspectDen: 1, Chroma: mpeg.Y4MChroma420jpeg}
+	if header != want {
+		t.Fatalf("NewY4MHeader: got %+v, want %+v", header, want)
+	}
+
+	var b bytes.Buffer
+	w := mpeg.NewY4MWriter(&b, header)
+
+	var frames []*image.YCbCr
+	for frame := m.DecodeVideo(); frame != nil; frame = m.DecodeVideo() {
+		if err := w.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+
+		img := frame.YCbCr()
+		frames = append(frames, &image.YCbCr{
+			Y: slices.Clone(img.Y), Cb: slices.Clone(img.Cb), Cr: slices.Clone(img.Cr),
+			YStride: img.YStride, CStride: img.CStride, SubsampleRatio: img.SubsampleRatio, Rect: img.Rect,
+		})
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if line, _, _ := strings.Cut(b.String(), "\n"); line != "YUV4MPEG2 W160 H120 F30:1 Ip A1:1 C420jpeg" {
+		t.Errorf("header: got %q", line)
+	}
+	if size := len(frames) * (len("FRAME\n") + 160*120*3/2); b.Len() != size+len("YUV4MPEG2 W160 H120 F30:1 Ip A1:1 C420jpeg\n") {
+		t.Errorf("WriteFrame: got %d bytes, want %d frames of cropped planes", b.Len(), len(frames))
+	}
+
+	r, err := mpeg.NewY4MReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Header() != header {
+		t.Errorf("Header: got %+v, want %+v", r.Header(), header)
+	}
+
+	for i, frame := range frames {
+		img, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for x, y := 0, 0; y < 120; x, y = (x+37)%160, y+1 {
+			if img.YCbCrAt(x, y) != frame.YCbCrAt(x, y) {
+				t.Fatalf("Read: frame %d differs at %d,%d", i, x, y)
+			}
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("Read: got error %v, want %v", err, io.EOF)
+	}
+
+	// Odd sizes round the chroma planes up.
+	src := image.NewYCbCr(image.Rect(0, 0, 5, 3), image.YCbCrSubsampleRatio420)
+	for i := range src.Y {
+		src.Y[i] = byte(i)
+	}
+	for i := range src.Cb {
+		src.Cb[i], src.Cr[i] = byte(100+i), byte(200+i)
+	}
+
+	b.Reset()
+	w = mpeg.NewY4MWriter(&b, mpeg.Y4MHeader{Width: 5, Height: 3, FrameRateNum: 30000, FrameRateDen: 1001, Chroma: mpeg.Y4MChroma420mpeg2})
+	if err := w.WriteImage(src); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteImage(image.NewYCbCr(image.Rect(0, 0, 4, 3), image.YCbCrSubsampleRatio420)); !errors.Is(err, mpeg.ErrInvalidY4M) {
+		t.Errorf("WriteImage: got error %v, want %v", err, mpeg.ErrInvalidY4M)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = mpeg.NewY4MReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := r.Header(); h.FrameRateNum != 30000 || h.FrameRateDen != 1001 || h.Chroma != mpeg.Y4MChroma420mpeg2 || !reflect.DeepEqual(img, src) {
+		t.Errorf("Read: got %+v, %+v, want %+v", h, img, src)
+	}
+
+	if _, err := mpeg.NewY4MReader(strings.NewReader("YUV4MPEG2 W5 H3 C444\n")); !errors.Is(err, mpeg.ErrInvalidY4M) {
+		t.Errorf("NewY4MReader: got error %v, want %v", err, mpeg.ErrInvalidY4M)
+	}
+
+	// Frames larger than MPEG-1 video are not allocated.
+	for _, header := range []string{"W100000 H100000", "W4096 H16", "W16 H4096"} {
+		if _, err := mpeg.NewY4MReader(strings.NewReader("YUV4MPEG2 " + header + " F30:1 Ip A1:1\nFRAME\n")); !errors.Is(err, mpeg.ErrInvalidY4M) {
+			t.Errorf("NewY4MReader %s: got error %v, want %v", header, err, mpeg.ErrInvalidY4M)
+		}
+	}
+	if _, err := mpeg.NewY4MReader(strings.NewReader("YUV4MPEG2 W4095 H4095\n")); err != nil {
+		t.Errorf("NewY4MReader W4095 H4095: got error %v", err)
+	}
+}